@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thetronjohnson/layrr/internal/claude"
+	"github.com/thetronjohnson/layrr/internal/history"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+)
+
+// runHistory implements `layrr history`: list recorded jobs, or show one with `history show <id>`
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	dir := fs.String("dir", ".", "Project directory")
+	state := fs.String("state", "", "Only jobs with this outcome (done, failed, cancelled, review, rejected)")
+	since := fs.String("since", "", "Only jobs started within this duration (e.g. 2h) or since this date (2006-01-02)")
+	text := fs.String("grep", "", "Only jobs whose instruction contains this text")
+	file := fs.String("file", "", "Only jobs that changed a file whose path contains this text")
+	limit := fs.Int("n", 20, "Show at most this many jobs (0 = all)")
+	asJSON := fs.Bool("json", false, "Print records as JSON lines")
+	events := fs.Bool("events", false, "With show: print every agent event")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  layrr history [flags]            List recorded jobs, newest first\n  layrr history show [flags] <id>  Show one job (an ID prefix is enough)\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	show := len(args) > 0 && args[0] == "show"
+	if show {
+		args = args[1:]
+	}
+	fs.Parse(args)
+
+	// Allow flags after the job ID too
+	rest := fs.Args()
+	if show && len(rest) > 1 {
+		fs.Parse(rest[1:])
+		rest = append(rest[:1], fs.Args()...)
+	}
+
+	records, err := history.Load(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if show {
+		if len(rest) != 1 {
+			fs.Usage()
+			return 2
+		}
+		record, err := history.Find(records, rest[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if *asJSON {
+			return printJSON(record)
+		}
+		showRecord(record, *events)
+		return 0
+	}
+
+	filter := history.Filter{State: *state, Text: *text, File: *file}
+	if *since != "" {
+		if filter.Since, err = history.ParseSince(*since); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+	}
+
+	// Newest first
+	var matched []history.Record
+	for i := len(records) - 1; i >= 0; i-- {
+		if filter.Match(records[i]) {
+			matched = append(matched, records[i])
+			if *limit > 0 && len(matched) == *limit {
+				break
+			}
+		}
+	}
+
+	if *asJSON {
+		for _, record := range matched {
+			if code := printJSON(record); code != 0 {
+				return code
+			}
+		}
+		return 0
+	}
+	if len(matched) == 0 {
+		fmt.Println("No jobs recorded yet (or none match). History is kept in " + history.File)
+		return 0
+	}
+	listRecords(matched)
+	return 0
+}
+
+// listRecords prints one line per job
+func listRecords(records []history.Record) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTARTED\tSTATE\tTIME\tCOST\tFILES\tINSTRUCTION")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			r.ID,
+			r.StartedAt.Local().Format("2006-01-02 15:04"),
+			r.State,
+			r.Duration().Round(time.Second),
+			formatCost(r.CostUSD),
+			len(r.Changes),
+			oneLine(r.Instruction, 60),
+		)
+	}
+	w.Flush()
+}
+
+// showRecord prints the details of one job
+func showRecord(r history.Record, allEvents bool) {
+	fmt.Printf("Job %s (%s)\n", r.ID, r.State)
+	fmt.Printf("  Started:   %s\n", r.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Duration:  %s\n", r.Duration().Round(100*time.Millisecond))
+	fmt.Printf("  Agent:     %s", r.Agent)
+	if r.Model != "" {
+		fmt.Printf(" (%s)", r.Model)
+	}
+	fmt.Println()
+	if r.CostUSD > 0 || r.NumTurns > 0 {
+		fmt.Printf("  Cost:      %s over %d turns\n", formatCost(r.CostUSD), r.NumTurns)
+	}
+	if r.SessionID != "" {
+		fmt.Printf("  Session:   %s\n", r.SessionID)
+	}
+	if r.PageURL != "" {
+		fmt.Printf("  Page:      %s\n", r.PageURL)
+	}
+	if r.Worktree {
+		fmt.Println("  Worktree:  yes")
+	}
+	if r.ReviewedAt != nil {
+		fmt.Printf("  Reviewed:  %s\n", r.ReviewedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	if r.ReplayOf != "" {
+		fmt.Printf("  Replay of: %s\n", r.ReplayOf)
+	}
+	if r.Error != "" {
+		fmt.Printf("  Error:     %s\n", r.Error)
+	}
+
+	fmt.Printf("\nInstruction:\n  %s\n", indent(r.Instruction))
+
+	if elements := recordedElements(r); len(elements) > 0 {
+		fmt.Println("\nSelected elements:")
+		for _, el := range elements {
+			fmt.Printf("  %s\n", el)
+		}
+	}
+	for _, path := range r.Screenshots {
+		fmt.Printf("\nScreenshot: %s\n", path)
+	}
+
+	fmt.Println("\nFiles changed:")
+	if len(r.Changes) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, c := range r.Changes {
+		fmt.Printf("  %s %s\n", changeMarker(c.Kind), c.Path)
+	}
+
+	if r.Prompt != "" {
+		fmt.Printf("\nPrompt:\n  %s\n", indent(r.Prompt))
+	}
+
+	fmt.Printf("\nEvents (%d):\n", len(r.Events))
+	for _, event := range r.Events {
+		for _, line := range describeEvent(event, allEvents) {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+}
+
+// recordedElements lists the selectors (and source locations) recorded with a job
+func recordedElements(r history.Record) []string {
+	var msg struct {
+		Area struct {
+			Elements []struct {
+				Selector string `json:"selector"`
+				Source   *struct {
+					File string `json:"file"`
+					Line int    `json:"line"`
+				} `json:"source"`
+			} `json:"elements"`
+		} `json:"area"`
+		Edits *struct {
+			Changes []struct {
+				Operation string `json:"operation"`
+				Selector  string `json:"selector"`
+				Source    string `json:"source"`
+			} `json:"changes"`
+		} `json:"edits"`
+	}
+	if len(r.Message) == 0 || json.Unmarshal(r.Message, &msg) != nil {
+		return nil
+	}
+
+	var elements []string
+	for _, el := range msg.Area.Elements {
+		line := el.Selector
+		if el.Source != nil && el.Source.File != "" {
+			line += fmt.Sprintf("  (%s:%d)", el.Source.File, el.Source.Line)
+		}
+		elements = append(elements, line)
+	}
+	if msg.Edits != nil {
+		for _, change := range msg.Edits.Changes {
+			line := change.Operation + " " + change.Selector
+			if change.Source != "" {
+				line += "  (" + change.Source + ")"
+			}
+			elements = append(elements, line)
+		}
+	}
+	return elements
+}
+
+// describeEvent summarizes an agent event; verbose prints text and tool output in full
+func describeEvent(event claude.Event, verbose bool) []string {
+	switch event.Type {
+	case claude.EventSystem:
+		return []string{fmt.Sprintf("⚙ %s %s", event.Subtype, event.Model)}
+	case claude.EventResult:
+		status := "✓"
+		if event.IsError {
+			status = "✗"
+		}
+		return []string{fmt.Sprintf("%s result: %d turns, %s, %s", status, event.NumTurns,
+			formatCost(event.TotalCostUSD), (time.Duration(event.DurationMS) * time.Millisecond).Round(100*time.Millisecond))}
+	}
+
+	if event.Message == nil {
+		return nil
+	}
+	var lines []string
+	for _, block := range event.Message.Content {
+		switch block.Type {
+		case claude.BlockText:
+			if verbose {
+				lines = append(lines, "💬 "+indent(block.Text))
+			} else {
+				lines = append(lines, "💬 "+oneLine(block.Text, 100))
+			}
+		case claude.BlockToolUse:
+			lines = append(lines, fmt.Sprintf("🔧 %s %s", block.Name, block.Input.Target()))
+			if verbose && block.Input != nil && len(block.Input.Raw) > 0 {
+				lines = append(lines, "   "+string(block.Input.Raw))
+			}
+		case claude.BlockToolResult:
+			if verbose {
+				lines = append(lines, "↳ "+indent(block.ResultText()))
+			} else if block.IsError {
+				lines = append(lines, "↳ error: "+oneLine(block.ResultText(), 100))
+			}
+		}
+	}
+	return lines
+}
+
+// printJSON writes a record as one JSON line
+func printJSON(r history.Record) int {
+	data, err := json.Marshal(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
+
+// formatCost formats a USD amount ("-" when unknown)
+func formatCost(usd float64) string {
+	if usd == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("$%.2f", usd)
+}
+
+// changeMarker is the +/~/- prefix for a changed file
+func changeMarker(kind snapshot.ChangeKind) string {
+	switch kind {
+	case snapshot.Created:
+		return "+"
+	case snapshot.Deleted:
+		return "-"
+	}
+	return "~"
+}
+
+// oneLine flattens text to its first line, cut to n runes
+func oneLine(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i] + " ..."
+	}
+	if runes := []rune(s); len(runes) > n {
+		s = string(runes[:n]) + "..."
+	}
+	return s
+}
+
+// indent indents continuation lines of multi-line text
+func indent(s string) string {
+	return strings.ReplaceAll(strings.TrimSpace(s), "\n", "\n  ")
+}
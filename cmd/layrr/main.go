@@ -4,17 +4,24 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/thetronjohnson/layrr/internal/agent"
 	"github.com/thetronjohnson/layrr/internal/bridge"
+	"github.com/thetronjohnson/layrr/internal/certs"
 	"github.com/thetronjohnson/layrr/internal/claude"
 	"github.com/thetronjohnson/layrr/internal/config"
+	"github.com/thetronjohnson/layrr/internal/devserver"
+	"github.com/thetronjohnson/layrr/internal/events"
+	"github.com/thetronjohnson/layrr/internal/prompt"
 	"github.com/thetronjohnson/layrr/internal/proxy"
 	"github.com/thetronjohnson/layrr/internal/status"
 	"github.com/thetronjohnson/layrr/internal/tui"
@@ -22,6 +29,16 @@ import (
 )
 
 func main() {
+	// Subcommands that work on a project without starting the proxy
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "history":
+			os.Exit(runHistory(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		}
+	}
+
 	// Parse configuration
 	cfg, err := config.ParseFlags()
 	if err != nil {
@@ -32,40 +49,118 @@ func main() {
 	// Initialize status display (kept for compatibility, but TUI replaces it)
 	statusDisplay := status.NewDisplay()
 
-	// Auto-detect dev server port if not specified
-	if cfg.AutoDetectPort {
-		detectedPort, err := proxy.DetectDevServer()
+	// Job lifecycle, agent stream and dev server events; the TUI and browsers subscribe independently
+	bus := events.New()
+
+	// Auto-detect dev server port if not specified. Without a running dev server, layrr starts
+	// one itself: the -run command, or the dev script from package.json.
+	target := proxy.Target{URL: cfg.Target, Insecure: cfg.TargetInsecure}
+	runCommand := cfg.Run
+	if cfg.AutoDetectPort && runCommand == "" {
+		found := proxy.DetectDevServers(cfg.ProjectDir, cfg.ProxyPort)
+		if len(found) > 0 {
+			devServer := pickDevServer(found)
+			fmt.Printf("✓ Dev server: %s\n", devServer)
+			target = devServer.Target
+		} else if runCommand, err = devserver.Detect(cfg.ProjectDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: no running dev server found, and can't start one: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Please start your dev server first, specify it with -target-port or -target, or give its command with -run\n")
+			os.Exit(1)
+		}
+	} else if runCommand == "" {
+		if err := target.Check(); err != nil {
+			// The dev server may still be starting, so only warn
+			fmt.Printf("⚠️  %v\n", err)
+		}
+	}
+
+	var devServer *devserver.Server
+	if runCommand != "" {
+		devServer, err = startDevServer(runCommand, cfg.ProjectDir, bus, cfg.Target)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Please start your dev server first or specify the port with -target-port\n")
 			os.Exit(1)
 		}
-		cfg.TargetPort = detectedPort
+		target = proxy.Target{URL: devServer.URL(), Insecure: cfg.TargetInsecure}
+		if devServer.URL().Scheme == "https" && !cfg.TargetInsecure {
+			fmt.Println("   The dev server uses HTTPS; pass -target-insecure if its certificate is self-signed")
+		}
 	}
 
 	// Ensure Anthropic API key is available for design-to-code features
-	if err := ensureAPIKey(cfg.ProjectDir); err != nil {
+	// (scripted runs are offline demos, so don't prompt for one)
+	if cfg.Agent != agent.Scripted {
+		if err := ensureAPIKey(cfg.ProjectDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Load the permission policy from .layrr/config.json (edit-only by default)
+	projectConfig, err := config.LoadProjectConfig(cfg.ProjectDir)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	permissions, err := projectConfig.Permissions.Resolve()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if permissions.SkipAll {
+		fmt.Printf("⚠️  Permission policy: %s\n", permissions)
+	} else {
+		fmt.Printf("✓ Permission policy: %s\n", permissions)
+	}
 
-	// Initialize Bubble Tea TUI with alt screen mode
-	tuiModel := tui.NewModel()
-	tuiProgram := tea.NewProgram(tuiModel, tea.WithAltScreen())
+	// Check prompt overrides from .layrr/templates/ up front so mistakes show at startup
+	if overrides, err := prompt.New(cfg.ProjectDir).Overrides(); err != nil {
+		fmt.Printf("⚠️  Prompt templates: %v\n", err)
+	} else if len(overrides) > 0 {
+		fmt.Printf("✓ Prompt templates: %s (from %s)\n", strings.Join(overrides, ", "), prompt.TemplateDir)
+	}
 
-	// Start Claude Code manager
-	claudeManager, err := claude.NewManager(cfg.ProjectDir, cfg.ClaudeCodePath, cfg.Verbose)
+	// Start the coding agent (Claude Code by default)
+	codeAgent, err := agent.New(cfg.Agent, agent.Options{
+		ProjectDir: cfg.ProjectDir,
+		Bus:        bus,
+		ClaudePath: cfg.ClaudeCodePath,
+		Permissions: claude.Permissions{
+			AllowedTools:    permissions.AllowedTools,
+			DisallowedTools: permissions.DisallowedTools,
+			SkipAll:         permissions.SkipAll,
+		},
+		Fixture: cfg.AgentFixture,
+		Verbose: cfg.Verbose,
+	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error starting Claude Code: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error starting %s agent: %v\n", cfg.Agent, err)
 		os.Exit(1)
 	}
 
-	// Connect manager to TUI
-	claudeManager.SetProgram(tuiProgram)
-
 	// Create bridge
-	bridgeInstance := bridge.NewBridge(claudeManager, cfg.Verbose, statusDisplay)
-	bridgeInstance.SetProgram(tuiProgram)
+	bridgeInstance := bridge.NewBridge(codeAgent, bus, cfg.ProjectDir, cfg.Verbose)
+	bridgeInstance.DeleteOldCheckpoints()
+	if err := bridgeInstance.SetWorktreeMode(cfg.Worktree); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Worktree {
+		fmt.Println("✓ Worktree mode: instructions run in isolated git worktrees until accepted, each in a new session")
+	}
+
+	// Initialize Bubble Tea TUI with alt screen mode
+	tuiModel := tui.NewModel()
+	tuiModel.SetNewSessionHandler(codeAgent.ResetSession)
+	tuiModel.SetPolicy(permissions.Preset)
+	tuiModel.SetCancelHandler(func() { bridgeInstance.CancelRunning() })
+	if devServer != nil {
+		tuiModel.SetDevServer(devServer.Command(), devServer.URL().String())
+	}
+	tuiProgram := tea.NewProgram(tuiModel, tea.WithAltScreen())
+
+	// Feed bus events to the TUI
+	bus.Subscribe(func(event any) { tuiProgram.Send(event) })
 
 	// Start file watcher
 	watcherInstance, err := watcher.NewWatcher(cfg.ProjectDir, cfg.Verbose, statusDisplay)
@@ -76,7 +171,34 @@ func main() {
 	defer watcherInstance.Close()
 
 	// Create and start proxy server
-	server := proxy.NewServer(cfg.ProxyPort, cfg.TargetPort, bridgeInstance, watcherInstance, cfg.Verbose, cfg.ProjectDir)
+	server, err := proxy.NewServer(cfg.ProxyPort, target, bridgeInstance, bus, watcherInstance, cfg.Verbose, cfg.ProjectDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if devServer != nil && cfg.Target == nil {
+		followDevServer(server, bus, devServer.URL(), cfg.TargetInsecure)
+	}
+	if cfg.HTTPS {
+		if err := enableHTTPS(server); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.LAN {
+		server.EnableLAN()
+		fmt.Printf("⚠️  LAN access: anyone on your network who can open port %d can drive the coding agent\n", cfg.ProxyPort)
+	}
+	if cfg.Token != "" {
+		server.SetToken(cfg.Token)
+	}
+	// The token stays out of the terminal, where it would end up in scrollback and logs
+	if err := server.SaveToken(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		fmt.Printf("✓ HTTP API: %s/__layrr/api/\n", server.URL())
+	} else {
+		fmt.Printf("✓ HTTP API: %s/__layrr/api/ (token in %s)\n", server.URL(), proxy.TokenFile)
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -92,7 +214,10 @@ func main() {
 		server.Shutdown(ctx)
 
 		// Close other resources
+		server.RemoveToken()
 		watcherInstance.Close()
+		bridgeInstance.CleanupWorktrees()
+		devServer.Stop()
 
 		os.Exit(0)
 	}()
@@ -100,7 +225,7 @@ func main() {
 	// Open browser
 	go func() {
 		time.Sleep(500 * time.Millisecond) // Wait for server to start
-		url := fmt.Sprintf("http://localhost:%d", cfg.ProxyPort)
+		url := server.URL() + target.StartPath()
 		openBrowser(url)
 	}()
 
@@ -114,10 +239,125 @@ func main() {
 	// Start server (blocking)
 	if err := server.Start(); err != nil {
 		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
+		devServer.Stop()
 		os.Exit(1)
 	}
 }
 
+// devServerTimeout is how long a dev server started by layrr gets to accept connections
+const devServerTimeout = 2 * time.Minute
+
+// startDevServer starts and supervises the dev server, showing its output until it's ready.
+// With a nil target, it's proxied at the URL it prints.
+func startDevServer(command, dir string, bus *events.Bus, target *url.URL) (*devserver.Server, error) {
+	fmt.Printf("▶ Starting dev server: %s\n", command)
+	server := devserver.New(command, dir, bus)
+	if target != nil {
+		server.SetTarget(target)
+	}
+
+	// The TUI shows the output once it's running
+	unsubscribe := bus.Subscribe(func(event any) {
+		if msg, ok := event.(devserver.LogMsg); ok {
+			fmt.Printf("   │ %s\n", msg.Line)
+		}
+	})
+	defer unsubscribe()
+
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+
+	// Ctrl+C while waiting stops the dev server too
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(interrupted, devServerTimeout)
+	defer cancel()
+
+	u, err := server.Ready(ctx)
+	bus.Sync()
+	if err != nil {
+		server.Stop()
+		if interrupted.Err() != nil {
+			return nil, fmt.Errorf("interrupted while waiting for the dev server")
+		}
+		return nil, err
+	}
+	fmt.Printf("✓ Dev server ready at %s (restarted if it crashes)\n", u)
+	return server, nil
+}
+
+// followDevServer points the proxy at the URL a restarted dev server prints, which moves
+// when its old port is still taken
+func followDevServer(server *proxy.Server, bus *events.Bus, first *url.URL, insecure bool) {
+	current := first.String()
+	bus.Subscribe(func(event any) {
+		msg, ok := event.(devserver.StateMsg)
+		if !ok || msg.State != devserver.Ready || msg.URL == "" || msg.URL == current {
+			return
+		}
+		u, err := url.Parse(msg.URL)
+		if err != nil {
+			return
+		}
+		current = msg.URL
+		server.SetTarget(proxy.Target{URL: u, Insecure: insecure})
+	})
+}
+
+// enableHTTPS loads (or creates) the local CA and certificate and explains how to trust them
+func enableHTTPS(server *proxy.Server) error {
+	dir, err := certs.Dir()
+	if err != nil {
+		return err
+	}
+	bundle, err := certs.Ensure(dir)
+	if err != nil {
+		return fmt.Errorf("failed to set up HTTPS: %w", err)
+	}
+
+	server.EnableHTTPS(bundle.Certificate)
+	if bundle.CreatedCA {
+		fmt.Printf("✓ HTTPS: created a local CA in %s\n", bundle.Dir)
+	} else {
+		fmt.Printf("✓ HTTPS: certificate from %s\n", bundle.Dir)
+	}
+	if !bundle.Trusted() {
+		fmt.Printf("⚠️  The browser will warn about the certificate until the layrr CA is trusted.\n%s\n", bundle.TrustInstructions())
+	}
+	return nil
+}
+
+// pickDevServer asks which dev server to proxy when several are running. Without a
+// terminal to ask on, the most likely one is taken.
+func pickDevServer(found []proxy.DevServer) proxy.DevServer {
+	if len(found) == 1 {
+		return found[0]
+	}
+
+	fmt.Println("\nSeveral dev servers are running:")
+	for i, server := range found {
+		fmt.Printf("  %d. %s\n", i+1, server)
+	}
+	if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		fmt.Println("Using the first one (choose with -target-port or -target)")
+		return found[0]
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Which one should layrr proxy? [1-%d, default 1]: ", len(found))
+		answer, err := reader.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" || err != nil {
+			return found[0]
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(found) {
+			return found[n-1]
+		}
+	}
+}
+
 // ensureAPIKey checks for Anthropic API key and prompts if not found
 func ensureAPIKey(projectDir string) error {
 	// Try to find existing API key
@@ -152,7 +392,8 @@ func ensureAPIKey(projectDir string) error {
 	}
 
 	fmt.Println("✓ API key saved to .claude/settings.json")
-	fmt.Println("✓ Ready to use design-to-code features!\n")
+	fmt.Println("✓ Ready to use design-to-code features!")
+	fmt.Println()
 
 	return nil
 }
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thetronjohnson/layrr/internal/agent"
+	"github.com/thetronjohnson/layrr/internal/bridge"
+	"github.com/thetronjohnson/layrr/internal/claude"
+	"github.com/thetronjohnson/layrr/internal/config"
+	"github.com/thetronjohnson/layrr/internal/events"
+	"github.com/thetronjohnson/layrr/internal/history"
+	"github.com/thetronjohnson/layrr/internal/prompt"
+)
+
+// replayResult pairs a recorded job with its replay
+type replayResult struct {
+	original history.Record
+	replay   history.Record // Zero if the replay never ran
+}
+
+// runReplay implements `layrr replay`: run recorded jobs again against the current code
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	dir := fs.String("dir", ".", "Project directory")
+	agentName := fs.String("agent", agent.Claude, "Coding agent backend (claude, scripted)")
+	claudePath := fs.String("claude-path", "claude", "Path to Claude Code binary")
+	fixture := fs.String("agent-fixture", "", "Fixture file replayed by the scripted agent")
+	model := fs.String("model", "", "Model to run Claude Code with (default: Claude Code's default)")
+	render := fs.Bool("render", false, "Render prompts with the current templates instead of sending the recorded ones")
+	templates := fs.String("templates", "", "Render prompts with the templates in this directory instead of "+prompt.TemplateDir+" (implies -render)")
+	checkout := fs.String("checkout", "", "Run each job in a fresh git worktree checked out at this commit (e.g. HEAD)")
+	keep := fs.Bool("keep", false, "With -checkout: keep the worktrees of jobs that changed files")
+	quiet := fs.Bool("quiet", false, "Don't print agent events while jobs run")
+	verbose := fs.Bool("verbose", false, "Enable verbose logging")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  layrr replay [flags] <id>...  Run recorded jobs again (an ID prefix is enough)\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *agentName == agent.Scripted && *fixture == "" {
+		fmt.Fprintf(os.Stderr, "Error: -agent scripted requires -agent-fixture\n")
+		return 2
+	}
+	if *keep && *checkout == "" {
+		fmt.Fprintf(os.Stderr, "Error: -keep requires -checkout\n")
+		return 2
+	}
+
+	// Look every job up first so a typo doesn't surface halfway through a batch
+	records, err := history.Load(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var originals []history.Record
+	for _, id := range fs.Args() {
+		record, err := history.Find(records, id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", id, err)
+			return 1
+		}
+		originals = append(originals, record)
+	}
+
+	// Replays get the same tools as jobs from the browser
+	projectConfig, err := config.LoadProjectConfig(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	permissions, err := projectConfig.Permissions.Resolve()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	bus := events.New()
+	codeAgent, err := agent.New(*agentName, agent.Options{
+		ProjectDir: *dir,
+		Bus:        bus,
+		ClaudePath: *claudePath,
+		Permissions: claude.Permissions{
+			AllowedTools:    permissions.AllowedTools,
+			DisallowedTools: permissions.DisallowedTools,
+			SkipAll:         permissions.SkipAll,
+		},
+		Model:   *model,
+		Fixture: *fixture,
+		Verbose: *verbose,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting %s agent: %v\n", *agentName, err)
+		return 1
+	}
+	if !*quiet {
+		bus.Subscribe(func(event any) {
+			if msg, ok := event.(claude.StreamMsg); ok {
+				for _, line := range describeEvent(msg.Event, false) {
+					fmt.Printf("    %s\n", line)
+				}
+			}
+		})
+	}
+
+	// No TUI: the bridge only queues, runs and records
+	b := bridge.NewBridge(codeAgent, bus, *dir, *verbose)
+	if *templates != "" {
+		t := prompt.NewDir(*templates)
+		if _, err := t.Overrides(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		b.SetTemplates(t)
+	}
+	if *checkout != "" {
+		if err := b.SetCheckout(*checkout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	fmt.Printf("✓ Permission policy: %s\n", permissions)
+	if *checkout != "" {
+		fmt.Printf("✓ Replaying in fresh worktrees at %s\n", *checkout)
+	} else {
+		fmt.Println("✓ Replaying in the working tree (undo with git, or use -checkout)")
+	}
+
+	// Ctrl+C stops the running job and skips the rest
+	var stopped atomic.Bool
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	go func() {
+		<-sigChan
+		stopped.Store(true)
+		b.CancelRunning()
+	}()
+
+	results := make([]replayResult, 0, len(originals))
+	failed := false
+	for i, original := range originals {
+		if stopped.Load() {
+			results = append(results, replayResult{original: original})
+			failed = true
+			continue
+		}
+
+		fmt.Printf("\n▶ [%d/%d] Replaying %s: %s\n", i+1, len(originals), original.ID, oneLine(original.Instruction, 80))
+		job, err := b.Replay(original, *render || *templates != "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  Error: %v\n", err)
+			results = append(results, replayResult{original: original})
+			failed = true
+			continue
+		}
+		job, _ = b.Wait(job.ID)
+		bus.Sync() // Let the history and the event printer catch up
+
+		result := replayResult{original: original}
+		if after, err := history.Load(*dir); err == nil {
+			result.replay, _ = history.Find(after, job.ID)
+		}
+		if result.replay.ID == "" {
+			result.replay = history.Record{ID: job.ID, State: string(job.State), Error: job.Error, Changes: job.Changes}
+		}
+		results = append(results, result)
+
+		printReplay(job)
+		if job.State != bridge.JobDone && job.State != bridge.JobReview {
+			failed = true
+		}
+
+		// Worktrees are only kept on request; the record keeps the list of changes either way
+		if job.State == bridge.JobReview {
+			if *keep {
+				fmt.Printf("  Worktree kept at %s\n", job.Worktree.ProjectDir)
+			} else if _, err := b.RejectJob(job.ID); err != nil {
+				fmt.Fprintf(os.Stderr, "  Failed to remove worktree: %v\n", err)
+			}
+		}
+	}
+
+	fmt.Println()
+	compareReplays(results)
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// printReplay prints the outcome of one replayed job
+func printReplay(job bridge.Job) {
+	status := "✓"
+	if job.State != bridge.JobDone && job.State != bridge.JobReview {
+		status = "✗"
+	}
+	duration := time.Duration(0)
+	if job.StartedAt != nil && job.FinishedAt != nil {
+		duration = job.FinishedAt.Sub(*job.StartedAt).Round(100 * time.Millisecond)
+	}
+	fmt.Printf("  %s %s as %s in %s\n", status, job.State, job.ID, duration)
+	if job.Error != "" {
+		fmt.Printf("  Error: %s\n", job.Error)
+	}
+	for _, c := range job.Changes {
+		fmt.Printf("    %s %s\n", changeMarker(c.Kind), c.Path)
+	}
+}
+
+// compareReplays prints each recorded job next to its replay
+func compareReplays(results []replayResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tSTATE\tTIME\tCOST\tFILES\tREPLAY\tSTATE\tTIME\tCOST\tFILES")
+	for _, r := range results {
+		replay := []any{"-", "skipped", "-", "-", "-"}
+		if r.replay.ID != "" {
+			replay = []any{
+				r.replay.ID,
+				r.replay.State,
+				r.replay.Duration().Round(time.Second),
+				formatCost(r.replay.CostUSD),
+				len(r.replay.Changes),
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%v\t%v\t%v\t%v\t%v\n",
+			append([]any{
+				r.original.ID,
+				r.original.State,
+				r.original.Duration().Round(time.Second),
+				formatCost(r.original.CostUSD),
+				len(r.original.Changes),
+			}, replay...)...,
+		)
+	}
+	w.Flush()
+}
@@ -3,6 +3,7 @@ module github.com/thetronjohnson/layrr
 go 1.24.4
 
 require (
+	github.com/andybalholm/brotli v1.2.6
 	github.com/charmbracelet/bubbletea v1.3.10
 	github.com/charmbracelet/lipgloss v1.1.0
 	github.com/fsnotify/fsnotify v1.9.0
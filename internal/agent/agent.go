@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/thetronjohnson/layrr/internal/claude"
+	"github.com/thetronjohnson/layrr/internal/events"
+)
+
+// CodeAgent is a coding-agent backend that applies browser instructions to the project.
+//
+// Agents report progress by publishing claude.StreamMsg events on the bus they were created
+// with, followed by exactly one claude.FinishedMsg per SendMessage call, and claude.SessionMsg
+// whenever the session changes. Cancelling ctx stops the run with ErrCancelled.
+type CodeAgent interface {
+	// Name identifies the backend in logs and the UI
+	Name() string
+
+	// SendMessage runs one instruction in dir (the project directory if empty) and
+	// returns the files edited during the run, relative to dir
+	SendMessage(ctx context.Context, dir, message string) ([]string, error)
+
+	// SessionID returns the session resumed by follow-up instructions (empty if none)
+	SessionID() string
+
+	// ResetSession forgets the current session so the next instruction starts fresh
+	ResetSession()
+}
+
+// ErrCancelled is returned by SendMessage when the run was cancelled through its context
+var ErrCancelled = claude.ErrCancelled
+
+// Agent backend names accepted by New
+const (
+	Claude   = "claude"
+	Scripted = "scripted"
+)
+
+// Options configures the agent created by New
+type Options struct {
+	ProjectDir  string
+	Bus         *events.Bus        // Receives the agent's progress
+	ClaudePath  string             // Path to the claude binary (claude agent)
+	Permissions claude.Permissions // Tool permissions (claude agent)
+	Model       string             // Model to run with, empty for the default (claude agent)
+	Fixture     string             // Path to the fixture file (scripted agent)
+	Verbose     bool
+}
+
+// New creates the agent backend with the given name
+func New(name string, opts Options) (CodeAgent, error) {
+	switch name {
+	case Claude, "":
+		m, err := claude.NewManager(opts.ProjectDir, opts.ClaudePath, opts.Permissions, opts.Bus, opts.Verbose)
+		if err != nil {
+			return nil, err
+		}
+		m.SetModel(opts.Model)
+		return m, nil
+	case Scripted:
+		return NewScriptedAgent(opts.ProjectDir, opts.Fixture, opts.Bus, opts.Verbose)
+	default:
+		return nil, fmt.Errorf("unknown agent %q (expected %q or %q)", name, Claude, Scripted)
+	}
+}
+
+var _ CodeAgent = (*claude.Manager)(nil)
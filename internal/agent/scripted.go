@@ -0,0 +1,360 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thetronjohnson/layrr/internal/claude"
+	"github.com/thetronjohnson/layrr/internal/events"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+)
+
+// Fixture is a script replayed by ScriptedAgent.
+//
+// Example:
+//
+//	{
+//	  "sessionId": "demo",
+//	  "runs": [
+//	    {
+//	      "match": "button",
+//	      "steps": [
+//	        {"delay": 300, "event": {"type": "assistant", "message": {"content": [{"type": "text", "text": "Making it red"}]}}},
+//	        {"delay": 500, "edit": {"file": "src/App.jsx", "find": "bg-blue-500", "replace": "bg-red-500"}}
+//	      ]
+//	    }
+//	  ]
+//	}
+type Fixture struct {
+	SessionID string       `json:"sessionId,omitempty"` // Session reported to the UI (random if empty)
+	Runs      []FixtureRun `json:"runs"`
+}
+
+// FixtureRun is the script for one instruction
+type FixtureRun struct {
+	Match string        `json:"match,omitempty"` // Case-insensitive substring of the instruction; empty = fallback
+	Steps []FixtureStep `json:"steps"`
+}
+
+// FixtureStep is a single scripted action. Delay is applied before Event, Edit or Error.
+type FixtureStep struct {
+	Delay int             `json:"delay,omitempty"` // Milliseconds to wait before the step
+	Event json.RawMessage `json:"event,omitempty"` // Raw stream-json event, as Claude Code prints it
+	Edit  *FixtureEdit    `json:"edit,omitempty"`  // File edit applied to the project
+	Error string          `json:"error,omitempty"` // Fail the run with this message
+}
+
+// FixtureEdit replaces text in a project file, or writes the whole file when Content is set
+type FixtureEdit struct {
+	File    string  `json:"file"` // Relative to the project directory
+	Find    string  `json:"find,omitempty"`
+	Replace string  `json:"replace,omitempty"`
+	Content *string `json:"content,omitempty"`
+}
+
+// ScriptedAgent replays edits and stream events from a fixture file instead of running
+// a real coding agent, so the browser→proxy→bridge→agent loop can be exercised offline
+type ScriptedAgent struct {
+	projectDir string
+	fixture    Fixture
+	verbose    bool
+	bus        *events.Bus
+	mu         sync.Mutex // Serializes runs like claude.Manager
+
+	stateMu   sync.Mutex
+	sessionID string
+	next      int // Index of the next fallback run
+}
+
+// NewScriptedAgent loads a fixture file and creates a scripted agent that publishes on bus
+func NewScriptedAgent(projectDir, fixturePath string, bus *events.Bus, verbose bool) (*ScriptedAgent, error) {
+	if fixturePath == "" {
+		return nil, fmt.Errorf("scripted agent requires a fixture file (-agent-fixture)")
+	}
+
+	data, err := os.ReadFile(fixturePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", fixturePath, err)
+	}
+	if len(fixture.Runs) == 0 {
+		return nil, fmt.Errorf("fixture %s has no runs", fixturePath)
+	}
+
+	// Validate scripted events up front so demos fail fast
+	for i, run := range fixture.Runs {
+		for j, step := range run.Steps {
+			if len(step.Event) == 0 {
+				continue
+			}
+			if _, err := claude.ParseEvent(step.Event); err != nil {
+				return nil, fmt.Errorf("fixture run %d step %d: %w", i+1, j+1, err)
+			}
+		}
+	}
+
+	return &ScriptedAgent{
+		projectDir: projectDir,
+		fixture:    fixture,
+		bus:        bus,
+		verbose:    verbose,
+	}, nil
+}
+
+// Name identifies the backend
+func (a *ScriptedAgent) Name() string {
+	return Scripted
+}
+
+// SessionID returns the current scripted session ID (empty if no session yet)
+func (a *ScriptedAgent) SessionID() string {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	return a.sessionID
+}
+
+// ResetSession forgets the current session so the next instruction starts fresh
+func (a *ScriptedAgent) ResetSession() {
+	a.stateMu.Lock()
+	a.sessionID = ""
+	a.stateMu.Unlock()
+
+	a.bus.Publish(claude.SessionMsg{})
+}
+
+// SendMessage replays the fixture run matching the message in dir (the project directory if empty)
+func (a *ScriptedAgent) SendMessage(ctx context.Context, dir, message string) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if dir == "" {
+		dir = a.projectDir
+	}
+
+	if ctx.Err() != nil {
+		return nil, ErrCancelled
+	}
+
+	sessionID := a.startSession()
+	run := a.pickRun(message)
+
+	a.emit(claude.Event{
+		Type:      claude.EventSystem,
+		Subtype:   "init",
+		SessionID: sessionID,
+		Model:     "scripted",
+		CWD:       dir,
+	})
+
+	edited := make(map[string]bool)
+	started := time.Now()
+	runErr := a.replay(ctx, dir, run, edited)
+
+	files := make([]string, 0, len(edited))
+	for file := range edited {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	if runErr == nil {
+		a.emit(claude.Event{
+			Type:       claude.EventResult,
+			Subtype:    "success",
+			SessionID:  sessionID,
+			NumTurns:   len(run.Steps),
+			DurationMS: time.Since(started).Milliseconds(),
+			Usage:      &claude.Usage{},
+		})
+	}
+
+	a.bus.Publish(claude.FinishedMsg{Files: files, Err: runErr})
+	return files, runErr
+}
+
+// replay executes the steps of a run, stopping early on cancel or error
+func (a *ScriptedAgent) replay(ctx context.Context, dir string, run FixtureRun, edited map[string]bool) error {
+	for i, step := range run.Steps {
+		if step.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ErrCancelled
+			case <-time.After(time.Duration(step.Delay) * time.Millisecond):
+			}
+		}
+		if ctx.Err() != nil {
+			return ErrCancelled
+		}
+
+		if len(step.Event) > 0 {
+			event, err := claude.ParseEvent(step.Event)
+			if err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+			for _, file := range event.EditedFiles() {
+				edited[snapshot.RelPath(dir, file)] = true
+			}
+			a.emit(event)
+		}
+
+		if step.Edit != nil {
+			path, err := applyEdit(dir, *step.Edit)
+			if err != nil {
+				a.emit(toolResult(err.Error(), true))
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+			edited[filepath.Clean(step.Edit.File)] = true
+			a.emit(toolUse("Edit", path))
+			a.emit(toolResult("The file "+path+" has been updated.", false))
+		}
+
+		if step.Error != "" {
+			return fmt.Errorf("scripted failure: %s", step.Error)
+		}
+	}
+	return nil
+}
+
+// applyEdit modifies a file under dir and returns its absolute path
+func applyEdit(dir string, edit FixtureEdit) (string, error) {
+	projectDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve project directory: %w", err)
+	}
+
+	path := filepath.Join(projectDir, edit.File)
+	if rel, err := filepath.Rel(projectDir, path); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("edit target %s is outside the project", edit.File)
+	}
+
+	if edit.Content != nil {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", fmt.Errorf("failed to create directory for %s: %w", edit.File, err)
+		}
+		if err := os.WriteFile(path, []byte(*edit.Content), 0644); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", edit.File, err)
+		}
+		return path, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", edit.File, err)
+	}
+	if !strings.Contains(string(data), edit.Find) {
+		return "", fmt.Errorf("text to replace not found in %s", edit.File)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", edit.File, err)
+	}
+	updated := strings.Replace(string(data), edit.Find, edit.Replace, 1)
+	if err := os.WriteFile(path, []byte(updated), info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", edit.File, err)
+	}
+	return path, nil
+}
+
+// pickRun returns the first run whose match occurs in the message, or the next fallback run
+func (a *ScriptedAgent) pickRun(message string) FixtureRun {
+	lower := strings.ToLower(message)
+	var fallbacks []FixtureRun
+	for _, run := range a.fixture.Runs {
+		if run.Match == "" {
+			fallbacks = append(fallbacks, run)
+			continue
+		}
+		if strings.Contains(lower, strings.ToLower(run.Match)) {
+			return run
+		}
+	}
+
+	if len(fallbacks) == 0 {
+		return FixtureRun{}
+	}
+
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	run := fallbacks[a.next%len(fallbacks)]
+	a.next++
+	return run
+}
+
+// startSession returns the current session, creating one if needed
+func (a *ScriptedAgent) startSession() string {
+	a.stateMu.Lock()
+	created := a.sessionID == ""
+	if created {
+		a.sessionID = a.fixture.SessionID
+		if a.sessionID == "" {
+			a.sessionID = newSessionID()
+		}
+	}
+	id := a.sessionID
+	a.stateMu.Unlock()
+
+	if created {
+		a.bus.Publish(claude.SessionMsg{SessionID: id})
+	}
+	return id
+}
+
+// emit publishes a stream event
+func (a *ScriptedAgent) emit(event claude.Event) {
+	if a.verbose {
+		fmt.Fprintf(os.Stderr, "[Scripted] %s event\n", event.Type)
+	}
+	a.bus.Publish(claude.StreamMsg{Event: event})
+}
+
+// toolUse builds an assistant event for a single tool call
+func toolUse(name, filePath string) claude.Event {
+	return claude.Event{
+		Type: claude.EventAssistant,
+		Message: &claude.Message{
+			Role: "assistant",
+			Content: []claude.ContentBlock{{
+				Type:  claude.BlockToolUse,
+				Name:  name,
+				Input: &claude.ToolInput{FilePath: filePath},
+			}},
+		},
+	}
+}
+
+// toolResult builds a user event carrying a tool result
+func toolResult(text string, isError bool) claude.Event {
+	return claude.Event{
+		Type: claude.EventUser,
+		Message: &claude.Message{
+			Role: "user",
+			Content: []claude.ContentBlock{{
+				Type:    claude.BlockToolResult,
+				Content: []claude.ContentBlock{{Type: claude.BlockText, Text: text}},
+				IsError: isError,
+			}},
+		},
+	}
+}
+
+// newSessionID returns a random session identifier for scripted runs
+func newSessionID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("scripted-%d", time.Now().UnixNano())
+	}
+	return "scripted-" + hex.EncodeToString(buf)
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/thetronjohnson/layrr/internal/prompt"
 )
 
 const (
@@ -187,6 +189,18 @@ type ElementInfo struct {
 	Siblings  []SiblingInfo   `json:"siblings,omitempty"`
 }
 
+// promptElement converts the element for prompt templates
+func (el ElementInfo) promptElement() prompt.Element {
+	return prompt.Element{
+		TagName:   el.TagName,
+		ID:        el.ID,
+		Classes:   el.Classes,
+		Selector:  el.Selector,
+		InnerText: el.InnerText,
+		OuterHTML: el.OuterHTML,
+	}
+}
+
 // ParentInfo represents parent element information
 type ParentInfo struct {
 	TagName   string `json:"tagName"`
@@ -228,210 +242,73 @@ type DesignTokens struct {
 
 // GeneratePreview generates DOM manipulation instructions from AI instruction
 // This is used for instant preview mode - no file modifications, just DOM changes
-func (c *Client) GeneratePreview(instruction string, elements []ElementInfo, screenshot string, designTokens *DesignTokens) ([]DOMChange, error) {
+func (c *Client) GeneratePreview(templates *prompt.Templates, instruction string, elements []ElementInfo, screenshot string, designTokens *DesignTokens) ([]DOMChange, error) {
 	if len(elements) == 0 {
 		return nil, fmt.Errorf("no elements provided")
 	}
 
-	// Build selected element info (first element - the one user clicked)
+	// Describe the selected element (the one user clicked), its surroundings and the page's tokens
 	selectedEl := elements[0]
-	selectedElDesc := selectedEl.TagName
-	if selectedEl.ID != "" {
-		selectedElDesc += fmt.Sprintf(" id='%s'", selectedEl.ID)
-	}
-	if selectedEl.Classes != "" {
-		selectedElDesc += fmt.Sprintf(" class='%s'", selectedEl.Classes)
-	}
-	if selectedEl.InnerText != "" && len(selectedEl.InnerText) < 50 {
-		selectedElDesc += fmt.Sprintf(" text='%s'", selectedEl.InnerText)
+	data := prompt.PreviewData{
+		Instruction: instruction,
+		Selected:    selectedEl.promptElement(),
+		Position:    "afterend", // default: insert after element as sibling
 	}
 
-	// Build parent context
-	var parentDesc string
 	if selectedEl.Parent != nil {
-		parentDesc = fmt.Sprintf("\n**PARENT CONTAINER:**\n")
-		parentDesc += fmt.Sprintf("Tag: %s", selectedEl.Parent.TagName)
-		if selectedEl.Parent.ID != "" {
-			parentDesc += fmt.Sprintf(", ID: %s", selectedEl.Parent.ID)
+		data.Parent = &prompt.Element{
+			TagName:   selectedEl.Parent.TagName,
+			ID:        selectedEl.Parent.ID,
+			Classes:   selectedEl.Parent.Classes,
+			Selector:  selectedEl.Parent.Selector,
+			OuterHTML: selectedEl.Parent.OuterHTML,
 		}
-		if selectedEl.Parent.Classes != "" {
-			parentDesc += fmt.Sprintf(", Classes: %s", selectedEl.Parent.Classes)
-		}
-		parentDesc += fmt.Sprintf("\nSelector: %s\n", selectedEl.Parent.Selector)
-		parentDesc += fmt.Sprintf("HTML Structure:\n%s\n", selectedEl.Parent.OuterHTML)
-	} else {
-		parentDesc = "\n**PARENT CONTAINER:** (none)\n"
-	}
-
-	// Build sibling context for pattern matching
-	var siblingsDesc string
-	if len(selectedEl.Siblings) > 0 {
-		siblingsDesc = fmt.Sprintf("\n**SIBLING ELEMENTS (COPY THESE EXACTLY):**\n")
-		siblingsDesc += "‼️ CRITICAL: When adding new elements, COPY the HTML structure below EXACTLY.\n"
-		siblingsDesc += "Only change the href, aria-label, and SVG icon. Keep ALL classes, structure, and styling identical.\n\n"
-		for i, sibling := range selectedEl.Siblings {
-			siblingsDesc += fmt.Sprintf("SIBLING #%d - %s", i+1, sibling.TagName)
-			if sibling.Classes != "" {
-				siblingsDesc += fmt.Sprintf(" class='%s'", sibling.Classes)
-			}
-			siblingsDesc += fmt.Sprintf("\n📋 TEMPLATE TO COPY:\n%s\n\n", sibling.OuterHTML)
-		}
-		siblingsDesc += "⚠️ Use the EXACT same class names, structure, and attributes from above!\n"
-	} else {
-		siblingsDesc = "\n**SIBLING ELEMENTS:** (none - this element has no siblings)\n"
+	}
+	for _, sibling := range selectedEl.Siblings {
+		data.Siblings = append(data.Siblings, prompt.Element{
+			TagName:   sibling.TagName,
+			Classes:   sibling.Classes,
+			OuterHTML: sibling.OuterHTML,
+		})
 	}
 
 	// Smart position detection
-	// Determine recommended position based on element type
-	recommendedPosition := "afterend" // default: insert after element as sibling
-	var positionGuidance string
-
 	// Check if the clicked element is likely a container
-	isContainer := false
 	containerTags := map[string]bool{
 		"DIV": true, "SECTION": true, "ARTICLE": true, "MAIN": true,
 		"HEADER": true, "FOOTER": true, "NAV": true, "ASIDE": true,
 		"UL": true, "OL": true, "FORM": true,
 	}
 	if containerTags[selectedEl.TagName] {
-		isContainer = true
-		recommendedPosition = "beforeend" // insert inside container as last child
-	}
-
-	if isContainer {
-		positionGuidance = fmt.Sprintf(`
-**POSITION GUIDANCE:**
-The selected element is a CONTAINER (%s). When adding new elements:
-- Use position "beforeend" to insert INSIDE the container as the last child
-- This is the recommended approach for containers
-- Only use "afterend" if the user explicitly wants the element AFTER/OUTSIDE the container`, selectedEl.TagName)
-	} else {
-		positionGuidance = fmt.Sprintf(`
-**POSITION GUIDANCE:**
-The selected element is a CHILD ELEMENT (%s). When adding new elements:
-- Use position "afterend" to insert as a sibling AFTER this element
-- Use position "beforebegin" to insert as a sibling BEFORE this element
-- Match the sibling patterns shown above`, selectedEl.TagName)
-	}
-
-	// Build additional context elements (if any)
-	var additionalElementsDesc string
-	if len(elements) > 1 {
-		for i := 1; i < len(elements); i++ {
-			el := elements[i]
-			additionalElementsDesc += fmt.Sprintf("%d. %s (selector: %s)\n", i+1, el.TagName, el.Selector)
-			if el.ID != "" {
-				additionalElementsDesc += fmt.Sprintf("   ID: %s\n", el.ID)
-			}
-			if el.Classes != "" {
-				additionalElementsDesc += fmt.Sprintf("   Classes: %s\n", el.Classes)
-			}
-			if el.InnerText != "" && len(el.InnerText) < 100 {
-				additionalElementsDesc += fmt.Sprintf("   Text: %s\n", el.InnerText)
-			}
-		}
-	} else {
-		additionalElementsDesc = "(none)\n"
+		data.Container = true
+		data.Position = "beforeend" // insert inside container as last child
 	}
 
-	// Build design tokens context string
-	var designTokensDesc string
-	if designTokens != nil {
-		designTokensDesc = "\nDesign System (CSS Custom Properties):\n\n"
-
-		if len(designTokens.Colors) > 0 {
-			designTokensDesc += "Colors:\n"
-			for name, value := range designTokens.Colors {
-				designTokensDesc += fmt.Sprintf("  %s: %s\n", name, value)
-			}
-			designTokensDesc += "\n"
-		}
-
-		if len(designTokens.Spacing) > 0 {
-			designTokensDesc += "Spacing:\n"
-			for name, value := range designTokens.Spacing {
-				designTokensDesc += fmt.Sprintf("  %s: %s\n", name, value)
-			}
-			designTokensDesc += "\n"
-		}
+	// Additional context elements (if any)
+	for _, el := range elements[1:] {
+		data.Others = append(data.Others, el.promptElement())
+	}
 
-		if len(designTokens.Typography) > 0 {
-			designTokensDesc += "Typography:\n"
-			for name, value := range designTokens.Typography {
-				designTokensDesc += fmt.Sprintf("  %s: %s\n", name, value)
-			}
-			designTokensDesc += "\n"
+	if designTokens != nil {
+		data.Tokens = &prompt.Tokens{
+			Colors:     designTokens.Colors,
+			Spacing:    designTokens.Spacing,
+			Typography: designTokens.Typography,
+			Other:      designTokens.Other,
 		}
 	}
 
 	// Build prompt requesting structured JSON
-	prompt := fmt.Sprintf(`LAYRR - AI PREVIEW MODE
-
-User instruction: "%s"
-
-**SELECTED ELEMENT (the user clicked on this):**
-%s
-**EXACT SELECTOR TO USE IN ALL CHANGES: %s**
-%s
-%s
-%s
-Additional context elements:
-%s
-%s
-**CRITICAL: This is PREVIEW MODE. Return ONLY a JSON object. Do NOT write explanations. Do NOT use markdown code blocks.**
-
-Your task:
-1. Analyze the user's instruction: "%s"
-2. **Apply changes to the SELECTED ELEMENT above using the EXACT SELECTOR shown**
-3. Return a JSON object with this EXACT structure:
-
-{
-  "changes": [
-    {"selector": "%s", "action": "ACTION_TYPE", "value": "VALUE"},
-    {"selector": "%s", "action": "setStyle", "property": "CSS_PROPERTY", "value": "CSS_VALUE"},
-    {"selector": "%s", "action": "insertAdjacentHTML", "position": "%s", "value": "<button class='btn-primary'>New Button</button>"}
-  ]
-}
-
-Supported actions:
-- "addClass": Add CSS classes (value = space-separated class names)
-- "removeClass": Remove CSS classes (value = space-separated class names)
-- "setText": Change text content (value = new text)
-- "setHTML": Change HTML content (value = new HTML)
-- "setStyle": Change inline style (property = CSS property name, value = CSS value)
-- "setAttribute": Set attribute (attribute = attr name, value = attr value)
-- "remove": Remove/delete the element from DOM (no value needed)
-- "hide": Hide element by setting display:none (no value needed)
-- "insertAdjacentHTML": Insert HTML adjacent to element (position = "beforebegin"|"afterbegin"|"beforeend"|"afterend", value = HTML string)
-
-Rules:
-1. **CRITICAL: ALL changes MUST use this EXACT selector: %s - DO NOT modify or shorten it**
-2. Return ONLY the JSON object - no explanations before or after
-3. Do NOT wrap in markdown code blocks (no triple-backticks or json keyword)
-4. **‼️ FOR ADDING ELEMENTS: COPY sibling HTML EXACTLY as a template:**
-   - Take one sibling's HTML from "TEMPLATE TO COPY" above
-   - Keep ALL class names identical (do not invent new classes)
-   - Keep the exact same HTML structure (same tags, same nesting)
-   - Only change: href URL, aria-label text, and the SVG path/icon
-   - Example: If sibling is <a class="foo bar"><svg class="baz">...</svg></a>
-   - Your new element MUST be <a class="foo bar"><svg class="baz">...new icon...</svg></a>
-5. When adding new elements with insertAdjacentHTML:
-    - Use the EXACT selector above: %s
-    - Copy a sibling's HTML structure as your template
-    - Follow the position guidance above (recommended position: "%s")
-    - For containers: use "beforeend" to insert inside as last child
-    - For child elements: use "afterend" or "beforebegin" to insert as sibling
-6. **IMPORTANT: Use the design system tokens for colors, spacing, and typography**
-7. When setting styles, prefer CSS custom properties (var(--token-name)) over hardcoded values
-8. Prefer CSS classes over inline styles when possible
-
-Return the JSON now:`, instruction, selectedElDesc, selectedEl.Selector, parentDesc, siblingsDesc, positionGuidance, additionalElementsDesc, designTokensDesc, instruction, selectedEl.Selector, selectedEl.Selector, selectedEl.Selector, recommendedPosition, selectedEl.Selector, selectedEl.Selector, recommendedPosition)
+	promptText, err := templates.Render(prompt.Preview, data)
+	if err != nil {
+		return nil, err
+	}
 
 	// Build content array (text + optional image)
 	contentArray := []Content{
 		{
 			Type: "text",
-			Text: prompt,
+			Text: promptText,
 		},
 	}
 
@@ -1,25 +1,25 @@
 package bridge
 
 import (
-	"fmt"
-	"os"
-	"strings"
-	"time"
-
-	tea "github.com/charmbracelet/bubbletea"
-	"github.com/thetronjohnson/layrr/internal/claude"
-	"github.com/thetronjohnson/layrr/internal/status"
-	"github.com/thetronjohnson/layrr/internal/tui"
+	"sync"
+
+	"github.com/thetronjohnson/layrr/internal/agent"
+	"github.com/thetronjohnson/layrr/internal/checkpoint"
+	"github.com/thetronjohnson/layrr/internal/events"
+	"github.com/thetronjohnson/layrr/internal/history"
+	"github.com/thetronjohnson/layrr/internal/prompt"
+	"github.com/thetronjohnson/layrr/internal/sourcemap"
 )
 
 // ElementInfo represents information about a selected HTML element
 type ElementInfo struct {
-	TagName    string `json:"tagName"`
-	ID         string `json:"id"`
-	Classes    string `json:"classes"`
-	Selector   string `json:"selector"`
-	InnerText  string `json:"innerText"`
-	OuterHTML  string `json:"outerHTML"`
+	TagName   string              `json:"tagName"`
+	ID        string              `json:"id"`
+	Classes   string              `json:"classes"`
+	Selector  string              `json:"selector"`
+	InnerText string              `json:"innerText"`
+	OuterHTML string              `json:"outerHTML"`
+	Source    *sourcemap.Location `json:"source,omitempty"` // Framework dev metadata, if the page exposes it
 }
 
 // AreaInfo represents information about a selected area containing multiple elements
@@ -37,127 +37,128 @@ type Message struct {
 	ID          int      `json:"id"`
 	Area        AreaInfo `json:"area"`
 	Instruction string   `json:"instruction"`
-	Screenshot  string   `json:"screenshot"` // Base64 encoded image
+	Screenshot  string   `json:"screenshot"`            // Base64 encoded image
+	Screenshots []string `json:"screenshots,omitempty"` // Further images, referenced as [screenshot N] after Screenshot
+	PageURL     string   `json:"pageUrl,omitempty"`     // Page the user was on
+
+	// Structured requests rendered with their own template in place of Instruction
+	Design *prompt.DesignData      `json:"design,omitempty"`
+	Edits  *prompt.VisualEditsData `json:"edits,omitempty"`
 }
 
-// Bridge coordinates messages between the browser and Claude Code
+// Bridge coordinates messages between the browser and the coding agent.
+// Instructions are queued as jobs and run one at a time; progress is published on the bus.
 type Bridge struct {
-	claudeManager *claude.Manager
-	verbose       bool
-	display       *status.Display
-	program       *tea.Program
+	agent      agent.CodeAgent
+	bus        *events.Bus
+	projectDir string
+	verbose    bool
+	repo       *checkpoint.Repo // Git checkpoints for undo/redo (nil outside a git repo)
+	runMu      sync.Mutex       // Held while a job runs or a job is undone/redone/accepted
+	sources    *sourcemap.Resolver
+	prompts    *prompt.Templates
+	history    *history.Log // Records finished jobs in .layrr/history.jsonl
+
+	worktreeMode bool   // Run jobs in temporary git worktrees for review
+	worktreeBase string // Commit worktrees are checked out at (empty = the live working tree)
+
+	record *history.Record // History record of the running job (only used by the recorder)
+
+	mu       sync.Mutex
+	jobs     map[string]*Job // All known jobs by ID
+	queue    []*Job          // Jobs waiting to run, in order
+	current  *Job            // Job currently running (nil when idle)
+	finished []*Job          // Recently finished jobs, oldest first
+	wake     chan struct{}
 }
 
-// NewBridge creates a new bridge
-func NewBridge(claudeManager *claude.Manager, verbose bool, display *status.Display) *Bridge {
-	return &Bridge{
-		claudeManager: claudeManager,
-		verbose:       verbose,
-		display:       display,
+// NewBridge creates a new bridge that publishes on bus (which codeAgent should publish on too)
+// and starts its job worker
+func NewBridge(codeAgent agent.CodeAgent, bus *events.Bus, projectDir string, verbose bool) *Bridge {
+	b := &Bridge{
+		agent:      codeAgent,
+		bus:        bus,
+		projectDir: projectDir,
+		repo:       openRepo(projectDir, verbose),
+		sources:    sourcemap.NewResolver(projectDir),
+		prompts:    prompt.New(projectDir),
+		history:    history.Open(projectDir),
+		verbose:    verbose,
+		jobs:       make(map[string]*Job),
+		wake:       make(chan struct{}, 1),
 	}
+	bus.Subscribe(b.recordEvent)
+	go b.worker()
+	return b
 }
 
-// SetProgram sets the TUI program for sending messages
-func (b *Bridge) SetProgram(p *tea.Program) {
-	b.program = p
+// SetTemplates replaces the prompt templates (the project's .layrr/templates by default)
+func (b *Bridge) SetTemplates(t *prompt.Templates) {
+	b.prompts = t
 }
 
-// HandleMessage processes a message from the browser and sends it to Claude Code
-func (b *Bridge) HandleMessage(msg Message) error {
-	// Format the message for Claude Code
-	formattedMsg := b.formatMessage(msg)
-
-	// Create completion channel for synchronization
-	completionCh := make(chan struct{})
-
-	// Notify TUI that an instruction was received
-	if b.program != nil {
-		areaInfo := fmt.Sprintf("%dx%d px · %d elements",
-			msg.Area.Width, msg.Area.Height, msg.Area.ElementCount)
-		b.program.Send(tui.InstructionMsg{
-			Instruction:   msg.Instruction,
-			AreaInfo:      areaInfo,
-			CompletionAck: completionCh,
-		})
-	}
+// ResetSession starts a new agent session for subsequent instructions
+func (b *Bridge) ResetSession() {
+	b.agent.ResetSession()
+}
 
-	// Send to Claude Code (this blocks until Claude finishes)
-	if err := b.claudeManager.SendMessage(formattedMsg); err != nil {
-		return fmt.Errorf("failed to send message to Claude Code: %w", err)
+// maxPromptElements limits how many elements are described to keep the message size reasonable
+const maxPromptElements = 20
+
+// formatMessage renders a browser message with the instruction template.
+// screenshots are the saved image files the agent should look at.
+func (b *Bridge) formatMessage(msg Message, screenshots []string) (string, error) {
+	instruction := msg.Instruction
+	var err error
+	switch {
+	case msg.Design != nil:
+		instruction, err = b.prompts.Render(prompt.Design, msg.Design)
+	case msg.Edits != nil:
+		instruction, err = b.prompts.Render(prompt.VisualEdits, msg.Edits)
 	}
-
-	// Wait for TUI to finish processing the completion event (with timeout)
-	if b.program != nil {
-		select {
-		case <-completionCh:
-			// TUI has processed the completion event
-		case <-time.After(5 * time.Second):
-			// Timeout - continue anyway to prevent hanging
-			if b.verbose {
-				fmt.Fprintf(os.Stderr, "[Bridge] Timeout waiting for TUI completion acknowledgment\n")
-			}
-		}
+	if err != nil {
+		return "", err
 	}
 
-	return nil
-}
-
-// formatMessage formats a browser message for Claude Code
-func (b *Bridge) formatMessage(msg Message) string {
-	// Format message for Claude Code CLI
-	// Single-line format keeps the message compact and readable
-
-	var parts []string
-
-	// Start with the instruction
-	parts = append(parts, msg.Instruction)
-
-	// Add area context inline
-	parts = append(parts, fmt.Sprintf("(Selected %d elements in %dx%d area:",
-		msg.Area.ElementCount, msg.Area.Width, msg.Area.Height))
+	data := prompt.InstructionData{
+		Instruction: instruction,
+		Area: prompt.Area{
+			X:            msg.Area.X,
+			Y:            msg.Area.Y,
+			Width:        msg.Area.Width,
+			Height:       msg.Area.Height,
+			ElementCount: msg.Area.ElementCount,
+		},
+		Screenshots: screenshots,
+		HasRules:    msg.Design != nil || msg.Edits != nil,
+	}
 
-	// Include ALL elements with full details (not just first 3)
 	for i, el := range msg.Area.Elements {
-		// Build element descriptor with full information
-		var elementDesc strings.Builder
-		elementDesc.WriteString("[")
-
-		// Selector (e.g., "div#card-1.card.featured")
-		elementDesc.WriteString(el.Selector)
-
-		// Inner text (first 50 chars to keep message manageable)
-		if el.InnerText != "" {
-			innerText := strings.ReplaceAll(el.InnerText, "\n", " ")
-			innerText = strings.TrimSpace(innerText)
-			if len(innerText) > 50 {
-				innerText = innerText[:50] + "..."
-			}
-			elementDesc.WriteString(fmt.Sprintf(" text:\"%s\"", innerText))
+		if i >= maxPromptElements {
+			data.MoreElements = len(msg.Area.Elements) - maxPromptElements
+			break
 		}
 
-		// Compact HTML (first 100 chars)
-		if el.OuterHTML != "" {
-			html := strings.ReplaceAll(el.OuterHTML, "\n", " ")
-			html = strings.TrimSpace(html)
-			if len(html) > 100 {
-				html = html[:100] + "..."
-			}
-			elementDesc.WriteString(fmt.Sprintf(" html:%s", html))
+		element := prompt.Element{
+			TagName:   el.TagName,
+			ID:        el.ID,
+			Classes:   el.Classes,
+			Selector:  el.Selector,
+			InnerText: el.InnerText,
+			OuterHTML: el.OuterHTML,
 		}
 
-		elementDesc.WriteString("]")
-
-		parts = append(parts, elementDesc.String())
-
-		// Limit total elements to 20 to keep message size reasonable
-		if i >= 19 && len(msg.Area.Elements) > 20 {
-			parts = append(parts, fmt.Sprintf("[+%d more elements]", len(msg.Area.Elements)-20))
-			break
+		// A source location (e.g., "src/components/Card.tsx:12:5 (<Card>)") saves the agent a search
+		if el.Source != nil {
+			if loc, ok := b.sources.Resolve(*el.Source); ok {
+				element.Source = loc.String()
+			} else {
+				element.Component = loc.Component
+			}
 		}
-	}
 
-	parts = append(parts, ")")
+		data.Elements = append(data.Elements, element)
+	}
 
-	// Join all parts with spaces - single line, no newlines
-	return strings.Join(parts, " ")
+	return b.prompts.Render(prompt.Instruction, data)
 }
@@ -0,0 +1,233 @@
+package bridge
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thetronjohnson/layrr/internal/agent"
+	"github.com/thetronjohnson/layrr/internal/events"
+	"github.com/thetronjohnson/layrr/internal/history"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+)
+
+// testBridge runs jobs through a scripted agent in a project directory and remembers the
+// states each job went through
+type testBridge struct {
+	*Bridge
+	bus *events.Bus
+	dir string
+
+	mu     sync.Mutex
+	states map[string][]JobState
+}
+
+// newTestBridge creates a project with src/App.jsx and a bridge that replays fixture
+func newTestBridge(t *testing.T, dir string, fixture agent.Fixture) *testBridge {
+	t.Helper()
+
+	writeFile(t, filepath.Join(dir, "src", "App.jsx"), `<button className="bg-blue-500">Save</button>`+"\n")
+
+	data, err := json.Marshal(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixturePath := filepath.Join(t.TempDir(), "fixture.json")
+	writeFile(t, fixturePath, string(data))
+
+	bus := events.New()
+	scripted, err := agent.NewScriptedAgent(dir, fixturePath, bus, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb := &testBridge{bus: bus, dir: dir, states: make(map[string][]JobState)}
+	bus.Subscribe(func(event any) {
+		if msg, ok := event.(JobMsg); ok {
+			tb.mu.Lock()
+			tb.states[msg.Job.ID] = append(tb.states[msg.Job.ID], msg.Job.State)
+			tb.mu.Unlock()
+		}
+	})
+	tb.Bridge = NewBridge(scripted, bus, dir, false)
+	return tb
+}
+
+// run submits an instruction and waits until the job finished and the bus caught up
+func (tb *testBridge) run(t *testing.T, instruction string) Job {
+	t.Helper()
+
+	job, err := tb.Wait(tb.Submit(Message{ID: 1, Instruction: instruction}).ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb.bus.Sync()
+	return job
+}
+
+// jobStates returns the states published for a job, in order
+func (tb *testBridge) jobStates(id string) []JobState {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return slices.Clone(tb.states[id])
+}
+
+// record loads the history record of a job
+func (tb *testBridge) record(t *testing.T, id string) history.Record {
+	t.Helper()
+
+	records, err := history.Load(tb.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := history.Find(records, id)
+	if err != nil {
+		t.Fatalf("job %s isn't in the history: %v", id, err)
+	}
+	return r
+}
+
+var redButton = agent.Fixture{
+	SessionID: "test",
+	Runs: []agent.FixtureRun{
+		{
+			Match: "red",
+			Steps: []agent.FixtureStep{
+				{Event: json.RawMessage(`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Making it red"}]}}`)},
+				{Edit: &agent.FixtureEdit{File: "src/App.jsx", Find: "bg-blue-500", Replace: "bg-red-500"}},
+			},
+		},
+		{
+			Match: "break",
+			Steps: []agent.FixtureStep{
+				{Edit: &agent.FixtureEdit{File: "src/App.jsx", Find: "bg-blue-500", Replace: "bg-green-500"}},
+				{Error: "out of ideas"},
+			},
+		},
+	},
+}
+
+func TestJobRunsThroughAgent(t *testing.T) {
+	tb := newTestBridge(t, t.TempDir(), redButton)
+
+	job := tb.run(t, "Make the button red")
+
+	if job.State != JobDone {
+		t.Fatalf("state = %s (%s), want done", job.State, job.Error)
+	}
+	if got, want := tb.jobStates(job.ID), []JobState{JobQueued, JobRunning, JobDone}; !slices.Equal(got, want) {
+		t.Errorf("states = %v, want %v", got, want)
+	}
+	want := []snapshot.Change{{Path: "src/App.jsx", Kind: snapshot.Modified}}
+	if !slices.Equal(job.Changes, want) {
+		t.Errorf("changes = %v, want %v", job.Changes, want)
+	}
+	if data := readFile(t, filepath.Join(tb.dir, "src", "App.jsx")); !strings.Contains(data, "bg-red-500") {
+		t.Errorf("App.jsx wasn't edited: %s", data)
+	}
+
+	r := tb.record(t, job.ID)
+	if r.State != string(JobDone) || r.Agent != agent.Scripted || r.SessionID != "test" {
+		t.Errorf("record state, agent, session = %s, %s, %s", r.State, r.Agent, r.SessionID)
+	}
+	if !strings.Contains(r.Prompt, "Make the button red") {
+		t.Errorf("record prompt doesn't contain the instruction:\n%s", r.Prompt)
+	}
+	if !slices.Equal(r.Changes, want) {
+		t.Errorf("record changes = %v, want %v", r.Changes, want)
+	}
+	if len(r.Events) == 0 {
+		t.Error("record has no agent events")
+	}
+}
+
+func TestJobFails(t *testing.T) {
+	tb := newTestBridge(t, t.TempDir(), redButton)
+
+	job := tb.run(t, "break everything")
+
+	if job.State != JobFailed || !strings.Contains(job.Error, "out of ideas") {
+		t.Fatalf("state = %s (%q), want failed", job.State, job.Error)
+	}
+	if got, want := tb.jobStates(job.ID), []JobState{JobQueued, JobRunning, JobFailed}; !slices.Equal(got, want) {
+		t.Errorf("states = %v, want %v", got, want)
+	}
+	// Edits made before the failure are still reported
+	if !slices.Equal(job.Files, []string{"src/App.jsx"}) {
+		t.Errorf("files = %v", job.Files)
+	}
+
+	r := tb.record(t, job.ID)
+	if r.State != string(JobFailed) || r.Error != job.Error {
+		t.Errorf("record state, error = %s, %q", r.State, r.Error)
+	}
+}
+
+func TestReviewUpdatesHistory(t *testing.T) {
+	dir := gitProject(t)
+	tb := newTestBridge(t, dir, redButton)
+	if err := tb.SetWorktreeMode(true); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tb.CleanupWorktrees)
+
+	for _, accept := range []bool{false, true} { // Rejecting first leaves the button blue for the next run
+		job := tb.run(t, "Make the button red")
+		if job.State != JobReview || job.Worktree == nil {
+			t.Fatalf("state = %s (%s), want review", job.State, job.Error)
+		}
+		if data := readFile(t, filepath.Join(dir, "src", "App.jsx")); strings.Contains(data, "bg-red-500") {
+			t.Fatal("a job in review changed the working tree")
+		}
+		if r := tb.record(t, job.ID); r.State != string(JobReview) || !r.Worktree {
+			t.Fatalf("record state = %s, worktree = %v", r.State, r.Worktree)
+		}
+
+		var err error
+		want := JobDone
+		if accept {
+			job, err = tb.AcceptJob(job.ID)
+		} else {
+			job, err = tb.RejectJob(job.ID)
+			want = JobRejected
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		tb.bus.Sync()
+
+		if job.State != want {
+			t.Errorf("state after review = %s, want %s", job.State, want)
+		}
+		r := tb.record(t, job.ID)
+		if r.State != string(want) || r.ReviewedAt == nil {
+			t.Errorf("record state after review = %s (reviewed at %v), want %s", r.State, r.ReviewedAt, want)
+		}
+		if got := readFile(t, filepath.Join(dir, "src", "App.jsx")); strings.Contains(got, "bg-red-500") != accept {
+			t.Errorf("App.jsx after review (accepted %v): %s", accept, got)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
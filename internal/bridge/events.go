@@ -0,0 +1,52 @@
+package bridge
+
+import "github.com/thetronjohnson/layrr/internal/snapshot"
+
+// Events published by the bridge on its bus
+
+// JobMsg is published with a snapshot whenever a job changes
+type JobMsg struct {
+	Job Job
+}
+
+// QueueMsg is published when the job queue changes
+type QueueMsg struct {
+	Queued []string // Waiting instructions, in run order
+}
+
+// InstructionMsg is published when a job's instruction is sent to the agent
+type InstructionMsg struct {
+	JobID       string
+	Instruction string
+	AreaInfo    string
+}
+
+// PromptMsg is published with the exact prompt a job sends to the agent
+type PromptMsg struct {
+	JobID       string
+	Prompt      string
+	Screenshots []string // Copies kept with the history, relative to the project directory
+}
+
+// ChangesMsg is published after a run with the files it created, modified or deleted
+type ChangesMsg struct {
+	JobID   string
+	Changes []snapshot.Change
+}
+
+// UndoMsg is published when a job's changes are undone or redone
+type UndoMsg struct {
+	JobID       string
+	Instruction string
+	Redo        bool
+	Files       []string // Files restored or removed
+}
+
+// ReviewMsg is published when a worktree job awaits review, or was accepted or rejected
+type ReviewMsg struct {
+	JobID       string
+	Instruction string
+	Path        string // Project directory inside the worktree (pending review)
+	Accepted    bool
+	Rejected    bool
+}
@@ -0,0 +1,116 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/thetronjohnson/layrr/internal/claude"
+	"github.com/thetronjohnson/layrr/internal/history"
+)
+
+// recordEvent builds the history record of the running job from the bus and appends it
+// to the history once the job finishes. It only runs on the bus subscription's goroutine.
+func (b *Bridge) recordEvent(event any) {
+	switch event := event.(type) {
+	case JobMsg:
+		job := event.Job
+		switch {
+		case job.State == JobRunning:
+			b.startRecord(job)
+		case job.Finished() && b.record != nil && b.record.ID == job.ID:
+			b.finishRecord(job)
+		}
+
+	case PromptMsg:
+		if b.record != nil && b.record.ID == event.JobID {
+			b.record.Prompt = event.Prompt
+			b.record.Screenshots = event.Screenshots
+		}
+
+	case claude.StreamMsg:
+		if b.record != nil {
+			b.record.AddEvent(event.Event)
+		}
+
+	case ReviewMsg:
+		if event.Accepted || event.Rejected {
+			b.resolveRecord(event)
+		}
+	}
+}
+
+// startRecord begins the history record of a job that started running
+func (b *Bridge) startRecord(job Job) {
+	// Screenshots are kept as files, not inline
+	msg := job.msg
+	msg.Screenshot = ""
+	msg.Screenshots = nil
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		raw = nil
+	}
+
+	startedAt := time.Now()
+	if job.StartedAt != nil {
+		startedAt = *job.StartedAt
+	}
+	b.record = &history.Record{
+		ID:          job.ID,
+		Agent:       b.agent.Name(),
+		Instruction: job.msg.Instruction,
+		PageURL:     job.msg.PageURL,
+		Message:     raw,
+		Worktree:    b.worktreeMode,
+		ReplayOf:    job.replayOf,
+		StartedAt:   startedAt,
+	}
+}
+
+// finishRecord completes the running job's record and appends it to the history
+func (b *Bridge) finishRecord(job Job) {
+	record := b.record
+	b.record = nil
+
+	record.Changes = job.Changes
+	record.State = string(job.State)
+	record.Error = job.Error
+	record.FinishedAt = time.Now()
+	if job.FinishedAt != nil {
+		record.FinishedAt = *job.FinishedAt
+	}
+	record.DurationMS = record.FinishedAt.Sub(record.StartedAt).Milliseconds()
+
+	if err := b.history.Append(*record); err != nil && b.verbose {
+		fmt.Fprintf(os.Stderr, "[Bridge] Failed to record job %s: %v\n", job.ID, err)
+	}
+}
+
+// resolveRecord updates the history record of a reviewed job with the outcome of its review.
+// The record was appended when the job started waiting for review.
+func (b *Bridge) resolveRecord(review ReviewMsg) {
+	state := JobDone
+	if review.Rejected {
+		state = JobRejected
+	}
+	reviewedAt := time.Now()
+
+	err := b.history.Update(review.JobID, func(r *history.Record) {
+		r.State = string(state)
+		r.ReviewedAt = &reviewedAt
+	})
+	if err != nil && b.verbose {
+		fmt.Fprintf(os.Stderr, "[Bridge] Failed to record review of job %s: %v\n", review.JobID, err)
+	}
+}
+
+// publishPrompt publishes the prompt sent for a job, keeping copies of its screenshots for
+// the history first (the originals are deleted when the run ends)
+func (b *Bridge) publishPrompt(jobID, prompt string, screenshots []string) {
+	kept, err := b.history.KeepFiles(jobID, screenshots)
+	if err != nil && b.verbose {
+		fmt.Fprintf(os.Stderr, "[Bridge] Failed to keep screenshots for history: %v\n", err)
+	}
+	b.bus.Publish(PromptMsg{JobID: jobID, Prompt: prompt, Screenshots: kept})
+}
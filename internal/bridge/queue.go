@@ -0,0 +1,516 @@
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/thetronjohnson/layrr/internal/agent"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+)
+
+// JobState is the lifecycle state of a queued instruction
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobDone      JobState = "done"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+	JobReview    JobState = "review"   // Ran in a worktree, waiting for accept/reject
+	JobRejected  JobState = "rejected" // Worktree changes were discarded
+)
+
+// maxFinishedJobs is how many finished jobs are kept for clients that connect later
+const maxFinishedJobs = 20
+
+// ErrJobNotFound is returned when a job ID is unknown
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobNotQueued is returned when reordering a job that already started
+var ErrJobNotQueued = errors.New("job is no longer queued")
+
+// Job is an instruction waiting for or handled by Claude Code
+type Job struct {
+	ID          string            `json:"id"`
+	MessageID   int               `json:"messageId"`
+	Instruction string            `json:"instruction"`
+	State       JobState          `json:"state"`
+	Position    int               `json:"position"`             // 1-based position while queued, 0 otherwise
+	Files       []string          `json:"files,omitempty"`      // Paths of Changes
+	Changes     []snapshot.Change `json:"changes,omitempty"`    // Files created, modified or deleted by the job
+	Checkpoint  *JobCheckpoint    `json:"checkpoint,omitempty"` // Git commits for undo/redo
+	Undone      bool              `json:"undone,omitempty"`
+	Worktree    *JobWorktree      `json:"worktree,omitempty"` // Set while the job awaits review
+	Error       string            `json:"error,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	StartedAt   *time.Time        `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time        `json:"finishedAt,omitempty"`
+
+	msg      Message
+	replayOf string // Recorded job this one replays
+	prompt   string // Recorded prompt a replay sends instead of rendering msg
+	dir      string // Where the agent works, once the job runs
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Finished reports whether the job reached a terminal state
+func (j Job) Finished() bool {
+	switch j.State {
+	case JobDone, JobFailed, JobCancelled, JobReview, JobRejected:
+		return true
+	}
+	return false
+}
+
+// Submit queues a browser message for Claude Code and returns the new job
+func (b *Bridge) Submit(msg Message) Job {
+	return b.submit(msg, "", "")
+}
+
+// submit queues a message, remembering the recorded job it replays and that job's prompt (if any)
+func (b *Bridge) submit(msg Message, replayOf, prompt string) Job {
+	b.mu.Lock()
+	job := &Job{
+		ID:          newJobID(),
+		MessageID:   msg.ID,
+		Instruction: summarizeInstruction(msg.Instruction),
+		State:       JobQueued,
+		CreatedAt:   time.Now(),
+		msg:         msg,
+		replayOf:    replayOf,
+		prompt:      prompt,
+		done:        make(chan struct{}),
+	}
+	b.jobs[job.ID] = job
+	b.queue = append(b.queue, job)
+	job.Position = len(b.queue)
+	snapshot := *job
+	b.mu.Unlock()
+
+	b.notify(snapshot)
+	b.notifyQueue()
+
+	// Wake the worker
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+
+	return snapshot
+}
+
+// WorkDir returns the directory a job's agent works in: the job's worktree in worktree
+// mode, the project directory otherwise
+func (b *Bridge) WorkDir(id string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if job, ok := b.jobs[id]; ok && job.dir != "" {
+		return job.dir
+	}
+	return b.projectDir
+}
+
+// Wait blocks until the job finishes and its final state has been published, and returns it
+func (b *Bridge) Wait(id string) (Job, error) {
+	b.mu.Lock()
+	job, ok := b.jobs[id]
+	b.mu.Unlock()
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+
+	<-job.done
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return *job, nil
+}
+
+// Jobs returns snapshots of the running job, queued jobs in order, and recently finished jobs
+func (b *Bridge) Jobs() []Job {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	jobs := make([]Job, 0, len(b.queue)+len(b.finished)+1)
+	if b.current != nil {
+		jobs = append(jobs, *b.current)
+	}
+	for _, job := range b.queue {
+		jobs = append(jobs, *job)
+	}
+	for i := len(b.finished) - 1; i >= 0; i-- {
+		jobs = append(jobs, *b.finished[i])
+	}
+	return jobs
+}
+
+// Job returns a snapshot of a queued, running or recently finished job
+func (b *Bridge) Job(id string) (Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	job, ok := b.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// Cancel drops a queued job or stops it if it is running
+func (b *Bridge) Cancel(id string) error {
+	b.mu.Lock()
+	job, ok := b.jobs[id]
+	if !ok {
+		b.mu.Unlock()
+		return ErrJobNotFound
+	}
+
+	switch job.State {
+	case JobRunning:
+		job.cancel()
+		b.mu.Unlock()
+		return nil
+
+	case JobQueued:
+		b.removeQueuedLocked(job)
+		evicted := b.finishLocked(job, JobCancelled, nil, "")
+		snapshot := *job
+		b.mu.Unlock()
+
+		b.notify(snapshot)
+		close(job.done)
+		b.notifyQueue()
+
+		// Don't wait for a running job to release its worktree lock
+		go b.discard(evicted)
+		return nil
+	}
+
+	b.mu.Unlock()
+	return ErrJobNotQueued
+}
+
+// CancelRunning stops the running job, if any, and reports whether one was running
+func (b *Bridge) CancelRunning() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current == nil {
+		return false
+	}
+	b.current.cancel()
+	return true
+}
+
+// Move changes the queue position (1-based) of a queued job
+func (b *Bridge) Move(id string, position int) error {
+	b.mu.Lock()
+	job, ok := b.jobs[id]
+	if !ok {
+		b.mu.Unlock()
+		return ErrJobNotFound
+	}
+	if job.State != JobQueued {
+		b.mu.Unlock()
+		return ErrJobNotQueued
+	}
+
+	b.removeQueuedLocked(job)
+
+	// Clamp to the valid range
+	index := position - 1
+	if index < 0 {
+		index = 0
+	}
+	if index > len(b.queue) {
+		index = len(b.queue)
+	}
+
+	b.queue = append(b.queue, nil)
+	copy(b.queue[index+1:], b.queue[index:])
+	b.queue[index] = job
+	b.mu.Unlock()
+
+	b.notifyQueue()
+	return nil
+}
+
+// worker runs queued jobs one at a time
+func (b *Bridge) worker() {
+	for range b.wake {
+		for {
+			b.mu.Lock()
+			if len(b.queue) == 0 {
+				b.mu.Unlock()
+				break
+			}
+
+			job := b.queue[0]
+			b.queue = b.queue[1:]
+			ctx, cancel := context.WithCancel(context.Background())
+			now := time.Now()
+			job.cancel = cancel
+			job.State = JobRunning
+			job.Position = 0
+			job.StartedAt = &now
+			b.current = job
+			snapshotJob := *job
+			b.mu.Unlock()
+
+			b.notify(snapshotJob)
+			b.notifyQueue()
+
+			b.runMu.Lock()
+			var changes []snapshot.Change
+			var checkpoint *JobCheckpoint
+			var worktree *JobWorktree
+			var err error
+			if b.worktreeMode {
+				changes, worktree, err = b.runInWorktree(ctx, job)
+			} else {
+				changes, checkpoint, err = b.runLive(ctx, job)
+			}
+			cancel()
+			b.runMu.Unlock()
+
+			b.mu.Lock()
+			job.Checkpoint = checkpoint
+			job.Worktree = worktree
+			var evicted *Job
+			switch {
+			case errors.Is(err, agent.ErrCancelled):
+				evicted = b.finishLocked(job, JobCancelled, changes, "")
+			case err != nil:
+				evicted = b.finishLocked(job, JobFailed, changes, err.Error())
+			case worktree != nil:
+				evicted = b.finishLocked(job, JobReview, changes, "")
+			default:
+				evicted = b.finishLocked(job, JobDone, changes, "")
+			}
+			b.current = nil
+			snapshotJob = *job
+			b.mu.Unlock()
+
+			// Clean up first, so the job can be accepted or undone as soon as it is published
+			b.discard(evicted)
+			b.notify(snapshotJob)
+			close(job.done)
+		}
+	}
+}
+
+// runLive runs a job in the project directory, checkpointing the working tree around it
+// so it can be undone
+func (b *Bridge) runLive(ctx context.Context, job *Job) ([]snapshot.Change, *JobCheckpoint, error) {
+	before := b.checkpoint(job.ID, "before")
+	changes, err := b.run(ctx, b.projectDir, job)
+
+	var checkpoint *JobCheckpoint
+	if before != "" {
+		if after := b.checkpoint(job.ID, "after"); after != "" {
+			checkpoint = &JobCheckpoint{Before: before, After: after}
+		}
+	}
+	return changes, checkpoint, err
+}
+
+// run sends a job's message to the coding agent and waits for it to finish.
+// The agent works in dir. It returns the files the run changed (relative to dir), which is
+// also populated on cancel or failure.
+func (b *Bridge) run(ctx context.Context, dir string, job *Job) ([]snapshot.Change, error) {
+	msg := job.msg
+	b.mu.Lock()
+	job.dir = dir
+	b.mu.Unlock()
+
+	// Save screenshots where the agent can read them; they are removed once the run ends
+	screenshots, cleanup, err := saveScreenshots(dir, msg)
+	if err != nil && b.verbose {
+		fmt.Fprintf(os.Stderr, "[Bridge] Failed to save screenshot: %v\n", err)
+	}
+	defer cleanup()
+	msg, screenshots = renumberScreenshots(msg, screenshots)
+
+	// Format the message for Claude Code; a replay sends the recorded prompt with this run's screenshots
+	formattedMsg := replaceScreenshots(job.prompt, screenshots)
+	if job.prompt == "" {
+		formattedMsg, err = b.formatMessage(msg, screenshots)
+		if err != nil {
+			return nil, err
+		}
+	}
+	b.publishPrompt(job.ID, formattedMsg, screenshots)
+
+	// Snapshot the project so created and deleted files are caught too
+	before, err := snapshot.Take(dir)
+	if err != nil && b.verbose {
+		fmt.Fprintf(os.Stderr, "[Bridge] Failed to snapshot project: %v\n", err)
+	}
+
+	b.bus.Publish(InstructionMsg{
+		JobID:       job.ID,
+		Instruction: msg.Instruction,
+		AreaInfo: fmt.Sprintf("%dx%d px · %d elements",
+			msg.Area.Width, msg.Area.Height, msg.Area.ElementCount),
+	})
+
+	// Send to the agent (this blocks until it finishes or the run is cancelled)
+	files, err := b.agent.SendMessage(ctx, dir, formattedMsg)
+	changes := b.changesSince(dir, before, files)
+	b.bus.Publish(ChangesMsg{JobID: job.ID, Changes: changes})
+
+	if errors.Is(err, agent.ErrCancelled) {
+		return changes, err
+	}
+	if err != nil {
+		return changes, fmt.Errorf("failed to send message to %s agent: %w", b.agent.Name(), err)
+	}
+	return changes, nil
+}
+
+// changesSince combines the project snapshot diff with the files the agent reported editing
+func (b *Bridge) changesSince(dir string, before *snapshot.Snapshot, reported []string) []snapshot.Change {
+	var changes []snapshot.Change
+	if before != nil {
+		after, err := snapshot.Take(dir)
+		if err != nil {
+			if b.verbose {
+				fmt.Fprintf(os.Stderr, "[Bridge] Failed to snapshot project: %v\n", err)
+			}
+		} else {
+			changes = before.Diff(after)
+		}
+	}
+	return snapshot.Merge(dir, changes, reported)
+}
+
+// finishLocked moves a job to a terminal state; b.mu must be held.
+// The caller closes job.done once the final state is published, then discards the
+// returned job, which no longer fits the finished list (nil if none).
+func (b *Bridge) finishLocked(job *Job, state JobState, changes []snapshot.Change, errMsg string) *Job {
+	now := time.Now()
+	job.State = state
+	job.Position = 0
+	job.Changes = changes
+	job.Files = snapshot.Paths(changes)
+	job.Error = errMsg
+	job.FinishedAt = &now
+
+	b.finished = append(b.finished, job)
+	if len(b.finished) <= maxFinishedJobs {
+		return nil
+	}
+
+	// Drop the oldest job, but keep jobs awaiting review while there are others to drop
+	i := slices.IndexFunc(b.finished, func(j *Job) bool { return j.State != JobReview })
+	if i < 0 {
+		i = 0
+	}
+	evicted := b.finished[i]
+	b.finished = slices.Delete(b.finished, i, i+1)
+	delete(b.jobs, evicted.ID)
+	return evicted
+}
+
+// discard cleans up after a job dropped from the finished list: it can't be undone
+// anymore, so its checkpoints go. A job still awaiting review has its worktree removed
+// and counts as rejected.
+func (b *Bridge) discard(job *Job) {
+	if job == nil {
+		return
+	}
+
+	b.mu.Lock()
+	inReview := job.Worktree != nil
+	b.mu.Unlock()
+	if inReview {
+		// Never remove a worktree while it is being accepted
+		b.runMu.Lock()
+		defer b.runMu.Unlock()
+
+		// It may have been accepted or rejected meanwhile
+		b.mu.Lock()
+		wt := job.Worktree
+		if wt != nil {
+			job.State = JobRejected
+			job.Worktree = nil
+			job.Error = fmt.Sprintf("discarded: more than %d jobs finished while it awaited review", maxFinishedJobs)
+		}
+		snapshotJob := *job
+		b.mu.Unlock()
+
+		if wt != nil {
+			b.removeWorktree(wt)
+			b.notifyReview(snapshotJob, false)
+		}
+	}
+	b.deleteCheckpoints(job.ID)
+}
+
+// removeQueuedLocked removes a job from the queue; b.mu must be held
+func (b *Bridge) removeQueuedLocked(job *Job) {
+	for i, queued := range b.queue {
+		if queued == job {
+			b.queue = append(b.queue[:i], b.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// notify publishes a job snapshot
+func (b *Bridge) notify(job Job) {
+	b.bus.Publish(JobMsg{Job: job})
+}
+
+// notifyQueue renumbers queued jobs and publishes any position changes
+func (b *Bridge) notifyQueue() {
+	b.mu.Lock()
+	var changed []Job
+	queued := make([]string, 0, len(b.queue))
+	for i, job := range b.queue {
+		if job.Position != i+1 {
+			job.Position = i + 1
+			changed = append(changed, *job)
+		}
+		queued = append(queued, job.Instruction)
+	}
+	b.mu.Unlock()
+
+	for _, job := range changed {
+		b.notify(job)
+	}
+
+	b.bus.Publish(QueueMsg{Queued: queued})
+}
+
+// summarizeInstruction shortens an instruction for job listings
+func summarizeInstruction(instruction string) string {
+	line := instruction
+	for i, r := range instruction {
+		if r == '\n' {
+			line = instruction[:i]
+			break
+		}
+	}
+	if runes := []rune(line); len(runes) > 120 {
+		line = string(runes[:120]) + "..."
+	}
+	return line
+}
+
+// newJobID returns a short random job identifier
+func newJobID() string {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,175 @@
+package bridge
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/thetronjohnson/layrr/internal/agent"
+)
+
+// slowButton has a run that takes a minute unless it is cancelled
+var slowButton = agent.Fixture{
+	SessionID: "test",
+	Runs: []agent.FixtureRun{
+		{Match: "slow", Steps: []agent.FixtureStep{{Delay: 60000}}},
+		{Steps: []agent.FixtureStep{}},
+	},
+}
+
+// waitRunning waits until a job has started
+func (tb *testBridge) waitRunning(t *testing.T, id string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := tb.Job(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.State == JobRunning {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is still %s", id, job.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCancelRunning(t *testing.T) {
+	tb := newTestBridge(t, t.TempDir(), slowButton)
+
+	if tb.CancelRunning() {
+		t.Error("CancelRunning() reported a job while idle")
+	}
+
+	job := tb.Submit(Message{ID: 1, Instruction: "Take it slow"})
+	tb.waitRunning(t, job.ID)
+	if !tb.CancelRunning() {
+		t.Fatal("CancelRunning() found no running job")
+	}
+
+	job, err := tb.Wait(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb.bus.Sync()
+	if job.State != JobCancelled {
+		t.Fatalf("state = %s (%s), want cancelled", job.State, job.Error)
+	}
+	if got, want := tb.jobStates(job.ID), []JobState{JobQueued, JobRunning, JobCancelled}; !slices.Equal(got, want) {
+		t.Errorf("states = %v, want %v", got, want)
+	}
+	if r := tb.record(t, job.ID); r.State != string(JobCancelled) {
+		t.Errorf("record state = %s", r.State)
+	}
+
+	// The next job runs as usual
+	if job := tb.run(t, "Add a title"); job.State != JobDone {
+		t.Errorf("next job = %s (%s), want done", job.State, job.Error)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	tb := newTestBridge(t, t.TempDir(), slowButton)
+
+	slow := tb.Submit(Message{ID: 1, Instruction: "Take it slow"})
+	tb.waitRunning(t, slow.ID)
+
+	var ids []string
+	for i, instruction := range []string{"First", "Second", "Third"} {
+		job := tb.Submit(Message{ID: i + 2, Instruction: instruction})
+		if job.State != JobQueued || job.Position != i+1 {
+			t.Fatalf("%s: state %s at %d, want queued at %d", instruction, job.State, job.Position, i+1)
+		}
+		ids = append(ids, job.ID)
+	}
+	first, second, third := ids[0], ids[1], ids[2]
+
+	// queued returns the queued job IDs and checks their positions
+	queued := func() []string {
+		t.Helper()
+		var got []string
+		for _, job := range tb.Jobs() {
+			if job.State == JobQueued {
+				got = append(got, job.ID)
+				if job.Position != len(got) {
+					t.Errorf("job %s is at %d in the list but reports %d", job.ID, len(got), job.Position)
+				}
+			}
+		}
+		return got
+	}
+
+	tests := []struct {
+		name     string
+		id       string
+		position int
+		want     []string
+	}{
+		{"to the front", third, 1, []string{third, first, second}},
+		{"to the middle", first, 2, []string{third, first, second}},
+		{"past the end", third, 99, []string{first, second, third}},
+		{"before the start", second, 0, []string{second, first, third}},
+	}
+	for _, tt := range tests {
+		if err := tb.Move(tt.id, tt.position); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := queued(); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: queue = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if err := tb.Move(slow.ID, 1); !errors.Is(err, ErrJobNotQueued) {
+		t.Errorf("Move(running) = %v, want ErrJobNotQueued", err)
+	}
+	if err := tb.Move("nope", 1); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Move(unknown) = %v, want ErrJobNotFound", err)
+	}
+
+	// Cancelling a queued job drops it without running it
+	if err := tb.Cancel(first); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := tb.Wait(first); job.State != JobCancelled || job.StartedAt != nil {
+		t.Errorf("cancelled job = %s (started %v)", job.State, job.StartedAt)
+	}
+	if got, want := queued(), []string{second, third}; !slices.Equal(got, want) {
+		t.Errorf("queue after cancel = %v, want %v", got, want)
+	}
+	if err := tb.Cancel(first); !errors.Is(err, ErrJobNotQueued) {
+		t.Errorf("Cancel(cancelled) = %v, want ErrJobNotQueued", err)
+	}
+	if err := tb.Cancel("nope"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Cancel(unknown) = %v, want ErrJobNotFound", err)
+	}
+
+	// The rest run in queue order once the slow job is cancelled
+	if err := tb.Cancel(slow.ID); err != nil {
+		t.Fatal(err)
+	}
+	var started []time.Time
+	for _, id := range []string{slow.ID, second, third} {
+		job, err := tb.Wait(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id == slow.ID {
+			if job.State != JobCancelled {
+				t.Errorf("slow job = %s, want cancelled", job.State)
+			}
+			continue
+		}
+		if job.State != JobDone {
+			t.Errorf("job %s = %s (%s), want done", id, job.State, job.Error)
+		}
+		started = append(started, *job.StartedAt)
+	}
+	tb.bus.Sync()
+	if started[1].Before(started[0]) {
+		t.Error("jobs didn't run in queue order")
+	}
+}
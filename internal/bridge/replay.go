@@ -0,0 +1,73 @@
+package bridge
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/thetronjohnson/layrr/internal/history"
+)
+
+// recordedScreenshot matches the screenshot paths in a recorded prompt. Those files were
+// deleted when the recorded run ended.
+var recordedScreenshot = regexp.MustCompile(`\S*` + regexp.QuoteMeta(screenshotDir) + `/[^/\s]+/screenshot-\d+\.png`)
+
+// Replay queues a recorded job to run again and returns the new job.
+// It gets the original instruction, elements and screenshots, and the recorded prompt is
+// sent as it was. With render, the prompt is rendered again with the bridge's current
+// templates instead, to see the effect of template changes.
+func (b *Bridge) Replay(r history.Record, render bool) (Job, error) {
+	msg, err := replayMessage(b.projectDir, r)
+	if err != nil {
+		return Job{}, err
+	}
+	prompt := r.Prompt // Empty if the recorded job failed before it was sent
+	if render {
+		prompt = ""
+	}
+	return b.submit(msg, r.ID, prompt), nil
+}
+
+// replaceScreenshots points the screenshot paths of a recorded prompt at this run's copies,
+// in the order they appear
+func replaceScreenshots(prompt string, screenshots []string) string {
+	replaced := make(map[string]string)
+	return recordedScreenshot.ReplaceAllStringFunc(prompt, func(old string) string {
+		if path, ok := replaced[old]; ok {
+			return path
+		}
+		if len(replaced) == len(screenshots) {
+			return old
+		}
+		replaced[old] = screenshots[len(replaced)]
+		return replaced[old]
+	})
+}
+
+// replayMessage rebuilds the browser message of a recorded job, reloading its screenshots
+func replayMessage(projectDir string, r history.Record) (Message, error) {
+	msg := Message{Instruction: r.Instruction, PageURL: r.PageURL}
+	if len(r.Message) > 0 {
+		if err := json.Unmarshal(r.Message, &msg); err != nil {
+			return Message{}, fmt.Errorf("failed to decode recorded message of job %s: %w", r.ID, err)
+		}
+	}
+
+	// The first image is the selection screenshot, the rest follow in order
+	for i, path := range r.Screenshots {
+		data, err := os.ReadFile(filepath.Join(projectDir, filepath.FromSlash(path)))
+		if err != nil {
+			return Message{}, fmt.Errorf("failed to read recorded screenshot: %w", err)
+		}
+		image := base64.StdEncoding.EncodeToString(data)
+		if i == 0 {
+			msg.Screenshot = image
+		} else {
+			msg.Screenshots = append(msg.Screenshots, image)
+		}
+	}
+	return msg, nil
+}
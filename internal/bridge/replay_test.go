@@ -0,0 +1,53 @@
+package bridge
+
+import "testing"
+
+func TestReplaceScreenshots(t *testing.T) {
+	old1 := "/old/project/.layrr/screenshots/msg-1-123/screenshot-1.png"
+	old2 := "/old/project/.layrr/screenshots/msg-1-123/screenshot-2.png"
+
+	tests := []struct {
+		name        string
+		prompt      string
+		screenshots []string
+		want        string
+	}{
+		{
+			name:   "no screenshots",
+			prompt: "Make it red",
+			want:   "Make it red",
+		},
+		{
+			name:        "in order",
+			prompt:      "[screenshot 1] " + old1 + "\n[screenshot 2] " + old2,
+			screenshots: []string{"/new/1.png", "/new/2.png"},
+			want:        "[screenshot 1] /new/1.png\n[screenshot 2] /new/2.png",
+		},
+		{
+			name:        "repeated path",
+			prompt:      old1 + " and again " + old1,
+			screenshots: []string{"/new/1.png"},
+			want:        "/new/1.png and again /new/1.png",
+		},
+		{
+			name:        "fewer new screenshots",
+			prompt:      old1 + " " + old2,
+			screenshots: []string{"/new/1.png"},
+			want:        "/new/1.png " + old2,
+		},
+		{
+			name:        "other paths untouched",
+			prompt:      "See src/App.jsx and /tmp/screenshot-1.png",
+			screenshots: []string{"/new/1.png"},
+			want:        "See src/App.jsx and /tmp/screenshot-1.png",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceScreenshots(tt.prompt, tt.screenshots); got != tt.want {
+				t.Errorf("replaceScreenshots() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
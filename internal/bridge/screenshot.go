@@ -0,0 +1,110 @@
+package bridge
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/thetronjohnson/layrr/internal/config"
+)
+
+// screenshotDir holds screenshots while the agent works, relative to the project directory.
+// It lives inside the project so the agent may read it, and is listed in .layrr/.gitignore so
+// checkpoints, worktree diffs and the user's git status never see it.
+const screenshotDir = ".layrr/screenshots"
+
+// images returns the message's screenshots in the order they are numbered as [screenshot N].
+// Visual edits number the further images only, so an empty first one isn't counted.
+func (m Message) images() []string {
+	var images []string
+	if m.Screenshot != "" {
+		images = append(images, m.Screenshot)
+	}
+	return append(images, m.Screenshots...)
+}
+
+// saveScreenshots writes a message's screenshots as PNG files under dir so the agent can read them.
+// It returns their absolute paths, "" for each image that couldn't be saved, and a function
+// that deletes them again.
+func saveScreenshots(dir string, msg Message) ([]string, func(), error) {
+	images := msg.images()
+	if len(images) == 0 {
+		return nil, func() {}, nil
+	}
+
+	if err := config.IgnoreLocalFiles(dir, path.Base(screenshotDir)+"/"); err != nil {
+		return make([]string, len(images)), func() {}, err
+	}
+	root := filepath.Join(dir, filepath.FromSlash(screenshotDir))
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return make([]string, len(images)), func() {}, fmt.Errorf("failed to create screenshot directory: %w", err)
+	}
+
+	// One folder per run so concurrent worktrees never share files
+	folder, err := os.MkdirTemp(root, fmt.Sprintf("msg-%d-", msg.ID))
+	if err != nil {
+		return make([]string, len(images)), func() {}, fmt.Errorf("failed to create screenshot directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(folder) }
+
+	// A broken image only costs its own screenshot
+	paths := make([]string, len(images))
+	var errs []error
+	for i, image := range images {
+		if image == "" {
+			continue
+		}
+		data, err := decodeImage(image)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to decode screenshot %d: %w", i+1, err))
+			continue
+		}
+
+		path := filepath.Join(folder, fmt.Sprintf("screenshot-%d.png", i+1))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write screenshot %d: %w", i+1, err))
+			continue
+		}
+		paths[i] = path
+	}
+
+	return paths, cleanup, errors.Join(errs...)
+}
+
+// renumberScreenshots drops the screenshots that weren't saved from paths and renumbers the
+// visual edits' [screenshot N] references to match, clearing those of the missing images
+func renumberScreenshots(msg Message, paths []string) (Message, []string) {
+	numbers := make(map[int]int) // [screenshot N] before and after, for the saved images
+	var saved []string
+	for i, path := range paths {
+		if path != "" {
+			saved = append(saved, path)
+			numbers[i+1] = len(saved)
+		}
+	}
+
+	if msg.Edits != nil {
+		edits := *msg.Edits
+		edits.Changes = slices.Clone(edits.Changes)
+		for i := range edits.Changes {
+			edits.Changes[i].Screenshot = numbers[edits.Changes[i].Screenshot]
+		}
+		msg.Edits = &edits
+	}
+	return msg, saved
+}
+
+// decodeImage decodes a base64 image, with or without a data URL prefix
+func decodeImage(image string) ([]byte, error) {
+	if strings.HasPrefix(image, "data:") {
+		if _, data, ok := strings.Cut(image, ","); ok {
+			image = data
+		}
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(image))
+}
@@ -0,0 +1,69 @@
+package bridge
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/thetronjohnson/layrr/internal/prompt"
+)
+
+func TestSaveScreenshots(t *testing.T) {
+	dir := t.TempDir()
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG"))
+	msg := Message{
+		ID:          7,
+		Screenshot:  "data:image/png;base64," + png,
+		Screenshots: []string{"not base64!", png},
+	}
+
+	paths, cleanup, err := saveScreenshots(dir, msg)
+	if err == nil {
+		t.Error("a broken screenshot wasn't reported")
+	}
+	if len(paths) != 3 || paths[0] == "" || paths[1] != "" || paths[2] == "" {
+		t.Fatalf("paths = %q, want the first and third saved", paths)
+	}
+	for _, path := range []string{paths[0], paths[2]} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != "\x89PNG" {
+			t.Errorf("%s = %q, %v", path, data, err)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, ".layrr", ".gitignore")); err != nil || !strings.Contains(string(data), "\nscreenshots/\n") {
+		t.Errorf("screenshot directory isn't ignored: %q, %v", data, err)
+	}
+
+	cleanup()
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Errorf("screenshot survived cleanup: %v", err)
+	}
+}
+
+func TestRenumberScreenshots(t *testing.T) {
+	edits := &prompt.VisualEditsData{Changes: []prompt.VisualChange{
+		{Number: 1, Screenshot: 1},
+		{Number: 2, Screenshot: 2},
+		{Number: 3, Screenshot: 3},
+		{Number: 4},
+	}}
+	msg := Message{Edits: edits}
+
+	renumbered, saved := renumberScreenshots(msg, []string{"/a.png", "", "/c.png"})
+
+	if want := []string{"/a.png", "/c.png"}; !slices.Equal(saved, want) {
+		t.Errorf("saved = %q, want %q", saved, want)
+	}
+	var got []int
+	for _, change := range renumbered.Edits.Changes {
+		got = append(got, change.Screenshot)
+	}
+	if want := []int{1, 0, 2, 0}; !slices.Equal(got, want) {
+		t.Errorf("screenshot numbers = %v, want %v", got, want)
+	}
+	if edits.Changes[2].Screenshot != 3 {
+		t.Error("the original message was modified")
+	}
+}
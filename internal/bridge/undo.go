@@ -0,0 +1,214 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/thetronjohnson/layrr/internal/checkpoint"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+)
+
+// JobCheckpoint holds the git commits recorded around a job
+type JobCheckpoint struct {
+	Before string `json:"before"` // Working tree before the job ran
+	After  string `json:"after"`  // Working tree after the job finished
+}
+
+// ErrNoCheckpoint is returned when undoing a job that has no git checkpoint
+var ErrNoCheckpoint = errors.New("job has no checkpoint (is the project a git repository?)")
+
+// ErrJobBusy is returned when undo or redo is requested while a job is running
+var ErrJobBusy = errors.New("wait for the running job to finish")
+
+// ErrAlreadyUndone and ErrNotUndone reject undo/redo in the wrong order
+var (
+	ErrAlreadyUndone = errors.New("job is already undone")
+	ErrNotUndone     = errors.New("job is not undone")
+)
+
+// ConflictError is returned when files were changed again after the job,
+// so restoring them would discard someone else's work
+type ConflictError struct {
+	Paths []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("files changed since the job ran: %s", strings.Join(e.Paths, ", "))
+}
+
+// UndoJob restores the files changed by a job to their state before it ran
+func (b *Bridge) UndoJob(id string) (Job, error) {
+	return b.restoreJob(id, true)
+}
+
+// RedoJob re-applies the changes of an undone job
+func (b *Bridge) RedoJob(id string) (Job, error) {
+	return b.restoreJob(id, false)
+}
+
+// checkpoint records the working tree for a job; returns "" when checkpoints are unavailable
+func (b *Bridge) checkpoint(jobID, stage string) string {
+	if b.repo == nil {
+		return ""
+	}
+
+	commit, err := b.repo.Create("jobs/"+jobID+"/"+stage, fmt.Sprintf("layrr: %s job %s", stage, jobID))
+	if err != nil {
+		if b.verbose {
+			fmt.Fprintf(os.Stderr, "[Bridge] Failed to checkpoint job %s: %v\n", jobID, err)
+		}
+		return ""
+	}
+	return commit
+}
+
+// deleteCheckpoints removes a job's checkpoint refs once nothing can use them: the given
+// stages (e.g. "before"), or all of them
+func (b *Bridge) deleteCheckpoints(jobID string, stages ...string) {
+	if b.repo == nil {
+		return
+	}
+	refs, err := b.repo.Refs("jobs/" + jobID)
+	if err == nil {
+		if len(stages) > 0 {
+			refs = slices.DeleteFunc(refs, func(ref string) bool { return !slices.Contains(stages, path.Base(ref)) })
+		}
+		err = b.repo.Delete(refs...)
+	}
+	if err != nil && b.verbose {
+		fmt.Fprintf(os.Stderr, "[Bridge] Failed to delete checkpoints of job %s: %v\n", jobID, err)
+	}
+}
+
+// DeleteOldCheckpoints deletes the checkpoint refs left by earlier runs. Jobs of earlier
+// runs aren't in the queue, so nothing can undo them anymore.
+func (b *Bridge) DeleteOldCheckpoints() {
+	if b.repo == nil {
+		return
+	}
+	refs, err := b.repo.Refs("jobs")
+	if err == nil {
+		err = b.repo.Delete(refs...)
+	}
+	if err != nil && b.verbose {
+		fmt.Fprintf(os.Stderr, "[Bridge] Failed to delete old checkpoints: %v\n", err)
+	}
+}
+
+// restoreJob moves a job's changed files between its before and after checkpoints
+func (b *Bridge) restoreJob(id string, undo bool) (Job, error) {
+	// Never restore files underneath a running job
+	if !b.runMu.TryLock() {
+		return Job{}, ErrJobBusy
+	}
+	defer b.runMu.Unlock()
+
+	b.mu.Lock()
+	job, ok := b.jobs[id]
+	if !ok {
+		b.mu.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	snapshotJob := *job
+	b.mu.Unlock()
+
+	switch {
+	case snapshotJob.Checkpoint == nil:
+		return Job{}, ErrNoCheckpoint
+	case undo && snapshotJob.Undone:
+		return Job{}, ErrAlreadyUndone
+	case !undo && !snapshotJob.Undone:
+		return Job{}, ErrNotUndone
+	}
+
+	// Undo goes from the after checkpoint to before; redo the other way
+	from, to := snapshotJob.Checkpoint.After, snapshotJob.Checkpoint.Before
+	gone := snapshot.Deleted // Kind of change whose files are absent from `from`
+	absent := snapshot.Created
+	if !undo {
+		from, to = to, from
+		gone, absent = absent, gone
+	}
+
+	paths := snapshot.Paths(snapshotJob.Changes)
+	fromBlobs, err := b.repo.Blobs(from, paths)
+	if err != nil {
+		return Job{}, err
+	}
+	toBlobs, err := b.repo.Blobs(to, paths)
+	if err != nil {
+		return Job{}, err
+	}
+	working, err := b.repo.WorkingBlobs(paths)
+	if err != nil {
+		return Job{}, err
+	}
+
+	var restore, remove, conflicts []string
+	for _, change := range snapshotJob.Changes {
+		path := change.Path
+
+		// Refuse if the file no longer matches what the job left behind
+		if blob, ok := fromBlobs[path]; ok {
+			if working[path] != blob {
+				conflicts = append(conflicts, path)
+				continue
+			}
+		} else if change.Kind == gone {
+			if _, exists := working[path]; exists {
+				conflicts = append(conflicts, path)
+				continue
+			}
+		}
+
+		switch {
+		case toBlobs[path] != "":
+			restore = append(restore, path)
+		case change.Kind == absent:
+			remove = append(remove, path)
+		default:
+			// Ignored by git, so the checkpoint has no copy to restore
+			if b.verbose {
+				fmt.Fprintf(os.Stderr, "[Bridge] Skipping %s (not in checkpoint)\n", path)
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return Job{}, &ConflictError{Paths: conflicts}
+	}
+
+	if err := b.repo.Restore(to, restore, remove); err != nil {
+		return Job{}, err
+	}
+
+	b.mu.Lock()
+	job.Undone = undo
+	snapshotJob = *job
+	b.mu.Unlock()
+
+	b.notify(snapshotJob)
+	b.bus.Publish(UndoMsg{
+		JobID:       snapshotJob.ID,
+		Instruction: snapshotJob.Instruction,
+		Redo:        !undo,
+		Files:       append(restore, remove...),
+	})
+
+	return snapshotJob, nil
+}
+
+// openRepo opens the project's git repository for checkpoints (nil if unavailable)
+func openRepo(projectDir string, verbose bool) *checkpoint.Repo {
+	repo, err := checkpoint.Open(projectDir)
+	if err != nil {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "[Bridge] Checkpoints disabled: %v\n", err)
+		}
+		return nil
+	}
+	return repo
+}
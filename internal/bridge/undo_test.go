@@ -0,0 +1,135 @@
+package bridge
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/thetronjohnson/layrr/internal/agent"
+	"github.com/thetronjohnson/layrr/internal/checkpoint"
+)
+
+// gitProject returns a new git repository, skipping the test without git
+func gitProject(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	return dir
+}
+
+var title = "export const Title = () => <h1>Hello</h1>\n"
+
+// redButtonWithTitle edits App.jsx and creates Title.jsx
+var redButtonWithTitle = agent.Fixture{
+	SessionID: "test",
+	Runs: []agent.FixtureRun{{Steps: []agent.FixtureStep{
+		{Edit: &agent.FixtureEdit{File: "src/App.jsx", Find: "bg-blue-500", Replace: "bg-red-500"}},
+		{Edit: &agent.FixtureEdit{File: "src/Title.jsx", Content: &title}},
+	}}},
+}
+
+func TestUndoRedo(t *testing.T) {
+	dir := gitProject(t)
+	tb := newTestBridge(t, dir, redButtonWithTitle)
+	app := filepath.Join(dir, "src", "App.jsx")
+	titlePath := filepath.Join(dir, "src", "Title.jsx")
+
+	job := tb.run(t, "Make the button red and add a title")
+	if job.State != JobDone || job.Checkpoint == nil {
+		t.Fatalf("state = %s (%s), checkpoint = %v", job.State, job.Error, job.Checkpoint)
+	}
+
+	// check compares the project with the job done or undone
+	check := func(undone bool) {
+		t.Helper()
+		if got := readFile(t, app); strings.Contains(got, "bg-red-500") == undone {
+			t.Errorf("App.jsx (undone %v): %s", undone, got)
+		}
+		if _, err := os.Stat(titlePath); os.IsNotExist(err) != undone {
+			t.Errorf("Title.jsx exists = %v (undone %v)", err == nil, undone)
+		}
+	}
+
+	undone, err := tb.UndoJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !undone.Undone {
+		t.Error("job isn't marked undone")
+	}
+	check(true)
+	if _, err := tb.UndoJob(job.ID); !errors.Is(err, ErrAlreadyUndone) {
+		t.Errorf("second undo = %v, want ErrAlreadyUndone", err)
+	}
+
+	redone, err := tb.RedoJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redone.Undone {
+		t.Error("job is still marked undone")
+	}
+	check(false)
+	if _, err := tb.RedoJob(job.ID); !errors.Is(err, ErrNotUndone) {
+		t.Errorf("second redo = %v, want ErrNotUndone", err)
+	}
+
+	// Files edited after the job aren't overwritten
+	writeFile(t, app, `<button className="bg-red-700">Save</button>`+"\n")
+	var conflict *ConflictError
+	if _, err := tb.UndoJob(job.ID); !errors.As(err, &conflict) || !slices.Equal(conflict.Paths, []string{"src/App.jsx"}) {
+		t.Fatalf("undo after an edit = %v, want a conflict on src/App.jsx", err)
+	}
+	if got := readFile(t, app); !strings.Contains(got, "bg-red-700") {
+		t.Errorf("conflicting undo changed App.jsx: %s", got)
+	}
+	if _, err := os.Stat(titlePath); err != nil {
+		t.Errorf("conflicting undo removed Title.jsx: %v", err)
+	}
+
+	if _, err := tb.UndoJob("nope"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("undo of an unknown job = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestUndoWithoutGit(t *testing.T) {
+	tb := newTestBridge(t, t.TempDir(), redButton)
+
+	job := tb.run(t, "Make the button red")
+	if job.Checkpoint != nil {
+		t.Errorf("checkpoint = %v outside a git repository", job.Checkpoint)
+	}
+	if _, err := tb.UndoJob(job.ID); !errors.Is(err, ErrNoCheckpoint) {
+		t.Errorf("undo = %v, want ErrNoCheckpoint", err)
+	}
+}
+
+func TestDeleteOldCheckpoints(t *testing.T) {
+	dir := gitProject(t)
+	tb := newTestBridge(t, dir, redButton)
+	tb.run(t, "Make the button red")
+
+	repo, err := checkpoint.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs, err := repo.Refs("jobs"); err != nil || len(refs) != 2 {
+		t.Fatalf("refs after a job = %v, %v, want before and after", refs, err)
+	}
+
+	// The next run starts by dropping them
+	tb.DeleteOldCheckpoints()
+	if refs, err := repo.Refs("jobs"); err != nil || len(refs) != 0 {
+		t.Errorf("refs after DeleteOldCheckpoints = %v, %v", refs, err)
+	}
+}
@@ -0,0 +1,235 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+)
+
+// JobWorktree describes the temporary git worktree a job ran in
+type JobWorktree struct {
+	Path       string `json:"path"`       // Worktree root
+	ProjectDir string `json:"projectDir"` // Project directory inside the worktree
+	Base       string `json:"base"`       // Commit the job started from (a checkpoint of the live working tree by default)
+	Head       string `json:"head"`       // Checkpoint of the worktree after the job
+}
+
+// ErrWorktreeUnavailable is returned when worktree mode is enabled outside a git repository
+var ErrWorktreeUnavailable = errors.New("worktree mode requires the project to be in a git repository")
+
+// ErrJobNotInReview is returned when accepting or rejecting a job that isn't awaiting review
+var ErrJobNotInReview = errors.New("job is not awaiting review")
+
+// SetWorktreeMode makes jobs run in temporary git worktrees instead of the project directory.
+// Their changes reach the working tree only when accepted with AcceptJob.
+func (b *Bridge) SetWorktreeMode(enabled bool) error {
+	if enabled && b.repo == nil {
+		return ErrWorktreeUnavailable
+	}
+	b.worktreeMode = enabled
+	return nil
+}
+
+// SetCheckout makes jobs run in fresh worktrees checked out at ref (e.g. "HEAD") instead of
+// the current state of the working tree, so they start from a known commit
+func (b *Bridge) SetCheckout(ref string) error {
+	if b.repo == nil {
+		return ErrWorktreeUnavailable
+	}
+	commit, err := b.repo.Resolve(ref)
+	if err != nil {
+		return err
+	}
+	b.worktreeMode = true
+	b.worktreeBase = commit
+	return nil
+}
+
+// WorktreeMode reports whether jobs run in worktrees
+func (b *Bridge) WorktreeMode() bool {
+	return b.worktreeMode
+}
+
+// runInWorktree runs a job in a fresh worktree checked out from the live working tree.
+// Jobs without changes (or that fail) don't keep their worktree.
+func (b *Bridge) runInWorktree(ctx context.Context, job *Job) ([]snapshot.Change, *JobWorktree, error) {
+	base := b.worktreeBase
+	if base == "" {
+		base = b.checkpoint(job.ID, "base")
+	}
+	if base == "" {
+		return nil, nil, fmt.Errorf("failed to checkpoint working tree for worktree")
+	}
+
+	path := filepath.Join(os.TempDir(), "layrr-worktrees", job.ID)
+	if err := b.repo.AddWorktree(path, base); err != nil {
+		return nil, nil, err
+	}
+	wt := &JobWorktree{
+		Path:       path,
+		ProjectDir: b.repo.ProjectDir(path),
+		Base:       base,
+	}
+
+	changes, err := b.run(ctx, wt.ProjectDir, job)
+	if err != nil || len(changes) == 0 {
+		b.removeWorktree(wt)
+		b.deleteCheckpoints(job.ID)
+		return changes, nil, err
+	}
+
+	// Record the result so the diff survives until the job is accepted or rejected
+	head, err := b.worktreeRepoCheckpoint(wt, job.ID)
+	if err != nil {
+		b.removeWorktree(wt)
+		b.deleteCheckpoints(job.ID)
+		return changes, nil, err
+	}
+	wt.Head = head
+
+	b.bus.Publish(ReviewMsg{JobID: job.ID, Instruction: job.Instruction, Path: wt.ProjectDir})
+	return changes, wt, nil
+}
+
+// JobDiff returns the patch a job in review would apply to the working tree
+func (b *Bridge) JobDiff(id string) (string, error) {
+	b.mu.Lock()
+	job, ok := b.jobs[id]
+	if !ok {
+		b.mu.Unlock()
+		return "", ErrJobNotFound
+	}
+	wt := job.Worktree
+	b.mu.Unlock()
+
+	if wt == nil {
+		return "", ErrJobNotInReview
+	}
+	return b.repo.Diff(wt.Base, wt.Head)
+}
+
+// AcceptJob applies a reviewed job's changes to the working tree and removes its worktree.
+// The accepted job gets a checkpoint, so it can be undone like any other job.
+func (b *Bridge) AcceptJob(id string) (Job, error) {
+	if !b.runMu.TryLock() {
+		return Job{}, ErrJobBusy
+	}
+	defer b.runMu.Unlock()
+
+	job, wt, err := b.reviewedJob(id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	patch, err := b.repo.Diff(wt.Base, wt.Head)
+	if err != nil {
+		return Job{}, err
+	}
+
+	before := b.checkpoint(id, "before")
+	if err := b.repo.Apply(patch); err != nil {
+		b.deleteCheckpoints(id, "before")
+		return Job{}, err
+	}
+	after := b.checkpoint(id, "after")
+	b.removeWorktree(wt)
+	b.deleteCheckpoints(id, "base", "head") // Undo uses before and after
+
+	b.mu.Lock()
+	job.State = JobDone
+	job.Worktree = nil
+	if before != "" && after != "" {
+		job.Checkpoint = &JobCheckpoint{Before: before, After: after}
+	}
+	snapshotJob := *job
+	b.mu.Unlock()
+
+	b.notifyReview(snapshotJob, true)
+	return snapshotJob, nil
+}
+
+// RejectJob discards a reviewed job's worktree without touching the working tree
+func (b *Bridge) RejectJob(id string) (Job, error) {
+	// Claim the worktree under the lock, so it is removed only once
+	b.mu.Lock()
+	job, wt, err := b.reviewedJobLocked(id)
+	if err != nil {
+		b.mu.Unlock()
+		return Job{}, err
+	}
+	job.State = JobRejected
+	job.Worktree = nil
+	snapshotJob := *job
+	b.mu.Unlock()
+
+	b.removeWorktree(wt)
+	b.deleteCheckpoints(id)
+	b.notifyReview(snapshotJob, false)
+	return snapshotJob, nil
+}
+
+// CleanupWorktrees removes the worktrees of jobs still awaiting review (used on shutdown)
+func (b *Bridge) CleanupWorktrees() {
+	b.mu.Lock()
+	var worktrees []*JobWorktree
+	for _, job := range b.jobs {
+		if job.Worktree != nil {
+			worktrees = append(worktrees, job.Worktree)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, wt := range worktrees {
+		b.removeWorktree(wt)
+	}
+}
+
+// reviewedJob looks up a job awaiting review
+func (b *Bridge) reviewedJob(id string) (*Job, *JobWorktree, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reviewedJobLocked(id)
+}
+
+// reviewedJobLocked looks up a job awaiting review; b.mu must be held
+func (b *Bridge) reviewedJobLocked(id string) (*Job, *JobWorktree, error) {
+	job, ok := b.jobs[id]
+	if !ok {
+		return nil, nil, ErrJobNotFound
+	}
+	if job.State != JobReview || job.Worktree == nil {
+		return nil, nil, ErrJobNotInReview
+	}
+	return job, job.Worktree, nil
+}
+
+// worktreeRepoCheckpoint commits the worktree's state under the job's refs
+func (b *Bridge) worktreeRepoCheckpoint(wt *JobWorktree, jobID string) (string, error) {
+	repo := openRepo(wt.ProjectDir, b.verbose)
+	if repo == nil {
+		return "", fmt.Errorf("worktree %s is not a git work tree", wt.Path)
+	}
+	return repo.Create("jobs/"+jobID+"/head", fmt.Sprintf("layrr: worktree result of job %s", jobID))
+}
+
+// removeWorktree deletes a job's worktree, logging failures
+func (b *Bridge) removeWorktree(wt *JobWorktree) {
+	if err := b.repo.RemoveWorktree(wt.Path); err != nil && b.verbose {
+		fmt.Fprintf(os.Stderr, "[Bridge] Failed to remove worktree %s: %v\n", wt.Path, err)
+	}
+}
+
+// notifyReview publishes an accepted or rejected job
+func (b *Bridge) notifyReview(job Job, accepted bool) {
+	b.notify(job)
+	b.bus.Publish(ReviewMsg{
+		JobID:       job.ID,
+		Instruction: job.Instruction,
+		Accepted:    accepted,
+		Rejected:    !accepted,
+	})
+}
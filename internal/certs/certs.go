@@ -0,0 +1,251 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// File names inside the certificate directory
+const (
+	caFile   = "ca.pem"
+	caKey    = "ca-key.pem"
+	leafFile = "localhost.pem"
+	leafKey  = "localhost-key.pem"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 397 * 24 * time.Hour // Browsers reject longer-lived leaf certificates
+	renewBefore  = 30 * 24 * time.Hour
+)
+
+// Hosts are the names the proxy's certificate is valid for
+var Hosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// loopbackRanges are the addresses the CA may sign for, besides localhost
+var loopbackRanges = []*net.IPNet{
+	{IP: net.IPv4(127, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv6loopback, Mask: net.CIDRMask(128, 128)},
+}
+
+// Bundle is a loaded proxy certificate and the CA that signed it
+type Bundle struct {
+	Dir         string
+	CAFile      string // PEM file to add to the trust store
+	Certificate tls.Certificate
+	CreatedCA   bool // The CA was generated just now
+}
+
+// Dir returns where certificates are kept: <user config dir>/layrr/certs
+func Dir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user config directory: %w", err)
+	}
+	return filepath.Join(base, "layrr", "certs"), nil
+}
+
+// Ensure loads the CA and the proxy certificate from dir, generating the CA on first use and
+// a new certificate when the old one is missing, expiring or doesn't cover Hosts
+func Ensure(dir string) (*Bundle, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	bundle := &Bundle{Dir: dir, CAFile: filepath.Join(dir, caFile)}
+	ca, caPriv, err := loadPair(filepath.Join(dir, caFile), filepath.Join(dir, caKey))
+	if errors.Is(err, os.ErrNotExist) {
+		ca, caPriv, err = createCA(dir)
+		bundle.CreatedCA = true
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, _, err := loadPair(filepath.Join(dir, leafFile), filepath.Join(dir, leafKey))
+	if bundle.CreatedCA || err != nil || !usable(leaf, ca) {
+		if err := createLeaf(dir, ca, caPriv); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, leafFile), filepath.Join(dir, leafKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load proxy certificate: %w", err)
+	}
+	bundle.Certificate = cert
+	return bundle, nil
+}
+
+// Trusted reports whether the system trusts the proxy certificate
+func (b *Bundle) Trusted() bool {
+	if len(b.Certificate.Certificate) == 0 {
+		return false
+	}
+	leaf, err := x509.ParseCertificate(b.Certificate.Certificate[0])
+	if err != nil {
+		return false
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "localhost"})
+	return err == nil
+}
+
+// TrustInstructions explains how to make the system and browsers trust the CA
+func (b *Bundle) TrustInstructions() string {
+	var system string
+	switch runtime.GOOS {
+	case "darwin":
+		system = fmt.Sprintf("sudo security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain %q", b.CAFile)
+	case "windows":
+		system = fmt.Sprintf("certutil -addstore -f ROOT %q", b.CAFile)
+	default:
+		system = fmt.Sprintf("sudo cp %q /usr/local/share/ca-certificates/layrr-ca.crt && sudo update-ca-certificates", b.CAFile)
+	}
+	return fmt.Sprintf("To trust the layrr CA, run:\n  %s\nFirefox keeps its own list: Settings → Privacy & Security → Certificates → View Certificates → Authorities → Import %s",
+		system, b.CAFile)
+}
+
+// usable reports whether a leaf certificate was signed by ca, covers Hosts and isn't about to expire
+func usable(leaf, ca *x509.Certificate) bool {
+	if leaf.CheckSignatureFrom(ca) != nil || time.Until(leaf.NotAfter) < renewBefore {
+		return false
+	}
+	for _, host := range Hosts {
+		if leaf.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// createCA generates and saves a new CA. Name constraints limit it to localhost and loopback
+// addresses, so a leaked key can't be used to impersonate other sites to this machine.
+func createCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{Organization: []string{"layrr"}, CommonName: "layrr local CA " + hostname},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         []string{"localhost"},
+		PermittedIPRanges:           loopbackRanges,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA: %w", err)
+	}
+	if err := savePair(filepath.Join(dir, caFile), filepath.Join(dir, caKey), der, key); err != nil {
+		return nil, nil, err
+	}
+
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+// createLeaf generates and saves a certificate for Hosts signed by the CA
+func createLeaf(dir string, ca *x509.Certificate, caPriv *ecdsa.PrivateKey) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{Organization: []string{"layrr"}, CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caPriv)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+	return savePair(filepath.Join(dir, leafFile), filepath.Join(dir, leafKey), der, key)
+}
+
+// loadPair reads a PEM certificate and its EC private key
+func loadPair(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("invalid PEM in %s or %s", certPath, keyPath)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", certPath, err)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", keyPath, err)
+	}
+	return cert, key, nil
+}
+
+// savePair writes a certificate and its private key (readable by the owner only) as PEM
+func savePair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", keyPath, err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", certPath, err)
+	}
+	return nil
+}
+
+// serialNumber returns a random certificate serial number
+func serialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
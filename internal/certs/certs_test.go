@@ -0,0 +1,127 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// verify checks that a bundle's certificate chains to its CA for every host in Hosts
+func verify(t *testing.T, b *Bundle) *x509.Certificate {
+	t.Helper()
+
+	ca, _, err := loadPair(b.CAFile, filepath.Join(b.Dir, caKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	leaf, err := x509.ParseCertificate(b.Certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range Hosts {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("certificate isn't valid for %s: %v", host, err)
+		}
+	}
+	return leaf
+}
+
+func TestEnsure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+
+	first, err := Ensure(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.CreatedCA {
+		t.Error("CreatedCA not set on first use")
+	}
+	leaf := verify(t, first)
+	if runtime.GOOS != "windows" {
+		for _, name := range []string{caKey, leafKey} {
+			if info, err := os.Stat(filepath.Join(dir, name)); err != nil || info.Mode().Perm() != 0600 {
+				t.Errorf("%s mode = %v, %v, want 0600", name, info.Mode().Perm(), err)
+			}
+		}
+	}
+
+	// The next run reuses both
+	second, err := Ensure(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.CreatedCA || !bytes.Equal(second.Certificate.Certificate[0], leaf.Raw) {
+		t.Error("second Ensure() replaced the CA or the certificate")
+	}
+
+	// A missing or broken certificate is replaced, signed by the same CA
+	caPEM, _ := os.ReadFile(first.CAFile)
+	for _, broken := range []func(){
+		func() { os.Remove(filepath.Join(dir, leafFile)) },
+		func() { os.WriteFile(filepath.Join(dir, leafFile), []byte("garbage"), 0644) },
+	} {
+		broken()
+		b, err := Ensure(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.CreatedCA {
+			t.Error("the CA was replaced along with the certificate")
+		}
+		if renewed := verify(t, b); bytes.Equal(renewed.Raw, leaf.Raw) {
+			t.Error("certificate wasn't renewed")
+		}
+		if data, _ := os.ReadFile(b.CAFile); !bytes.Equal(data, caPEM) {
+			t.Error("CA file changed")
+		}
+	}
+}
+
+func TestCAOnlySignsLoopback(t *testing.T) {
+	b, err := Ensure(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, caPriv, err := loadPair(b.CAFile, filepath.Join(b.Dir, caKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	// A certificate for another site made with a leaked CA key isn't trusted
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := forged.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots}); err == nil {
+		t.Error("CA signed a trusted certificate for example.com")
+	}
+}
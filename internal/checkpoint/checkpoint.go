@@ -0,0 +1,230 @@
+package checkpoint
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotRepo is returned by Open when the project is not inside a git work tree
+var ErrNotRepo = errors.New("not a git repository")
+
+// RefPrefix is where checkpoint commits are kept so git gc doesn't collect them
+const RefPrefix = "refs/layrr/"
+
+// Repo creates and restores checkpoints of a project's working tree.
+// Checkpoints are ordinary commits built from a temporary index, so HEAD,
+// the real index and the stash are never touched.
+type Repo struct {
+	root   string // Top of the git work tree
+	prefix string // Project directory relative to root, slash-terminated ("" at the root)
+}
+
+// Open finds the git repository containing projectDir
+func Open(projectDir string) (*Repo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, ErrNotRepo
+	}
+
+	out, err := git(projectDir, nil, "rev-parse", "--show-toplevel", "--show-prefix")
+	if err != nil {
+		return nil, ErrNotRepo
+	}
+
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	r := &Repo{root: lines[0]}
+	if len(lines) > 1 {
+		r.prefix = lines[1]
+	}
+	return r, nil
+}
+
+// Create commits the current working tree (respecting .gitignore) and points ref at it
+func (r *Repo) Create(ref, message string) (string, error) {
+	index, err := os.CreateTemp("", "layrr-index-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary index: %w", err)
+	}
+	index.Close()
+	os.Remove(index.Name()) // git refuses to read an empty index file
+	defer os.Remove(index.Name())
+
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+
+	// Start from HEAD so unchanged files are cheap to stage
+	head, headErr := git(r.root, nil, "rev-parse", "--verify", "--quiet", "HEAD^{commit}")
+	head = strings.TrimSpace(head)
+	if headErr == nil {
+		if _, err := git(r.root, env, "read-tree", head); err != nil {
+			return "", fmt.Errorf("failed to read HEAD tree: %w", err)
+		}
+	}
+
+	if _, err := git(r.root, env, "add", "-A", "--", "."); err != nil {
+		return "", fmt.Errorf("failed to stage working tree: %w", err)
+	}
+
+	tree, err := git(r.root, env, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("failed to write tree: %w", err)
+	}
+
+	args := []string{"commit-tree", strings.TrimSpace(tree), "-m", message}
+	if headErr == nil {
+		args = append(args, "-p", head)
+	}
+	commit, err := git(r.root, authorEnv(), args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create checkpoint commit: %w", err)
+	}
+	commit = strings.TrimSpace(commit)
+
+	if _, err := git(r.root, nil, "update-ref", RefPrefix+ref, commit); err != nil {
+		return "", fmt.Errorf("failed to update checkpoint ref: %w", err)
+	}
+	return commit, nil
+}
+
+// Refs lists the checkpoint refs under prefix (e.g. "jobs/1a2b3c4d"), newest commit first.
+// Names are relative to RefPrefix, as passed to Create.
+func (r *Repo) Refs(prefix string) ([]string, error) {
+	out, err := git(r.root, nil, "for-each-ref", "--sort=-committerdate", "--format=%(refname)", RefPrefix+prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	var refs []string
+	for _, ref := range strings.Fields(out) {
+		refs = append(refs, strings.TrimPrefix(ref, RefPrefix))
+	}
+	return refs, nil
+}
+
+// Delete removes checkpoint refs, so git gc can collect their commits
+func (r *Repo) Delete(refs ...string) error {
+	for _, ref := range refs {
+		if _, err := git(r.root, nil, "update-ref", "-d", RefPrefix+ref); err != nil {
+			return fmt.Errorf("failed to delete checkpoint %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// Blobs returns the blob IDs of the given project paths in commit; absent paths are omitted
+func (r *Repo) Blobs(commit string, paths []string) (map[string]string, error) {
+	blobs := make(map[string]string)
+	if len(paths) == 0 {
+		return blobs, nil
+	}
+
+	args := []string{"ls-tree", "-r", "-z", "--full-tree", commit, "--"}
+	for _, p := range paths {
+		args = append(args, r.prefix+p)
+	}
+	out, err := git(r.root, nil, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoint files: %w", err)
+	}
+
+	// Each entry is "<mode> <type> <object>\t<path>"
+	for _, entry := range strings.Split(out, "\x00") {
+		meta, path, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 {
+			continue
+		}
+		blobs[strings.TrimPrefix(path, r.prefix)] = fields[2]
+	}
+	return blobs, nil
+}
+
+// WorkingBlobs returns the blob IDs the given project paths would have if committed now;
+// missing files are omitted
+func (r *Repo) WorkingBlobs(paths []string) (map[string]string, error) {
+	blobs := make(map[string]string)
+
+	var existing []string
+	for _, p := range paths {
+		if info, err := os.Stat(r.abs(p)); err == nil && info.Mode().IsRegular() {
+			existing = append(existing, p)
+		}
+	}
+	if len(existing) == 0 {
+		return blobs, nil
+	}
+
+	args := []string{"hash-object", "--"}
+	for _, p := range existing {
+		args = append(args, r.prefix+p)
+	}
+	out, err := git(r.root, nil, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash working files: %w", err)
+	}
+
+	ids := strings.Fields(out)
+	for i, p := range existing {
+		if i < len(ids) {
+			blobs[p] = ids[i]
+		}
+	}
+	return blobs, nil
+}
+
+// Restore writes the given project paths from commit into the working tree and
+// deletes the paths in remove. The index is left untouched.
+func (r *Repo) Restore(commit string, paths, remove []string) error {
+	if len(paths) > 0 {
+		args := []string{"restore", "--source=" + commit, "--worktree", "--"}
+		for _, p := range paths {
+			args = append(args, r.prefix+p)
+		}
+		if _, err := git(r.root, nil, args...); err != nil {
+			return fmt.Errorf("failed to restore files: %w", err)
+		}
+	}
+
+	for _, p := range remove {
+		if err := os.Remove(r.abs(p)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// abs returns the absolute path of a project path
+func (r *Repo) abs(path string) string {
+	return filepath.Join(r.root, filepath.FromSlash(r.prefix+path))
+}
+
+// authorEnv sets the checkpoint author so commits work without a configured git identity
+func authorEnv() []string {
+	return []string{
+		"GIT_AUTHOR_NAME=layrr",
+		"GIT_AUTHOR_EMAIL=layrr@localhost",
+		"GIT_COMMITTER_NAME=layrr",
+		"GIT_COMMITTER_EMAIL=layrr@localhost",
+	}
+}
+
+// git runs a git command in dir with extra environment variables and returns stdout
+func git(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,83 @@
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Root returns the top of the git work tree
+func (r *Repo) Root() string {
+	return r.root
+}
+
+// ProjectDir returns the project directory inside a work tree rooted at root
+func (r *Repo) ProjectDir(root string) string {
+	return filepath.Join(root, filepath.FromSlash(r.prefix))
+}
+
+// Resolve returns the commit a ref (e.g. "HEAD" or a branch name) points to
+func (r *Repo) Resolve(ref string) (string, error) {
+	out, err := git(r.root, nil, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown commit %q", ref)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// AddWorktree checks out commit into a new detached worktree at path
+func (r *Repo) AddWorktree(path, commit string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+	if _, err := git(r.root, nil, "worktree", "add", "--detach", path, commit); err != nil {
+		return fmt.Errorf("failed to add worktree: %w", err)
+	}
+	return nil
+}
+
+// RemoveWorktree deletes a worktree created by AddWorktree, including uncommitted changes
+func (r *Repo) RemoveWorktree(path string) error {
+	if _, err := git(r.root, nil, "worktree", "remove", "--force", path); err != nil {
+		// Fall back to deleting the directory and letting git forget it
+		if rmErr := os.RemoveAll(path); rmErr != nil {
+			return fmt.Errorf("failed to remove worktree: %w", err)
+		}
+		git(r.root, nil, "worktree", "prune")
+	}
+	return nil
+}
+
+// Diff returns a binary-safe patch of the project directory between two commits
+func (r *Repo) Diff(from, to string) (string, error) {
+	args := []string{"diff", "--binary", "--no-color", "--no-ext-diff", from, to}
+	if r.prefix != "" {
+		args = append(args, "--", r.prefix)
+	}
+	out, err := git(r.root, nil, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to diff checkpoints: %w", err)
+	}
+	return out, nil
+}
+
+// Apply applies a patch from Diff to the working tree without touching the index.
+// Nothing is changed if any hunk does not apply.
+func (r *Repo) Apply(patch string) error {
+	if strings.TrimSpace(patch) == "" {
+		return nil
+	}
+
+	cmd := exec.Command("git", "apply", "--whitespace=nowarn", "-")
+	cmd.Dir = r.root
+	cmd.Stdin = strings.NewReader(patch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("patch does not apply: %s", msg)
+		}
+		return fmt.Errorf("patch does not apply: %w", err)
+	}
+	return nil
+}
@@ -2,60 +2,170 @@ package claude
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
 	"sync"
 
-	tea "github.com/charmbracelet/bubbletea"
-	"github.com/thetronjohnson/layrr/internal/tui"
+	"github.com/thetronjohnson/layrr/internal/events"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
 )
 
+// maxStreamLine bounds a single stream-json line; tool results can carry whole files
+const maxStreamLine = 16 * 1024 * 1024
+
+// Permissions controls which tools Claude Code may use in --print mode.
+// Tools outside AllowedTools are denied because there is nobody to approve them.
+type Permissions struct {
+	AllowedTools    []string // --allowedTools (e.g. "Edit", "Bash(npm run:*)")
+	DisallowedTools []string // --disallowedTools
+	SkipAll         bool     // --dangerously-skip-permissions
+}
+
+// args returns the Claude Code CLI flags for the permissions
+func (p Permissions) args() []string {
+	if p.SkipAll {
+		args := []string{"--dangerously-skip-permissions"}
+		if len(p.DisallowedTools) > 0 {
+			args = append(args, "--disallowedTools", strings.Join(p.DisallowedTools, ","))
+		}
+		return args
+	}
+
+	var args []string
+	if len(p.AllowedTools) > 0 {
+		args = append(args, "--allowedTools", strings.Join(p.AllowedTools, ","))
+	}
+	if len(p.DisallowedTools) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(p.DisallowedTools, ","))
+	}
+	return args
+}
+
 // Manager manages Claude Code execution using --print mode
 type Manager struct {
-	claudePath string
-	projectDir string
-	mu         sync.Mutex
-	verbose    bool
-	program    *tea.Program // Bubble Tea program for sending events
+	claudePath  string
+	projectDir  string
+	permissions Permissions
+	model       string // --model; Claude Code's default if empty
+	mu          sync.Mutex
+	verbose     bool
+	bus         *events.Bus // Receives StreamMsg, FinishedMsg and SessionMsg
+
+	// sessionID is the Claude Code session resumed by follow-up instructions.
+	// Claude Code stores sessions per directory, so it is only resumed in sessionDir.
+	sessionID  string
+	sessionDir string
+	sessionMu  sync.Mutex
 }
 
-// NewManager creates a new manager for Claude Code
-func NewManager(projectDir, claudePath string, verbose bool) (*Manager, error) {
+// NewManager creates a new manager for Claude Code that publishes its progress on bus
+func NewManager(projectDir, claudePath string, permissions Permissions, bus *events.Bus, verbose bool) (*Manager, error) {
 	return &Manager{
-		claudePath: claudePath,
-		projectDir: projectDir,
-		verbose:    verbose,
+		claudePath:  claudePath,
+		projectDir:  projectDir,
+		permissions: permissions,
+		bus:         bus,
+		verbose:     verbose,
 	}, nil
 }
 
-// SetProgram sets the Bubble Tea program for sending UI updates
-func (m *Manager) SetProgram(p *tea.Program) {
-	m.program = p
+// Name identifies the backend
+func (m *Manager) Name() string {
+	return "claude"
+}
+
+// SetModel selects the model Claude Code runs with (empty for its default)
+func (m *Manager) SetModel(model string) {
+	m.model = model
+}
+
+// SessionID returns the current Claude Code session ID (empty if no session yet)
+func (m *Manager) SessionID() string {
+	m.sessionMu.Lock()
+	defer m.sessionMu.Unlock()
+	return m.sessionID
+}
+
+// ResetSession forgets the current session so the next instruction starts fresh
+func (m *Manager) ResetSession() {
+	m.sessionMu.Lock()
+	m.sessionID = ""
+	m.sessionMu.Unlock()
+
+	m.bus.Publish(SessionMsg{})
+}
+
+// setSessionID records the session ID reported by Claude Code for a run in dir
+func (m *Manager) setSessionID(id, dir string) {
+	m.sessionMu.Lock()
+	changed := m.sessionID != id
+	m.sessionID = id
+	m.sessionDir = dir
+	m.sessionMu.Unlock()
+
+	if changed {
+		m.bus.Publish(SessionMsg{SessionID: id})
+	}
 }
 
-// SendMessage sends a message to Claude Code using --print mode with streaming JSON output
-func (m *Manager) SendMessage(message string) error {
+// ErrCancelled is returned by SendMessage when the run was cancelled through its context
+var ErrCancelled = errors.New("Claude Code run cancelled")
+
+// SendMessage sends a message to Claude Code using --print mode with streaming JSON output.
+// Claude runs in dir (the project directory if empty). Cancelling ctx kills the whole
+// Claude Code process group. The returned slice lists the files Claude edited during
+// the run (relative to dir), which is also populated when the run was cancelled.
+func (m *Manager) SendMessage(ctx context.Context, dir, message string) ([]string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	// Don't start a run that was cancelled while waiting for the previous one
+	if ctx.Err() != nil {
+		return nil, ErrCancelled
+	}
+
 	// Run Claude Code with streaming JSON output
 	// --output-format stream-json: Outputs JSONL (one JSON object per line)
 	// --verbose: Required when using stream-json with --print
-	// --dangerously-skip-permissions: Skip permission prompts for automation
-	cmd := exec.Command(m.claudePath,
+	args := []string{
 		"--print", message,
 		"--output-format", "stream-json",
 		"--verbose",
-		"--dangerously-skip-permissions")
-	cmd.Dir = m.projectDir
+	}
+
+	// --allowedTools/--disallowedTools: Apply the project's permission policy
+	args = append(args, m.permissions.args()...)
+
+	// --model: Run with a specific model instead of Claude Code's default
+	if m.model != "" {
+		args = append(args, "--model", m.model)
+	}
+
+	// --resume: Continue the previous session so follow-up edits keep their context
+	if dir == "" {
+		dir = m.projectDir
+	}
+	resumed := m.resumableSession(dir)
+	if resumed != "" {
+		args = append(args, "--resume", resumed)
+	}
+
+	cmd := exec.CommandContext(ctx, m.claudePath, args...)
+	cmd.Dir = dir
 	cmd.Env = os.Environ()
 
+	// Cancellation also stops tools Claude spawned
+	killProcessGroup(cmd)
+
 	// Pipe stdout to read line-by-line JSONL output
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
 
 	// Discard stderr to keep terminal clean (only TUI output)
@@ -63,87 +173,95 @@ func (m *Manager) SendMessage(message string) error {
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start Claude Code: %w", err)
+		return nil, fmt.Errorf("failed to start Claude Code: %w", err)
 	}
 
 	// Read and parse JSONL output line by line
+	edited := make(map[string]bool)
 	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
 	for scanner.Scan() {
-		_ = m.handleStreamLine(scanner.Text()) // Silently skip unparseable lines
+		_ = m.handleStreamLine(scanner.Bytes(), dir, edited) // Silently skip unparseable lines
+	}
+	if err := scanner.Err(); err != nil && m.verbose {
+		fmt.Fprintf(os.Stderr, "[Claude] Failed to read stream output: %v\n", err)
 	}
 
 	// Wait for command to complete
 	waitErr := cmd.Wait()
 
-	// Always notify TUI that processing is done (success or error)
-	if m.program != nil {
-		if waitErr != nil {
-			// Send error event if command failed
-			m.program.Send(tui.StreamEvent{
-				Type:    "error",
-				Content: fmt.Sprintf("Exit code: %v", waitErr),
-			})
-		} else {
-			// Send completion event if command succeeded
-			m.program.Send(tui.StreamEvent{Type: "complete"})
-		}
+	editedFiles := make([]string, 0, len(edited))
+	for file := range edited {
+		editedFiles = append(editedFiles, snapshot.RelPath(dir, file))
 	}
+	sort.Strings(editedFiles)
 
-	// Return error if there was one
-	if waitErr != nil {
-		return fmt.Errorf("Claude Code execution failed: %w", waitErr)
+	// Cancellation takes precedence over the exit status of the killed process
+	var runErr error
+	switch {
+	case ctx.Err() != nil:
+		runErr = ErrCancelled
+	case waitErr != nil:
+		runErr = fmt.Errorf("Claude Code execution failed: %w", waitErr)
 	}
 
-	return nil
-}
+	// Always announce that processing is done (success, error or cancel)
+	m.bus.Publish(FinishedMsg{Files: editedFiles, Err: runErr})
 
-// handleStreamLine parses a single line of JSONL output from Claude Code and sends to TUI
-func (m *Manager) handleStreamLine(line string) error {
-	// Parse the JSON line
-	var event map[string]interface{}
-	if err := json.Unmarshal([]byte(line), &event); err != nil {
-		return fmt.Errorf("failed to parse JSON: %w", err)
+	// A failed resume usually means the session is gone; start fresh next time
+	if waitErr != nil && ctx.Err() == nil && resumed != "" && m.SessionID() == resumed {
+		m.ResetSession()
 	}
 
-	// Extract event type
-	eventType, ok := event["type"].(string)
-	if !ok {
-		return fmt.Errorf("missing or invalid 'type' field")
-	}
+	return editedFiles, runErr
+}
 
-	// Require TUI program to be set (fail fast)
-	if m.program == nil {
-		return fmt.Errorf("TUI program not initialized")
+// handleStreamLine parses a single line of JSONL output from Claude Code and publishes it.
+// Files touched by editing tools are recorded in edited.
+func (m *Manager) handleStreamLine(line []byte, dir string, edited map[string]bool) error {
+	event, err := ParseEvent(line)
+	if err != nil {
+		return err
 	}
 
-	// Build stream event
-	streamEvent := tui.StreamEvent{
-		Type: eventType,
-		Data: event,
+	// Capture the session ID from system/result events for --resume
+	if (event.Type == EventSystem || event.Type == EventResult) && event.SessionID != "" {
+		m.setSessionID(event.SessionID, dir)
 	}
 
-	// Extract content for specific event types
-	switch eventType {
-	case "content":
-		if content, ok := event["content"].(string); ok {
-			streamEvent.Content = content
-		}
-	case "tool_use":
-		if toolName, ok := event["name"].(string); ok {
-			streamEvent.Content = toolName
-		}
-	case "tool_result":
-		// Extract result content if available
-		if result, ok := event["content"].(string); ok {
-			streamEvent.Content = result
-		}
-	case "error":
-		if errMsg, ok := event["error"].(string); ok {
-			streamEvent.Content = errMsg
-		}
+	// Track files targeted by editing tools in assistant messages
+	for _, file := range event.EditedFiles() {
+		edited[file] = true
 	}
 
-	// Send to TUI
-	m.program.Send(streamEvent)
+	m.bus.Publish(StreamMsg{Event: event})
 	return nil
 }
+
+// resumableSession returns the session to resume for a run in dir (empty to start fresh)
+func (m *Manager) resumableSession(dir string) string {
+	m.sessionMu.Lock()
+	defer m.sessionMu.Unlock()
+	if m.sessionDir != dir {
+		return ""
+	}
+	return m.sessionID
+}
+
+// Events published on the bus
+
+// StreamMsg is sent for each event parsed from Claude Code's output
+type StreamMsg struct {
+	Event Event
+}
+
+// FinishedMsg is sent when a run ends; Err is nil on success and ErrCancelled when cancelled
+type FinishedMsg struct {
+	Files []string // Files edited during the run
+	Err   error
+}
+
+// SessionMsg is sent when the Claude Code session changes (empty ID = reset)
+type SessionMsg struct {
+	SessionID string
+}
@@ -0,0 +1,48 @@
+package claude
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPermissionsArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions Permissions
+		want        []string
+	}{
+		{
+			name: "allowed and disallowed",
+			permissions: Permissions{
+				AllowedTools:    []string{"Read", "Edit", "Bash(npm run:*)"},
+				DisallowedTools: []string{"Bash", "Edit(.layrr/**)"},
+			},
+			want: []string{"--allowedTools", "Read,Edit,Bash(npm run:*)", "--disallowedTools", "Bash,Edit(.layrr/**)"},
+		},
+		{
+			name:        "allowed only",
+			permissions: Permissions{AllowedTools: []string{"Read"}},
+			want:        []string{"--allowedTools", "Read"},
+		},
+		{
+			name:        "skip all",
+			permissions: Permissions{SkipAll: true, AllowedTools: []string{"Read"}},
+			want:        []string{"--dangerously-skip-permissions"},
+		},
+		{
+			name:        "skip all still denies",
+			permissions: Permissions{SkipAll: true, DisallowedTools: []string{"WebFetch"}},
+			want:        []string{"--dangerously-skip-permissions", "--disallowedTools", "WebFetch"},
+		},
+		{
+			name: "nothing",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.permissions.args(); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: args() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
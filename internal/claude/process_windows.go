@@ -0,0 +1,11 @@
+package claude
+
+import "os/exec"
+
+// killProcessGroup makes cancellation kill cmd. Windows has no process groups to signal, so
+// tools Claude spawned may outlive it.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		return cmd.Process.Kill()
+	}
+}
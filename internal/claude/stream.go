@@ -0,0 +1,257 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Event types emitted by `claude --print --output-format stream-json`
+const (
+	EventSystem    = "system"    // Session metadata (subtype "init" starts every run)
+	EventAssistant = "assistant" // Model output: text, thinking and tool calls
+	EventUser      = "user"      // Tool results fed back to the model
+	EventResult    = "result"    // Final summary with cost and usage
+)
+
+// Content block types inside assistant and user messages
+const (
+	BlockText       = "text"
+	BlockThinking   = "thinking"
+	BlockToolUse    = "tool_use"
+	BlockToolResult = "tool_result"
+)
+
+// Event is a single line of Claude Code stream-json output
+type Event struct {
+	Type      string `json:"type"`
+	Subtype   string `json:"subtype,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+
+	// system/init
+	Model          string   `json:"model,omitempty"`
+	CWD            string   `json:"cwd,omitempty"`
+	Tools          []string `json:"tools,omitempty"`
+	PermissionMode string   `json:"permissionMode,omitempty"`
+
+	// assistant and user
+	Message *Message `json:"message,omitempty"`
+
+	// result
+	Result       string  `json:"result,omitempty"`
+	IsError      bool    `json:"is_error,omitempty"`
+	NumTurns     int     `json:"num_turns,omitempty"`
+	DurationMS   int64   `json:"duration_ms,omitempty"`
+	TotalCostUSD float64 `json:"total_cost_usd,omitempty"`
+	Usage        *Usage  `json:"usage,omitempty"`
+}
+
+// Message is the API message carried by assistant and user events
+type Message struct {
+	ID      string         `json:"id,omitempty"`
+	Role    string         `json:"role,omitempty"`
+	Model   string         `json:"model,omitempty"`
+	Content []ContentBlock `json:"content"`
+	Usage   *Usage         `json:"usage,omitempty"`
+}
+
+// UnmarshalJSON accepts both block arrays and plain string content
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	var raw struct {
+		message
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*m = Message(raw.message)
+	blocks, err := parseContent(raw.Content)
+	if err != nil {
+		return fmt.Errorf("invalid message content: %w", err)
+	}
+	m.Content = blocks
+	return nil
+}
+
+// ContentBlock is one block of message content
+type ContentBlock struct {
+	Type string `json:"type"`
+
+	// text and thinking
+	Text     string `json:"text,omitempty"`
+	Thinking string `json:"thinking,omitempty"`
+
+	// tool_use
+	ID    string     `json:"id,omitempty"`
+	Name  string     `json:"name,omitempty"`
+	Input *ToolInput `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string         `json:"tool_use_id,omitempty"`
+	Content   []ContentBlock `json:"content,omitempty"`
+	IsError   bool           `json:"is_error,omitempty"`
+}
+
+// UnmarshalJSON accepts tool results whose content is a string or a block array
+func (b *ContentBlock) UnmarshalJSON(data []byte) error {
+	type block ContentBlock
+	var raw struct {
+		block
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*b = ContentBlock(raw.block)
+	blocks, err := parseContent(raw.Content)
+	if err != nil {
+		return fmt.Errorf("invalid %s content: %w", b.Type, err)
+	}
+	b.Content = blocks
+	return nil
+}
+
+// ResultText joins the text of a tool_result block
+func (b ContentBlock) ResultText() string {
+	var parts []string
+	for _, c := range b.Content {
+		if c.Type == BlockText && c.Text != "" {
+			parts = append(parts, c.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// ToolInput holds the tool call arguments Layrr cares about; Raw keeps the full input
+type ToolInput struct {
+	FilePath     string `json:"file_path,omitempty"`     // Read, Edit, MultiEdit, Write
+	NotebookPath string `json:"notebook_path,omitempty"` // NotebookEdit
+	Path         string `json:"path,omitempty"`          // Glob, Grep, LS
+	Pattern      string `json:"pattern,omitempty"`       // Glob, Grep
+	Command      string `json:"command,omitempty"`       // Bash
+	Description  string `json:"description,omitempty"`   // Bash, Task
+	URL          string `json:"url,omitempty"`           // WebFetch
+	Query        string `json:"query,omitempty"`         // WebSearch
+
+	Raw json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes the known fields and keeps the raw input
+func (in *ToolInput) UnmarshalJSON(data []byte) error {
+	type toolInput ToolInput
+	var known toolInput
+	if err := json.Unmarshal(data, &known); err != nil {
+		return err
+	}
+
+	*in = ToolInput(known)
+	in.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// MarshalJSON writes the full raw input when it is known, so recorded events keep every argument
+func (in ToolInput) MarshalJSON() ([]byte, error) {
+	if len(in.Raw) > 0 {
+		return in.Raw, nil
+	}
+	type toolInput ToolInput
+	return json.Marshal(toolInput(in))
+}
+
+// Target returns a short description of what the tool call acts on
+func (in *ToolInput) Target() string {
+	if in == nil {
+		return ""
+	}
+	for _, s := range []string{in.FilePath, in.NotebookPath, in.Command, in.Pattern, in.Path, in.URL, in.Query, in.Description} {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// Usage is the token accounting reported by the API
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// ParseEvent decodes one line of stream-json output
+func ParseEvent(line []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(line, &event); err != nil {
+		return Event{}, fmt.Errorf("failed to parse stream event: %w", err)
+	}
+	if event.Type == "" {
+		return Event{}, fmt.Errorf("missing 'type' field in stream event")
+	}
+	return event, nil
+}
+
+// Blocks returns the message content blocks of the given type
+func (e Event) Blocks(blockType string) []ContentBlock {
+	if e.Message == nil {
+		return nil
+	}
+
+	var blocks []ContentBlock
+	for _, block := range e.Message.Content {
+		if block.Type == blockType {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// EditedFiles returns the files targeted by editing tool calls in an assistant event
+func (e Event) EditedFiles() []string {
+	if e.Type != EventAssistant {
+		return nil
+	}
+
+	var files []string
+	for _, block := range e.Blocks(BlockToolUse) {
+		if !IsEditTool(block.Name) || block.Input == nil {
+			continue
+		}
+		if block.Input.FilePath != "" {
+			files = append(files, block.Input.FilePath)
+		} else if block.Input.NotebookPath != "" {
+			files = append(files, block.Input.NotebookPath)
+		}
+	}
+	return files
+}
+
+// IsEditTool reports whether a tool modifies files
+func IsEditTool(name string) bool {
+	switch name {
+	case "Edit", "MultiEdit", "Write", "NotebookEdit":
+		return true
+	}
+	return false
+}
+
+// parseContent decodes message content that is either a string or a block array
+func parseContent(data json.RawMessage) ([]ContentBlock, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return []ContentBlock{{Type: BlockText, Text: text}}, nil
+	}
+
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
@@ -0,0 +1,144 @@
+package claude
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+		check   func(t *testing.T, e Event)
+	}{
+		{
+			name: "system init",
+			line: `{"type":"system","subtype":"init","session_id":"abc","model":"claude-sonnet","cwd":"/p","tools":["Edit","Read"],"permissionMode":"default"}`,
+			check: func(t *testing.T, e Event) {
+				if e.Type != EventSystem || e.Subtype != "init" || e.SessionID != "abc" || e.Model != "claude-sonnet" || e.CWD != "/p" {
+					t.Errorf("event = %+v", e)
+				}
+				if !slices.Equal(e.Tools, []string{"Edit", "Read"}) {
+					t.Errorf("tools = %v", e.Tools)
+				}
+			},
+		},
+		{
+			name: "assistant text and tool call",
+			line: `{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"text","text":"Editing"},{"type":"tool_use","id":"t1","name":"Edit","input":{"file_path":"/p/src/App.jsx","old_string":"a","new_string":"b"}}]}}`,
+			check: func(t *testing.T, e Event) {
+				if len(e.Blocks(BlockText)) != 1 || e.Blocks(BlockText)[0].Text != "Editing" {
+					t.Errorf("text blocks = %+v", e.Blocks(BlockText))
+				}
+				tools := e.Blocks(BlockToolUse)
+				if len(tools) != 1 || tools[0].Name != "Edit" || tools[0].Input.Target() != "/p/src/App.jsx" {
+					t.Fatalf("tool blocks = %+v", tools)
+				}
+				var raw map[string]string
+				if err := json.Unmarshal(tools[0].Input.Raw, &raw); err != nil || raw["new_string"] != "b" {
+					t.Errorf("raw input = %s (%v)", tools[0].Input.Raw, err)
+				}
+				if files := e.EditedFiles(); !slices.Equal(files, []string{"/p/src/App.jsx"}) {
+					t.Errorf("edited files = %v", files)
+				}
+			},
+		},
+		{
+			name: "read is not an edit",
+			line: `{"type":"assistant","message":{"content":[{"type":"tool_use","name":"Read","input":{"file_path":"/p/a.js"}}]}}`,
+			check: func(t *testing.T, e Event) {
+				if files := e.EditedFiles(); len(files) != 0 {
+					t.Errorf("edited files = %v", files)
+				}
+			},
+		},
+		{
+			name: "notebook edit",
+			line: `{"type":"assistant","message":{"content":[{"type":"tool_use","name":"NotebookEdit","input":{"notebook_path":"/p/n.ipynb"}}]}}`,
+			check: func(t *testing.T, e Event) {
+				if files := e.EditedFiles(); !slices.Equal(files, []string{"/p/n.ipynb"}) {
+					t.Errorf("edited files = %v", files)
+				}
+			},
+		},
+		{
+			name: "tool result with string content",
+			line: `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"The file was updated","is_error":true}]}}`,
+			check: func(t *testing.T, e Event) {
+				results := e.Blocks(BlockToolResult)
+				if len(results) != 1 || results[0].ResultText() != "The file was updated" || !results[0].IsError {
+					t.Errorf("results = %+v", results)
+				}
+			},
+		},
+		{
+			name: "tool result with block content",
+			line: `{"type":"user","message":{"content":[{"type":"tool_result","content":[{"type":"text","text":"one"},{"type":"text","text":"two"}]}]}}`,
+			check: func(t *testing.T, e Event) {
+				results := e.Blocks(BlockToolResult)
+				if len(results) != 1 || results[0].ResultText() != "one\ntwo" {
+					t.Errorf("results = %+v", results)
+				}
+			},
+		},
+		{
+			name: "plain string message",
+			line: `{"type":"user","message":{"role":"user","content":"hello"}}`,
+			check: func(t *testing.T, e Event) {
+				if blocks := e.Blocks(BlockText); len(blocks) != 1 || blocks[0].Text != "hello" {
+					t.Errorf("text blocks = %+v", blocks)
+				}
+			},
+		},
+		{
+			name: "result",
+			line: `{"type":"result","subtype":"success","session_id":"abc","num_turns":3,"duration_ms":1200,"total_cost_usd":0.05,"usage":{"input_tokens":10,"output_tokens":20}}`,
+			check: func(t *testing.T, e Event) {
+				if e.NumTurns != 3 || e.DurationMS != 1200 || e.TotalCostUSD != 0.05 || e.Usage == nil || e.Usage.OutputTokens != 20 {
+					t.Errorf("event = %+v", e)
+				}
+			},
+		},
+		{name: "missing type", line: `{"subtype":"init"}`, wantErr: true},
+		{name: "not JSON", line: `Claude Code v1.0`, wantErr: true},
+		{name: "bad content", line: `{"type":"assistant","message":{"content":42}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := ParseEvent([]byte(tt.line))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseEvent() = %+v, want an error", event)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEvent() error = %v", err)
+			}
+			tt.check(t, event)
+		})
+	}
+}
+
+func TestToolInputKeepsRawArguments(t *testing.T) {
+	event, err := ParseEvent([]byte(`{"type":"assistant","message":{"content":[{"type":"tool_use","name":"Write","input":{"file_path":"/p/a.js","content":"x"}}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParseEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(again.Message.Content[0].Input.Raw, &raw); err != nil || raw["content"] != "x" {
+		t.Errorf("re-encoded input = %s (%v)", again.Message.Content[0].Input.Raw, err)
+	}
+}
@@ -3,17 +3,28 @@ package config
 import (
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
 )
 
 // Config holds the application configuration
 type Config struct {
 	ProxyPort       int
 	TargetPort      int
+	Target          *url.URL // Dev server to proxy (from -target, or http://localhost:<TargetPort>)
+	TargetInsecure  bool     // Skip TLS certificate verification for an HTTPS target
+	HTTPS           bool     // Serve the proxy over HTTPS with a generated local certificate
 	ProjectDir      string
 	ClaudeCodePath  string
 	AutoDetectPort  bool
 	Verbose         bool
+	Agent           string // Coding agent backend: "claude" or "scripted"
+	AgentFixture    string // Fixture replayed by the scripted agent
+	Worktree        bool   // Run each instruction in a temporary git worktree for review
+	Run             string // Shell command that starts the dev server, supervised by layrr
+	LAN             bool   // Listen on all interfaces instead of loopback only
+	Token           string // Session token from LAYRR_TOKEN; generated per run if empty
 }
 
 // ParseFlags parses command line flags and returns the configuration
@@ -22,19 +33,75 @@ func ParseFlags() (*Config, error) {
 
 	flag.IntVar(&config.ProxyPort, "proxy-port", 9999, "Port for the proxy server")
 	flag.IntVar(&config.TargetPort, "target-port", 0, "Target dev server port (0 = auto-detect)")
+	target := flag.String("target", "", "Target dev server URL, e.g. https://app.docker:8443/admin/ (instead of -target-port)")
+	flag.BoolVar(&config.TargetInsecure, "target-insecure", false, "Don't verify the target's TLS certificate (self-signed dev certs)")
+	flag.BoolVar(&config.HTTPS, "https", false, "Serve the proxy over HTTPS with a locally generated certificate")
+	flag.BoolVar(&config.LAN, "lan", false, "Let other devices on the network use the proxy (it only listens on localhost by default)")
 	flag.StringVar(&config.ProjectDir, "dir", ".", "Project directory")
 	flag.StringVar(&config.ClaudeCodePath, "claude-path", "claude", "Path to Claude Code binary")
 	flag.BoolVar(&config.Verbose, "verbose", false, "Enable verbose logging")
+	flag.StringVar(&config.Agent, "agent", "claude", "Coding agent backend (claude, scripted)")
+	flag.StringVar(&config.AgentFixture, "agent-fixture", "", "Fixture file replayed by the scripted agent")
+	flag.BoolVar(&config.Worktree, "worktree", false, "Run each instruction in a temporary git worktree and apply it on approval; each starts a new Claude Code session")
+	flag.StringVar(&config.Run, "run", "", "Command that starts the dev server, e.g. \"npm run dev\" (default: a package.json script, if no dev server is running)")
 
 	flag.Parse()
 
-	// Auto-detect if target port is not specified
-	config.AutoDetectPort = config.TargetPort == 0
+	// A target URL replaces the port; auto-detect if neither is specified
+	switch {
+	case *target != "" && config.TargetPort != 0:
+		return nil, fmt.Errorf("use either -target or -target-port, not both")
+	case *target != "":
+		u, err := ParseTarget(*target)
+		if err != nil {
+			return nil, err
+		}
+		config.Target = u
+	case config.TargetPort != 0:
+		config.Target = &url.URL{Scheme: "http", Host: fmt.Sprintf("localhost:%d", config.TargetPort), Path: "/"}
+	}
+	config.AutoDetectPort = config.Target == nil
 
 	// Validate project directory
 	if _, err := os.Stat(config.ProjectDir); os.IsNotExist(err) {
 		return nil, fmt.Errorf("project directory does not exist: %s", config.ProjectDir)
 	}
 
+	// A fixed token lets scripts keep calling the HTTP API across restarts
+	config.Token = os.Getenv("LAYRR_TOKEN")
+
+	// The local CA may only sign for this machine, so other devices couldn't use the certificate
+	if config.HTTPS && config.LAN {
+		return nil, fmt.Errorf("-https can't be combined with -lan: the certificate only covers localhost")
+	}
+
+	// The scripted agent has nothing to replay without a fixture
+	if config.Agent == "scripted" && config.AgentFixture == "" {
+		return nil, fmt.Errorf("-agent scripted requires -agent-fixture")
+	}
+
 	return config, nil
 }
+
+// ParseTarget parses a -target URL. The scheme defaults to http, and the path is where
+// the browser starts (requests are proxied with their path unchanged).
+func ParseTarget(raw string) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -target %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid -target %q: scheme must be http or https", raw)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid -target %q: missing host", raw)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment = ""
+	return u, nil
+}
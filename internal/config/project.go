@@ -0,0 +1,207 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ProjectConfigDir is the per-project directory for Layrr state and settings
+const ProjectConfigDir = ".layrr"
+
+// ProjectConfig represents the structure of .layrr/config.json
+type ProjectConfig struct {
+	Permissions PermissionPolicy `json:"permissions"`
+}
+
+// PermissionPolicy selects which tools the coding agent may use.
+// AllowedTools and DisallowedTools extend the preset; disallowed entries win.
+type PermissionPolicy struct {
+	Preset          string   `json:"preset"`
+	AllowedTools    []string `json:"allowedTools,omitempty"`
+	DisallowedTools []string `json:"disallowedTools,omitempty"`
+}
+
+// Permission presets
+const (
+	PresetEditOnly     = "edit-only"    // Read and edit files, nothing else (default)
+	PresetNoBash       = "no-bash"      // Everything except shell commands
+	PresetNPMScripts   = "npm-scripts"  // Edit-only plus `npm run` / `npm test`
+	PresetUnrestricted = "unrestricted" // Skip all permission checks
+)
+
+// DefaultPermissionPreset is used when the project doesn't configure a policy
+const DefaultPermissionPreset = PresetEditOnly
+
+var (
+	readTools = []string{"Read", "Glob", "Grep", "LS", "TodoWrite"}
+	editTools = []string{"Edit", "MultiEdit", "Write", "NotebookEdit"}
+
+	// The agent mustn't edit layrr's own settings and templates: it could switch the
+	// project to unrestricted or put instructions into every later prompt
+	configEdits = []string{
+		"Edit(" + ProjectConfigDir + "/**)",
+		"MultiEdit(" + ProjectConfigDir + "/**)",
+		"Write(" + ProjectConfigDir + "/**)",
+		"NotebookEdit(" + ProjectConfigDir + "/**)",
+	}
+)
+
+// presets maps preset names to their allowed and disallowed tools
+var presets = map[string]struct{ allowed, disallowed []string }{
+	PresetEditOnly: {
+		allowed:    concat(readTools, editTools),
+		disallowed: concat([]string{"Bash", "WebFetch", "WebSearch"}, configEdits),
+	},
+	PresetNoBash: {
+		allowed:    concat(readTools, editTools, []string{"WebFetch", "WebSearch", "Task"}),
+		disallowed: concat([]string{"Bash"}, configEdits),
+	},
+	PresetNPMScripts: {
+		allowed:    concat(readTools, editTools, []string{"Bash(npm run:*)", "Bash(npm test:*)"}),
+		disallowed: concat([]string{"WebFetch", "WebSearch"}, configEdits),
+	},
+	PresetUnrestricted: {},
+}
+
+// ResolvedPermissions is a permission policy with its preset expanded
+type ResolvedPermissions struct {
+	Preset          string
+	AllowedTools    []string
+	DisallowedTools []string
+	SkipAll         bool // Bypass permission checks entirely
+}
+
+// IgnoreLocalFiles lists files in .layrr/.gitignore, creating it if needed, so git status
+// and checkpoints leave them alone. Names are relative to the .layrr directory.
+func IgnoreLocalFiles(projectDir string, names ...string) error {
+	dir := filepath.Join(projectDir, ProjectConfigDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	ignore := filepath.Join(dir, ".gitignore")
+	data, err := os.ReadFile(ignore)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", ignore, err)
+	}
+	content := string(data)
+	if content == "" {
+		content = "# Written by layrr: local history and temporary files\n"
+	}
+
+	listed := strings.Split(content, "\n")
+	added := false
+	for _, name := range names {
+		if slices.Contains(listed, name) {
+			continue
+		}
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		content += name + "\n"
+		added = true
+	}
+	if !added && data != nil {
+		return nil
+	}
+	if err := os.WriteFile(ignore, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", ignore, err)
+	}
+	return nil
+}
+
+// LoadProjectConfig reads .layrr/config.json from the project directory.
+// A missing file yields the default configuration.
+func LoadProjectConfig(projectDir string) (*ProjectConfig, error) {
+	cfg := &ProjectConfig{}
+
+	path := filepath.Join(projectDir, ProjectConfigDir, "config.json")
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		cfg.Permissions.Preset = DefaultPermissionPreset
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if cfg.Permissions.Preset == "" {
+		cfg.Permissions.Preset = DefaultPermissionPreset
+	}
+	if _, err := cfg.Permissions.Resolve(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Resolve expands the preset and applies the custom tool lists
+func (p PermissionPolicy) Resolve() (ResolvedPermissions, error) {
+	name := p.Preset
+	if name == "" {
+		name = DefaultPermissionPreset
+	}
+
+	preset, ok := presets[name]
+	if !ok {
+		names := make([]string, 0, len(presets))
+		for n := range presets {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return ResolvedPermissions{}, fmt.Errorf("unknown permission preset %q (expected one of: %s)", name, strings.Join(names, ", "))
+	}
+
+	resolved := ResolvedPermissions{
+		Preset:          name,
+		DisallowedTools: concat(preset.disallowed, p.DisallowedTools),
+		SkipAll:         name == PresetUnrestricted,
+	}
+
+	// Disallowed tools win over allowed ones
+	denied := make(map[string]bool)
+	for _, tool := range resolved.DisallowedTools {
+		denied[tool] = true
+	}
+	for _, tool := range concat(preset.allowed, p.AllowedTools) {
+		if !denied[tool] {
+			resolved.AllowedTools = append(resolved.AllowedTools, tool)
+		}
+	}
+
+	return resolved, nil
+}
+
+// String describes the policy for startup output
+func (r ResolvedPermissions) String() string {
+	if r.SkipAll {
+		return r.Preset + " (all tools, no permission checks)"
+	}
+
+	desc := r.Preset
+	if len(r.AllowedTools) > 0 {
+		desc += " · allowed: " + strings.Join(r.AllowedTools, ", ")
+	}
+	if len(r.DisallowedTools) > 0 {
+		desc += " · denied: " + strings.Join(r.DisallowedTools, ", ")
+	}
+	return desc
+}
+
+// concat joins string slices into a new slice
+func concat(lists ...[]string) []string {
+	var out []string
+	for _, list := range lists {
+		out = append(out, list...)
+	}
+	return out
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         PermissionPolicy
+		wantPreset     string
+		wantSkipAll    bool
+		wantAllowed    []string // Must be allowed
+		notAllowed     []string // Must not be allowed
+		wantDisallowed []string // Must be denied
+		notDisallowed  []string // Must not be denied
+	}{
+		{
+			name:           "default",
+			wantPreset:     PresetEditOnly,
+			wantAllowed:    []string{"Read", "Edit", "Write"},
+			notAllowed:     []string{"Bash", "WebFetch"},
+			wantDisallowed: []string{"Bash", "WebFetch", "Edit(.layrr/**)", "Write(.layrr/**)"},
+		},
+		{
+			name:           "no-bash",
+			policy:         PermissionPolicy{Preset: PresetNoBash},
+			wantPreset:     PresetNoBash,
+			wantAllowed:    []string{"Edit", "WebFetch", "Task"},
+			wantDisallowed: []string{"Bash", "MultiEdit(.layrr/**)"},
+		},
+		{
+			name:           "npm-scripts",
+			policy:         PermissionPolicy{Preset: PresetNPMScripts},
+			wantPreset:     PresetNPMScripts,
+			wantAllowed:    []string{"Edit", "Bash(npm run:*)", "Bash(npm test:*)"},
+			notAllowed:     []string{"Bash"},
+			wantDisallowed: []string{"WebFetch", "Edit(.layrr/**)"},
+		},
+		{
+			name:          "unrestricted",
+			policy:        PermissionPolicy{Preset: PresetUnrestricted},
+			wantPreset:    PresetUnrestricted,
+			wantSkipAll:   true,
+			notDisallowed: []string{"Edit(.layrr/**)"},
+		},
+		{
+			name: "custom lists extend the preset",
+			policy: PermissionPolicy{
+				AllowedTools:    []string{"Bash(npx prettier:*)"},
+				DisallowedTools: []string{"Write"},
+			},
+			wantPreset:     PresetEditOnly,
+			wantAllowed:    []string{"Edit", "Bash(npx prettier:*)"},
+			notAllowed:     []string{"Write"},
+			wantDisallowed: []string{"Bash", "Write", "Write(.layrr/**)"},
+		},
+		{
+			name: "disallowed wins over allowed",
+			policy: PermissionPolicy{
+				Preset:          PresetNoBash,
+				AllowedTools:    []string{"Bash"},
+				DisallowedTools: []string{"WebSearch"},
+			},
+			wantPreset:     PresetNoBash,
+			notAllowed:     []string{"Bash", "WebSearch"},
+			wantDisallowed: []string{"Bash", "WebSearch"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Resolve()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Preset != tt.wantPreset || got.SkipAll != tt.wantSkipAll {
+				t.Errorf("preset = %s, skip all = %v", got.Preset, got.SkipAll)
+			}
+			for _, tool := range tt.wantAllowed {
+				if !slices.Contains(got.AllowedTools, tool) {
+					t.Errorf("%s isn't allowed: %v", tool, got.AllowedTools)
+				}
+			}
+			for _, tool := range tt.notAllowed {
+				if slices.Contains(got.AllowedTools, tool) {
+					t.Errorf("%s is allowed: %v", tool, got.AllowedTools)
+				}
+			}
+			for _, tool := range tt.wantDisallowed {
+				if !slices.Contains(got.DisallowedTools, tool) {
+					t.Errorf("%s isn't denied: %v", tool, got.DisallowedTools)
+				}
+			}
+			for _, tool := range tt.notDisallowed {
+				if slices.Contains(got.DisallowedTools, tool) {
+					t.Errorf("%s is denied: %v", tool, got.DisallowedTools)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveProtectsConfig(t *testing.T) {
+	for name := range presets {
+		if name == PresetUnrestricted {
+			continue
+		}
+		got, err := PermissionPolicy{Preset: name}.Resolve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tool := range configEdits {
+			if !slices.Contains(got.DisallowedTools, tool) {
+				t.Errorf("%s doesn't deny %s", name, tool)
+			}
+		}
+	}
+}
+
+func TestResolveUnknownPreset(t *testing.T) {
+	_, err := PermissionPolicy{Preset: "yolo"}.Resolve()
+	if err == nil || !strings.Contains(err.Error(), `"yolo"`) || !strings.Contains(err.Error(), PresetEditOnly) {
+		t.Errorf("Resolve() = %v", err)
+	}
+}
+
+func TestLoadProjectConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	// No config yet
+	cfg, err := LoadProjectConfig(dir)
+	if err != nil || cfg.Permissions.Preset != DefaultPermissionPreset {
+		t.Errorf("LoadProjectConfig() without a file = %+v, %v", cfg, err)
+	}
+
+	path := filepath.Join(dir, ProjectConfigDir, "config.json")
+	os.MkdirAll(filepath.Dir(path), 0755)
+
+	os.WriteFile(path, []byte(`{"permissions":{"allowedTools":["Bash(npx prettier:*)"]}}`), 0644)
+	cfg, err = LoadProjectConfig(dir)
+	if err != nil || cfg.Permissions.Preset != DefaultPermissionPreset || len(cfg.Permissions.AllowedTools) != 1 {
+		t.Errorf("LoadProjectConfig() = %+v, %v", cfg, err)
+	}
+
+	os.WriteFile(path, []byte(`{"permissions":{"preset":"yolo"}}`), 0644)
+	if _, err := LoadProjectConfig(dir); err == nil {
+		t.Error("LoadProjectConfig() accepted an unknown preset")
+	}
+
+	os.WriteFile(path, []byte(`{"permissions":`), 0644)
+	if _, err := LoadProjectConfig(dir); err == nil {
+		t.Error("LoadProjectConfig() accepted malformed JSON")
+	}
+}
+
+func TestIgnoreLocalFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := IgnoreLocalFiles(dir, "history.jsonl"); err != nil {
+		t.Fatal(err)
+	}
+	if err := IgnoreLocalFiles(dir, "history.jsonl", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ProjectConfigDir, ".gitignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || lines[1] != "history.jsonl" || lines[2] != "token" {
+		t.Errorf(".gitignore = %q", data)
+	}
+}
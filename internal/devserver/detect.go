@@ -0,0 +1,67 @@
+package devserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// scripts are the package.json scripts that start a dev server, in order of preference
+var scripts = []string{"dev", "start", "serve", "develop"}
+
+// lockfiles map lockfiles to the package manager that wrote them, in order of preference
+var lockfiles = []struct {
+	file    string
+	manager string
+}{
+	{"pnpm-lock.yaml", "pnpm"},
+	{"yarn.lock", "yarn"},
+	{"bun.lock", "bun"},
+	{"bun.lockb", "bun"},
+	{"package-lock.json", "npm"},
+}
+
+// packageJSON is the part of package.json used for detection
+type packageJSON struct {
+	Scripts        map[string]string `json:"scripts"`
+	PackageManager string            `json:"packageManager"` // e.g. "pnpm@9.1.0"
+}
+
+// Detect works out the command that starts the project's dev server from the scripts in
+// package.json and the package manager (the packageManager field, or the lockfile)
+func Detect(projectDir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(projectDir, "package.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("no package.json in %s", projectDir)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read package.json: %w", err)
+	}
+	var pkg packageJSON
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return "", fmt.Errorf("failed to parse package.json: %w", err)
+	}
+
+	for _, script := range scripts {
+		if pkg.Scripts[script] != "" {
+			return packageManager(projectDir, pkg) + " run " + script, nil
+		}
+	}
+	return "", fmt.Errorf("package.json has none of the scripts %s", strings.Join(scripts, ", "))
+}
+
+// packageManager returns the package manager the project uses (npm if nothing says otherwise)
+func packageManager(projectDir string, pkg packageJSON) string {
+	if name, _, _ := strings.Cut(pkg.PackageManager, "@"); name != "" {
+		return name
+	}
+	for _, lock := range lockfiles {
+		if _, err := os.Stat(filepath.Join(projectDir, lock.file)); err == nil {
+			return lock.manager
+		}
+	}
+	return "npm"
+}
@@ -0,0 +1,30 @@
+package devserver
+
+import "time"
+
+// Events published by the dev server supervisor on its bus
+
+// State is where the supervised dev server is in its lifecycle
+type State string
+
+const (
+	Starting State = "starting" // Spawned, not accepting connections yet
+	Ready    State = "ready"    // Accepting connections at URL
+	Crashed  State = "crashed"  // Exited on its own; restarting after RestartIn
+	Stopped  State = "stopped"  // Stopped by layrr
+)
+
+// LogMsg is published for every line the dev server writes to stdout or stderr
+type LogMsg struct {
+	Line string // Without color codes
+}
+
+// StateMsg is published when the dev server changes state
+type StateMsg struct {
+	State     State
+	Command   string
+	URL       string        // Where it listens, once known
+	Err       error         // Why it crashed
+	RestartIn time.Duration // Delay before the restart after a crash
+	Restarts  int           // Restarts so far
+}
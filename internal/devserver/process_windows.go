@@ -0,0 +1,17 @@
+package devserver
+
+import "os/exec"
+
+// setProcessGroup does nothing: Windows has no process groups to signal, so what the
+// package manager spawned may outlive the dev server
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminate ends cmd; Windows can't ask a console process to exit
+func terminate(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// kill ends cmd
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
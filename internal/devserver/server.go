@@ -0,0 +1,342 @@
+package devserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/thetronjohnson/layrr/internal/events"
+)
+
+const (
+	minBackoff  = time.Second
+	maxBackoff  = 30 * time.Second
+	stableRun   = time.Minute     // A run this long resets the restart backoff
+	stopTimeout = 5 * time.Second // Grace period between SIGTERM and SIGKILL
+)
+
+var (
+	ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+	urlPattern  = regexp.MustCompile(`https?://[^\s"'<>()]+`)
+)
+
+// Server runs a dev server command as a child process, restarts it when it crashes and
+// publishes its output and state on the bus
+type Server struct {
+	command string
+	dir     string
+	bus     *events.Bus
+
+	mu        sync.Mutex
+	target    *url.URL // Where the dev server is expected (nil: the URL it prints)
+	url       *url.URL // Listening URL printed by the current run
+	cmd       *exec.Cmd
+	restarts  int
+	started   bool
+	stopping  bool
+	readyOnce sync.Once
+	ready     chan struct{} // Closed the first time the dev server accepts connections
+	wake      chan struct{} // Closed by Stop to cut a restart delay short
+	done      chan struct{} // Closed when supervision ends
+}
+
+// New creates a supervisor for a shell command run in dir
+func New(command, dir string, bus *events.Bus) *Server {
+	return &Server{
+		command: command,
+		dir:     dir,
+		bus:     bus,
+		ready:   make(chan struct{}),
+		wake:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Command returns the command the dev server runs with
+func (s *Server) Command() string {
+	return s.command
+}
+
+// SetTarget makes readiness checks use u instead of the URL the dev server prints
+func (s *Server) SetTarget(u *url.URL) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.target = u
+}
+
+// URL returns where the dev server listens: the target, or the URL the current run printed
+// (nil until it prints one)
+func (s *Server) URL() *url.URL {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.target != nil {
+		return s.target
+	}
+	return s.url
+}
+
+// Start spawns the dev server and keeps it running until Stop
+func (s *Server) Start() error {
+	cmd, exited, err := s.spawn()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.started = true
+	s.mu.Unlock()
+	go s.supervise(cmd, exited)
+	return nil
+}
+
+// Ready waits until the dev server accepts connections and returns its URL
+func (s *Server) Ready(ctx context.Context) (*url.URL, error) {
+	select {
+	case <-s.ready:
+		return s.URL(), nil
+	case <-s.done:
+		return nil, fmt.Errorf("dev server stopped before it was ready")
+	case <-ctx.Done():
+		if s.URL() == nil {
+			return nil, fmt.Errorf("dev server didn't print the URL it listens on (use -target-port or -target)")
+		}
+		return nil, fmt.Errorf("dev server isn't accepting connections at %s", s.URL())
+	}
+}
+
+// Stop ends the dev server and everything it spawned: SIGTERM to its process group, then
+// SIGKILL if it's still running after a grace period. Stopping a nil Server does nothing.
+func (s *Server) Stop() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return
+	}
+	if !s.stopping {
+		s.stopping = true
+		close(s.wake)
+	}
+	cmd := s.cmd
+	s.mu.Unlock()
+
+	if cmd != nil {
+		terminate(cmd)
+	}
+	select {
+	case <-s.done:
+	case <-time.After(stopTimeout):
+		if cmd != nil {
+			kill(cmd)
+		}
+		<-s.done
+	}
+}
+
+// spawn starts one run of the dev server. exited is closed when the run ends.
+func (s *Server) spawn() (*exec.Cmd, chan struct{}, error) {
+	cmd := exec.Command("sh", "-c", s.command)
+	cmd.Dir = s.dir
+	// Layrr opens the browser on the proxy; dev servers that honor BROWSER shouldn't open their own
+	cmd.Env = append(os.Environ(), "BROWSER=none")
+
+	setProcessGroup(cmd)
+
+	// stdout and stderr share a pipe so lines keep their order
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output pipe: %w", err)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return nil, nil, fmt.Errorf("failed to start dev server: %w", err)
+	}
+	w.Close()
+
+	s.mu.Lock()
+	s.cmd = cmd
+	s.url = nil
+	s.mu.Unlock()
+	s.publishState(Starting, nil, 0)
+
+	exited := make(chan struct{})
+	go s.readOutput(r)
+	go s.waitReady(exited)
+	return cmd, exited, nil
+}
+
+// supervise waits for each run to end and restarts the dev server, backing off while it keeps crashing
+func (s *Server) supervise(cmd *exec.Cmd, exited chan struct{}) {
+	defer close(s.done)
+
+	backoff := minBackoff
+	var err error
+	for {
+		started := time.Now()
+		if cmd != nil {
+			err = cmd.Wait()
+			close(exited)
+			// Leftover children would keep the port busy for the next run
+			kill(cmd)
+			if err == nil {
+				err = errors.New("exited")
+			}
+		}
+
+		if s.isStopping() {
+			s.publishState(Stopped, nil, 0)
+			return
+		}
+		if cmd != nil && time.Since(started) > stableRun {
+			backoff = minBackoff
+		}
+		s.mu.Lock()
+		s.restarts++
+		s.mu.Unlock()
+		s.publishState(Crashed, err, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-s.wake:
+			s.publishState(Stopped, nil, 0)
+			return
+		}
+		backoff = min(backoff*2, maxBackoff)
+
+		// A failed spawn counts as a crash
+		cmd, exited, err = s.spawn()
+		if err != nil {
+			cmd = nil
+		}
+	}
+}
+
+// readOutput publishes the dev server's output line by line and picks up its URL
+func (s *Server) readOutput(r *os.File) {
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := ansiPattern.ReplaceAllString(scanner.Text(), "")
+		s.bus.Publish(LogMsg{Line: line})
+
+		if u := ListeningURL(line); u != nil {
+			s.mu.Lock()
+			if s.url == nil {
+				s.url = u
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// waitReady polls until the current run accepts connections, then publishes Ready
+func (s *Server) waitReady(exited chan struct{}) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if u := s.URL(); u != nil && reachable(u) {
+			s.publishState(Ready, nil, 0)
+			s.readyOnce.Do(func() { close(s.ready) })
+			return
+		}
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// isStopping reports whether Stop was called
+func (s *Server) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
+
+// publishState publishes the current state
+func (s *Server) publishState(state State, err error, restartIn time.Duration) {
+	msg := StateMsg{State: state, Command: s.command, Err: err, RestartIn: restartIn}
+	if u := s.URL(); u != nil {
+		msg.URL = u.String()
+	}
+	s.mu.Lock()
+	msg.Restarts = s.restarts
+	s.mu.Unlock()
+	s.bus.Publish(msg)
+}
+
+// ListeningURL finds the URL a dev server says it listens on in a line of its output,
+// e.g. "➜  Local:   http://localhost:5173/". URLs of other sites (docs, telemetry) are
+// skipped by requiring a local host or an explicit port; wildcard hosts become localhost.
+func ListeningURL(line string) *url.URL {
+	for _, match := range urlPattern.FindAllString(ansiPattern.ReplaceAllString(line, ""), -1) {
+		u, err := url.Parse(trimTrailing(match))
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		switch u.Hostname() {
+		case "0.0.0.0", "::":
+			port := u.Port()
+			u.Host = "localhost"
+			if port != "" {
+				u.Host = net.JoinHostPort("localhost", port)
+			}
+		case "localhost", "127.0.0.1", "::1":
+		default:
+			if u.Port() == "" {
+				continue
+			}
+		}
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		return u
+	}
+	return nil
+}
+
+// trimTrailing drops punctuation that ends a sentence rather than the URL
+func trimTrailing(s string) string {
+	for len(s) > 0 {
+		switch s[len(s)-1] {
+		case '.', ',', ';', ':', '!', '*':
+			s = s[:len(s)-1]
+		default:
+			return s
+		}
+	}
+	return s
+}
+
+// reachable reports whether something accepts connections at u
+func reachable(u *url.URL) bool {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,34 @@
+package devserver
+
+import "testing"
+
+func TestListeningURL(t *testing.T) {
+	tests := []struct {
+		line string
+		want string // Empty for none
+	}{
+		{"  ➜  Local:   http://localhost:5173/", "http://localhost:5173/"},
+		{"\x1b[32m  ➜\x1b[39m  \x1b[1mLocal\x1b[22m:   \x1b[36mhttp://localhost:\x1b[1m5173\x1b[22m/\x1b[39m", "http://localhost:5173/"},
+		{"- Local:        http://localhost:3000", "http://localhost:3000/"},
+		{"ready - started server on 0.0.0.0:3000, url: http://0.0.0.0:3000", "http://localhost:3000/"},
+		{"Listening on http://[::]:8080.", "http://localhost:8080/"},
+		{"Server running at https://127.0.0.1:4321/app/", "https://127.0.0.1:4321/app/"},
+		{"  Network: http://192.168.1.20:5173/", "http://192.168.1.20:5173/"},
+		{"Local: http://[::1]:5173/", "http://[::1]:5173/"},
+		{"See https://vitejs.dev/config/ for more", ""},
+		{"Learn more: https://nextjs.org/telemetry then http://localhost:3000", "http://localhost:3000/"},
+		{"(http://localhost:4200)", "http://localhost:4200/"},
+		{"compiled successfully", ""},
+	}
+
+	for _, tt := range tests {
+		u := ListeningURL(tt.line)
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != tt.want {
+			t.Errorf("ListeningURL(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package events
+
+import "sync"
+
+// Bus is an in-process publish/subscribe hub for job lifecycle and agent stream events.
+//
+// Events are the message types of the packages that publish them (e.g. claude.StreamMsg,
+// bridge.JobMsg). Every subscriber gets every event, in publish order, on its own goroutine,
+// so a slow subscriber (a busy TUI, a stalled WebSocket) never holds up publishers or the
+// other subscribers. A nil Bus drops everything published to it.
+type Bus struct {
+	mu   sync.Mutex
+	subs []*subscriber
+}
+
+// New creates an empty bus
+func New() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls fn with every event published from now on and returns a function that
+// stops the subscription. Events still queued for fn are dropped when it stops.
+func (b *Bus) Subscribe(fn func(event any)) (unsubscribe func()) {
+	s := &subscriber{fn: fn}
+	s.cond = sync.NewCond(&s.mu)
+
+	b.mu.Lock()
+	b.subs = append(b.subs, s)
+	b.mu.Unlock()
+
+	go s.run()
+
+	return func() {
+		b.mu.Lock()
+		for i, sub := range b.subs {
+			if sub == s {
+				b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+				break
+			}
+		}
+		b.mu.Unlock()
+		s.stop()
+	}
+}
+
+// Publish queues an event for every subscriber and returns without waiting for them
+func (b *Bus) Publish(event any) {
+	if b == nil {
+		return
+	}
+
+	// Holding the bus lock while queueing keeps the order the same for every subscriber
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.subs {
+		s.push(event)
+	}
+}
+
+// Sync waits until every subscriber has handled the events published before the call
+func (b *Bus) Sync() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	barriers := make([]barrier, len(b.subs))
+	for i, s := range b.subs {
+		barriers[i] = make(barrier)
+		s.push(barriers[i])
+	}
+	b.mu.Unlock()
+
+	for _, done := range barriers {
+		<-done
+	}
+}
+
+// barrier is queued by Sync and closed once a subscriber reaches it
+type barrier chan struct{}
+
+// subscriber delivers queued events to fn one at a time.
+// The queue is unbounded so publishing never blocks.
+type subscriber struct {
+	fn      func(any)
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []any
+	stopped bool
+}
+
+// push queues an event
+func (s *subscriber) push(event any) {
+	s.mu.Lock()
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+	s.cond.Signal()
+}
+
+// stop ends delivery, releasing anyone waiting in Sync
+func (s *subscriber) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.cond.Signal()
+}
+
+// run delivers events until the subscriber stops
+func (s *subscriber) run() {
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.stopped {
+			s.cond.Wait()
+		}
+		if s.stopped {
+			pending := s.queue
+			s.queue = nil
+			s.mu.Unlock()
+			for _, event := range pending {
+				if done, ok := event.(barrier); ok {
+					close(done)
+				}
+			}
+			return
+		}
+		event := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		if done, ok := event.(barrier); ok {
+			close(done)
+			continue
+		}
+		s.fn(event)
+	}
+}
@@ -0,0 +1,137 @@
+package events
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the events a subscriber received
+type recorder struct {
+	mu     sync.Mutex
+	events []any
+}
+
+func (r *recorder) add(event any) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+func (r *recorder) get() []any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.events)
+}
+
+func TestPublishOrder(t *testing.T) {
+	bus := New()
+	var a, b recorder
+	bus.Subscribe(a.add)
+	bus.Subscribe(b.add)
+
+	var want []any
+	var wg sync.WaitGroup
+	for i := range 100 {
+		want = append(want, i)
+		bus.Publish(i)
+	}
+	// Concurrent publishers still reach every subscriber in the same order
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bus.Publish(-i)
+		}()
+	}
+	wg.Wait()
+	bus.Sync()
+
+	got := a.get()
+	if !slices.Equal(got[:100], want) {
+		t.Errorf("events = %v, want %v first", got, want)
+	}
+	if !slices.Equal(got, b.get()) {
+		t.Errorf("subscribers saw different orders:\n%v\n%v", got, b.get())
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	bus := New()
+	release := make(chan struct{})
+	bus.Subscribe(func(event any) { <-release })
+	var fast recorder
+	bus.Subscribe(fast.add)
+
+	// Publishing doesn't wait for the stalled subscriber, and neither does the other one
+	done := make(chan struct{})
+	go func() {
+		for i := range 1000 {
+			bus.Publish(i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fast.get()) < 1000 {
+		if time.Now().After(deadline) {
+			t.Fatalf("fast subscriber got %d of 1000 events", len(fast.get()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	bus.Sync()
+}
+
+func TestUnsubscribe(t *testing.T) {
+	bus := New()
+	var r recorder
+	blocked, block, handled := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	unsubscribe := bus.Subscribe(func(event any) {
+		if event == "block" {
+			close(blocked)
+			<-block
+			defer close(handled)
+		}
+		r.add(event)
+	})
+
+	bus.Publish("first")
+	bus.Publish("block")
+	bus.Publish("dropped")
+	<-blocked
+
+	// Stopping releases a Sync that waits on queued events
+	synced := make(chan struct{})
+	go func() {
+		bus.Sync()
+		close(synced)
+	}()
+	time.Sleep(10 * time.Millisecond) // Let Sync queue its barrier
+	unsubscribe()
+	close(block)
+	select {
+	case <-synced:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sync hung on a stopped subscriber")
+	}
+	<-handled
+
+	bus.Publish("after")
+	bus.Sync()
+	if got := r.get(); !slices.Equal(got, []any{"first", "block"}) {
+		t.Errorf("events = %v, want first and block only", got)
+	}
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *Bus
+	bus.Publish("ignored")
+	bus.Sync()
+}
@@ -0,0 +1,408 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/thetronjohnson/layrr/internal/claude"
+	"github.com/thetronjohnson/layrr/internal/config"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+)
+
+// File is the history log, relative to the project directory
+const File = ".layrr/history.jsonl"
+
+// Dir holds files kept with recorded jobs (screenshots), relative to the project directory
+const Dir = ".layrr/history"
+
+// maxResultText bounds how much tool output is kept per tool result, so file reads
+// don't balloon the log
+const maxResultText = 4000
+
+// maxInputText bounds each string argument kept per tool call, so Write and Edit calls
+// don't store whole files
+const maxInputText = 1000
+
+// Record is everything known about one finished job
+type Record struct {
+	ID          string            `json:"id"`
+	Agent       string            `json:"agent"`
+	Instruction string            `json:"instruction"`
+	PageURL     string            `json:"pageUrl,omitempty"`
+	Message     json.RawMessage   `json:"message,omitempty"`     // Browser message (area, elements, edits) without screenshot data
+	Prompt      string            `json:"prompt,omitempty"`      // Exact text sent to the agent
+	Screenshots []string          `json:"screenshots,omitempty"` // Saved copies, relative to the project directory
+	Events      []claude.Event    `json:"events,omitempty"`      // Agent stream, with long tool output trimmed
+	Changes     []snapshot.Change `json:"changes,omitempty"`
+	State       string            `json:"state"`
+	Error       string            `json:"error,omitempty"`
+	Worktree    bool              `json:"worktree,omitempty"`   // Ran in a worktree for review
+	ReviewedAt  *time.Time        `json:"reviewedAt,omitempty"` // When the review was accepted or rejected
+	ReplayOf    string            `json:"replayOf,omitempty"`   // ID of the job this one replayed
+	SessionID   string            `json:"sessionId,omitempty"`
+	Model       string            `json:"model,omitempty"`
+	NumTurns    int               `json:"numTurns,omitempty"`
+	CostUSD     float64           `json:"costUsd,omitempty"`
+	StartedAt   time.Time         `json:"startedAt"`
+	FinishedAt  time.Time         `json:"finishedAt"`
+	DurationMS  int64             `json:"durationMs"`
+}
+
+// Duration is how long the job ran
+func (r Record) Duration() time.Duration {
+	return time.Duration(r.DurationMS) * time.Millisecond
+}
+
+// AddEvent appends a stream event and picks up the session, model and cost it reports
+func (r *Record) AddEvent(event claude.Event) {
+	switch event.Type {
+	case claude.EventSystem:
+		if event.Model != "" {
+			r.Model = event.Model
+		}
+	case claude.EventResult:
+		r.NumTurns += event.NumTurns
+		r.CostUSD += event.TotalCostUSD
+	}
+	if event.SessionID != "" {
+		r.SessionID = event.SessionID
+	}
+	r.Events = append(r.Events, trimEvent(event))
+}
+
+// trimEvent copies an event with long tool inputs and results cut short (the original is
+// shared with the TUI)
+func trimEvent(event claude.Event) claude.Event {
+	if event.Message == nil {
+		return event
+	}
+
+	msg := *event.Message
+	msg.Content = make([]claude.ContentBlock, len(event.Message.Content))
+	for i, block := range event.Message.Content {
+		switch {
+		case block.Type == claude.BlockToolUse:
+			block.Input = trimInput(block.Input)
+		case block.Type == claude.BlockToolResult && len(block.Content) > 0:
+			content := make([]claude.ContentBlock, len(block.Content))
+			for j, c := range block.Content {
+				c.Text = truncate(c.Text, maxResultText)
+				content[j] = c
+			}
+			block.Content = content
+		}
+		msg.Content[i] = block
+	}
+	event.Message = &msg
+	return event
+}
+
+// trimInput copies a tool input with long string arguments cut short. The short ones,
+// like the file path Target reports, are kept whole.
+func trimInput(in *claude.ToolInput) *claude.ToolInput {
+	if in == nil || len(in.Raw) <= maxInputText {
+		return in
+	}
+
+	trimmed := *in
+	decoder := json.NewDecoder(bytes.NewReader(in.Raw))
+	decoder.UseNumber()
+	var args any
+	if err := decoder.Decode(&args); err != nil {
+		trimmed.Raw = nil // Keep the known fields only
+		return &trimmed
+	}
+	raw, err := json.Marshal(trimValues(args))
+	if err != nil {
+		trimmed.Raw = nil
+		return &trimmed
+	}
+	trimmed.Raw = raw
+	return &trimmed
+}
+
+// trimValues truncates the strings in a decoded JSON value
+func trimValues(v any) any {
+	switch v := v.(type) {
+	case string:
+		return truncate(v, maxInputText)
+	case map[string]any:
+		for key, value := range v {
+			v[key] = trimValues(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = trimValues(value)
+		}
+	}
+	return v
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence, noting how much was cut
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + fmt.Sprintf("... [%d bytes trimmed]", len(s)-cut)
+}
+
+// Log appends records to a project's history file
+type Log struct {
+	projectDir string
+	mu         sync.Mutex
+}
+
+// Open returns the history log of the project at projectDir
+func Open(projectDir string) *Log {
+	return &Log{projectDir: projectDir}
+}
+
+// Append writes a record as one line of the history file
+func (l *Log) Append(r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode history record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.ensureIgnored(); err != nil {
+		return err
+	}
+
+	path := filepath.Join(l.projectDir, filepath.FromSlash(File))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// Update rewrites the record with the given ID, e.g. once its review is resolved.
+// The other lines of the history are kept as they are.
+func (l *Log) Update(id string, update func(*Record)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	path := filepath.Join(l.projectDir, filepath.FromSlash(File))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	found := false
+	for i := len(lines) - 1; i >= 0 && !found; i-- { // The record is usually one of the last
+		line := bytes.TrimSpace(lines[i])
+		var r Record
+		if len(line) == 0 || json.Unmarshal(line, &r) != nil || r.ID != id {
+			continue
+		}
+		update(&r)
+		encoded, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("failed to encode history record: %w", err)
+		}
+		lines[i] = append(encoded, '\n')
+		found = true
+	}
+	if !found {
+		return ErrNotFound
+	}
+
+	// Replace the file in one step so a crash never leaves half a history
+	tmp, err := os.CreateTemp(filepath.Dir(path), "history-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to update history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bytes.Join(lines, nil)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to update history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to update history: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to update history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to update history: %w", err)
+	}
+	return nil
+}
+
+// KeepFiles copies files (e.g. screenshots) next to the history so a job can be replayed.
+// It returns the copies' paths relative to the project directory.
+func (l *Log) KeepFiles(id string, paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	dir := filepath.Join(l.projectDir, filepath.FromSlash(Dir), id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	if err := l.ensureIgnored(); err != nil {
+		return nil, err
+	}
+
+	kept := make([]string, 0, len(paths))
+	for _, path := range paths {
+		dest := filepath.Join(dir, filepath.Base(path))
+		if err := copyFile(path, dest); err != nil {
+			return kept, err
+		}
+		rel, err := filepath.Rel(l.projectDir, dest)
+		if err != nil {
+			return kept, err
+		}
+		kept = append(kept, filepath.ToSlash(rel))
+	}
+	return kept, nil
+}
+
+// ensureIgnored lists the history in .layrr/.gitignore, so git status and checkpoints
+// leave the log alone
+func (l *Log) ensureIgnored() error {
+	return config.IgnoreLocalFiles(l.projectDir, "history.jsonl", "history/", "screenshots/")
+}
+
+// copyFile copies src to dest
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Load reads every record from a project's history, oldest first.
+// A missing history is empty; malformed lines are skipped.
+func Load(projectDir string) ([]Record, error) {
+	f, err := os.Open(filepath.Join(projectDir, filepath.FromSlash(File)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var r Record
+			if json.Unmarshal(line, &r) == nil && r.ID != "" {
+				records = append(records, r)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return records, fmt.Errorf("failed to read history: %w", err)
+		}
+	}
+	return records, nil
+}
+
+// ErrNotFound is returned by Find when no record matches
+var ErrNotFound = errors.New("no job with that ID in the history")
+
+// Find returns the record with the given ID, or the only one starting with it
+func Find(records []Record, id string) (Record, error) {
+	var matches []Record
+	for _, r := range records {
+		if r.ID == id {
+			return r, nil
+		}
+		if strings.HasPrefix(r.ID, id) {
+			matches = append(matches, r)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return Record{}, ErrNotFound
+	case 1:
+		return matches[0], nil
+	default:
+		return Record{}, fmt.Errorf("job ID %q is ambiguous (%d matches)", id, len(matches))
+	}
+}
+
+// Filter selects records for listing; zero fields match everything
+type Filter struct {
+	State string    // Outcome, e.g. "done" or "failed"
+	Since time.Time // Started at or after
+	Text  string    // Case-insensitive substring of the instruction
+	File  string    // Substring of a changed file's path
+}
+
+// ParseSince reads a Filter.Since: a duration back from now (e.g. 2h) or a date
+func ParseSince(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q (use a duration like 2h or a date like 2006-01-02)", value)
+}
+
+// Match reports whether a record passes the filter
+func (f Filter) Match(r Record) bool {
+	if f.State != "" && r.State != f.State {
+		return false
+	}
+	if !f.Since.IsZero() && r.StartedAt.Before(f.Since) {
+		return false
+	}
+	if f.Text != "" && !strings.Contains(strings.ToLower(r.Instruction), strings.ToLower(f.Text)) {
+		return false
+	}
+	if f.File != "" {
+		for _, c := range r.Changes {
+			if strings.Contains(c.Path, f.File) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,225 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/thetronjohnson/layrr/internal/claude"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"abcdefgh", 3, "abc... [5 bytes trimmed]"},
+		{"héllo", 2, "h... [5 bytes trimmed]"}, // é is two bytes; half of it isn't kept
+		{"日本語", 4, "日... [6 bytes trimmed]"},
+		{"日本語", 2, "... [9 bytes trimmed]"},
+	}
+
+	for _, tt := range tests {
+		got := truncate(tt.s, tt.n)
+		if got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) split a character: %q", tt.s, tt.n, got)
+		}
+	}
+}
+
+func TestTrimInput(t *testing.T) {
+	long := strings.Repeat("x", maxInputText+500)
+	raw := `{"file_path":"/p/src/App.jsx","content":"` + long + `","edits":[{"old_string":"` + long + `","new_string":"b"}],"replace_all":false,"limit":12345678901234567890}`
+
+	var in claude.ToolInput
+	if err := json.Unmarshal([]byte(raw), &in); err != nil {
+		t.Fatal(err)
+	}
+	trimmed := trimInput(&in)
+
+	if string(in.Raw) != raw {
+		t.Error("the original input was modified")
+	}
+	if trimmed.FilePath != "/p/src/App.jsx" {
+		t.Errorf("file path = %q", trimmed.FilePath)
+	}
+
+	var args map[string]any
+	decoder := json.NewDecoder(strings.NewReader(string(trimmed.Raw)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&args); err != nil {
+		t.Fatalf("trimmed input isn't JSON: %v", err)
+	}
+	if got := args["content"].(string); len(got) >= len(long) || !strings.HasSuffix(got, "[500 bytes trimmed]") {
+		t.Errorf("content wasn't trimmed: %d bytes", len(got))
+	}
+	edit := args["edits"].([]any)[0].(map[string]any)
+	if len(edit["old_string"].(string)) >= len(long) || edit["new_string"] != "b" {
+		t.Errorf("nested edit = %.40v", edit)
+	}
+	if args["file_path"] != "/p/src/App.jsx" || args["replace_all"] != false {
+		t.Errorf("short arguments changed: %v, %v", args["file_path"], args["replace_all"])
+	}
+	if args["limit"].(json.Number).String() != "12345678901234567890" {
+		t.Errorf("number changed: %v", args["limit"])
+	}
+
+	// Short inputs are shared as they are
+	short := &claude.ToolInput{FilePath: "a.js", Raw: json.RawMessage(`{"file_path":"a.js"}`)}
+	if trimInput(short) != short {
+		t.Error("short input was copied")
+	}
+}
+
+func TestAddEventTrimsResults(t *testing.T) {
+	long := strings.Repeat("y", maxResultText*2)
+	event := claude.Event{
+		Type: claude.EventUser,
+		Message: &claude.Message{Content: []claude.ContentBlock{{
+			Type:    claude.BlockToolResult,
+			Content: []claude.ContentBlock{{Type: claude.BlockText, Text: long}},
+		}}},
+	}
+
+	var r Record
+	r.AddEvent(event)
+	r.AddEvent(claude.Event{Type: claude.EventSystem, Model: "claude-sonnet", SessionID: "s1"})
+	r.AddEvent(claude.Event{Type: claude.EventResult, NumTurns: 2, TotalCostUSD: 0.25})
+
+	if got := r.Events[0].Message.Content[0].Content[0].Text; len(got) >= len(long) {
+		t.Errorf("tool result wasn't trimmed: %d bytes", len(got))
+	}
+	if event.Message.Content[0].Content[0].Text != long {
+		t.Error("the original event was modified")
+	}
+	if r.Model != "claude-sonnet" || r.SessionID != "s1" || r.NumTurns != 2 || r.CostUSD != 0.25 {
+		t.Errorf("record = %+v", r)
+	}
+}
+
+func TestAppendLoadUpdate(t *testing.T) {
+	dir := t.TempDir()
+	l := Open(dir)
+
+	for _, id := range []string{"aaa111", "bbb222", "bbb333"} {
+		if err := l.Append(Record{ID: id, State: "review", Instruction: "Job " + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reviewed := time.Now()
+	if err := l.Update("bbb222", func(r *Record) {
+		r.State = "done"
+		r.ReviewedAt = &reviewed
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Update("missing", func(r *Record) {}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update() of a missing record = %v", err)
+	}
+
+	records, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("loaded %d records", len(records))
+	}
+	if records[0].State != "review" || records[2].State != "review" {
+		t.Error("other records changed")
+	}
+	if records[1].State != "done" || records[1].ReviewedAt == nil || !records[1].ReviewedAt.Equal(reviewed) {
+		t.Errorf("updated record = %+v", records[1])
+	}
+
+	ignore, err := os.ReadFile(filepath.Join(dir, ".layrr", ".gitignore"))
+	if err != nil || !strings.Contains(string(ignore), "history.jsonl") {
+		t.Errorf(".layrr/.gitignore = %q, %v", ignore, err)
+	}
+
+	// IDs can be shortened as long as they stay unique
+	if r, err := Find(records, "aaa"); err != nil || r.ID != "aaa111" {
+		t.Errorf("Find(aaa) = %s, %v", r.ID, err)
+	}
+	if _, err := Find(records, "bbb"); err == nil {
+		t.Error("Find(bbb) isn't ambiguous")
+	}
+	if _, err := Find(records, "ccc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Find(ccc) = %v", err)
+	}
+}
+
+func TestLoadSkipsMalformedLines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, filepath.FromSlash(File))
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("{\"id\":\"a\"}\nnot json\n{\"state\":\"done\"}\n\n{\"id\":\"b\"}"), 0644)
+
+	records, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].ID != "a" || records[1].ID != "b" {
+		t.Errorf("records = %+v", records)
+	}
+
+	// No history yet
+	if records, err := Load(t.TempDir()); err != nil || records != nil {
+		t.Errorf("Load() of a new project = %v, %v", records, err)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	now := time.Now()
+	r := Record{
+		Instruction: "Make the Button red",
+		State:       "done",
+		StartedAt:   now.Add(-time.Hour),
+		Changes:     []snapshot.Change{{Path: "src/Button.tsx", Kind: snapshot.Modified}},
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"state", Filter{State: "done"}, true},
+		{"other state", Filter{State: "failed"}, false},
+		{"since before", Filter{Since: now.Add(-2 * time.Hour)}, true},
+		{"since after", Filter{Since: now.Add(-time.Minute)}, false},
+		{"text", Filter{Text: "button"}, true},
+		{"other text", Filter{Text: "header"}, false},
+		{"file", Filter{File: "Button.tsx"}, true},
+		{"other file", Filter{File: "Header.tsx"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(r); got != tt.want {
+			t.Errorf("%s: Match() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	if got, err := ParseSince("2h"); err != nil || time.Since(got).Round(time.Minute) != 2*time.Hour {
+		t.Errorf("ParseSince(2h) = %v, %v", got, err)
+	}
+	if got, err := ParseSince("2024-03-01"); err != nil || got.Year() != 2024 || got.Month() != time.March || got.Day() != 1 {
+		t.Errorf("ParseSince(2024-03-01) = %v, %v", got, err)
+	}
+	if _, err := ParseSince("yesterday"); err == nil {
+		t.Error("ParseSince(yesterday) didn't fail")
+	}
+}
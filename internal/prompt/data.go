@@ -0,0 +1,103 @@
+package prompt
+
+// InstructionData is passed to the instruction template: an instruction about a selected area
+type InstructionData struct {
+	Instruction  string    // What the user asked for
+	Area         Area      // The selected area
+	Elements     []Element // Selected elements (at most 20)
+	MoreElements int       // How many further elements were left out
+	Screenshots  []string  // Absolute paths of screenshots the agent should read
+	HasRules     bool      // Instruction came from design.tmpl or visual-edits.tmpl, which include the rules
+}
+
+// Area is the size of a selection in CSS pixels
+type Area struct {
+	X            int `json:"x"`
+	Y            int `json:"y"`
+	Width        int `json:"width"`
+	Height       int `json:"height"`
+	ElementCount int `json:"elementCount,omitempty"`
+}
+
+// Element is a selected DOM element
+type Element struct {
+	TagName   string
+	ID        string
+	Classes   string
+	Selector  string // CSS selector
+	InnerText string
+	OuterHTML string
+	Source    string // Resolved source location, e.g. "src/Card.tsx:12:5 (<Card>)"
+	Component string // Owning component when no source file was found
+}
+
+// DesignData is passed to the design-analysis and design templates.
+// It is stored with recorded jobs, like VisualEditsData, so they can be rendered again.
+type DesignData struct {
+	Request    string `json:"request"`   // What the user asked for alongside the image
+	Project    string `json:"project"`   // Project summary, e.g. "react (TypeScript) with tailwind"
+	Framework  string `json:"framework"` // "react", "vue", "svelte", "html", ...
+	Styling    string `json:"styling"`   // "tailwind", "css-modules", "styled-components", "emotion", "css"
+	TypeScript bool   `json:"typescript,omitempty"`
+	Analysis   string `json:"analysis,omitempty"` // Vision analysis of the design (design template only)
+}
+
+// VisualEditsData is passed to the visual-edits template: changes made on the page
+// that should be written back to the source
+type VisualEditsData struct {
+	Batch        int            `json:"batch"` // 1-based batch number
+	TotalBatches int            `json:"totalBatches"`
+	Changes      []VisualChange `json:"changes"`
+	Framework    string         `json:"framework"`
+	Styling      string         `json:"styling"`
+}
+
+// VisualChange is one edit made in the browser. Which fields are set depends on Operation.
+type VisualChange struct {
+	Number    int    `json:"number"`    // 1-based position in the batch
+	Operation string `json:"operation"` // "reorder", "text", "ai" or "transform"
+	Selector  string `json:"selector"`
+	Source    string `json:"source,omitempty"` // Resolved source location, if known
+
+	// reorder
+	ParentSelector string `json:"parentSelector,omitempty"`
+	FromIndex      int    `json:"fromIndex,omitempty"`
+	ToIndex        int    `json:"toIndex,omitempty"`
+	InsertBefore   string `json:"insertBefore,omitempty"` // Selector of the new next sibling
+	InsertAfter    string `json:"insertAfter,omitempty"`  // Selector of the new previous sibling
+
+	// text
+	OldText string `json:"oldText,omitempty"`
+	NewText string `json:"newText,omitempty"`
+
+	// ai
+	Instruction  string `json:"instruction,omitempty"`
+	ElementCount int    `json:"elementCount,omitempty"`
+	Bounds       *Area  `json:"bounds,omitempty"`
+	Screenshot   int    `json:"screenshot,omitempty"` // Number N of the [screenshot N] the agent is given, 0 if none
+
+	// transform
+	Transform string `json:"transform,omitempty"`
+	Width     string `json:"width,omitempty"`
+	Height    string `json:"height,omitempty"`
+}
+
+// PreviewData is passed to the preview template: a request for instant DOM changes
+type PreviewData struct {
+	Instruction string
+	Selected    Element   // The element the user clicked
+	Parent      *Element  // Its parent, if any (OuterHTML is truncated)
+	Siblings    []Element // Up to 3 siblings to copy structure from
+	Container   bool      // Whether Selected is a container (div, section, ul, ...)
+	Position    string    // Recommended insertAdjacentHTML position
+	Others      []Element // Further selected elements
+	Tokens      *Tokens   // Design tokens from the page's CSS custom properties
+}
+
+// Tokens are a page's design tokens by category
+type Tokens struct {
+	Colors     map[string]string
+	Spacing    map[string]string
+	Typography map[string]string
+	Other      map[string]string
+}
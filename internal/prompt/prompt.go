@@ -0,0 +1,147 @@
+package prompt
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+//go:embed templates/*.tmpl
+var defaults embed.FS
+
+// Template names. Each has a default in templates/ that a project can replace
+// with .layrr/templates/<name>.tmpl.
+const (
+	Instruction    = "instruction"     // Area selection sent to the coding agent (InstructionData)
+	DesignAnalysis = "design-analysis" // Vision request describing an uploaded design (DesignData)
+	Design         = "design"          // Design-to-code instruction sent to the coding agent (DesignData)
+	VisualEdits    = "visual-edits"    // Batch of visual edits sent to the coding agent (VisualEditsData)
+	Preview        = "preview"         // AI preview request for DOM changes (PreviewData)
+	Rules          = "rules"           // House rules added to every prompt; empty by default
+)
+
+// TemplateDir is where project overrides live, relative to the project directory
+const TemplateDir = ".layrr/templates"
+
+// ext is the file extension of templates
+const ext = ".tmpl"
+
+// Templates renders prompts from the defaults and a project's overrides.
+// Overrides are re-read on every render, so edits apply without a restart.
+type Templates struct {
+	dir   string // Override directory
+	label string // How dir is shown in errors
+}
+
+// New creates templates for the project at projectDir
+func New(projectDir string) *Templates {
+	return &Templates{dir: filepath.Join(projectDir, filepath.FromSlash(TemplateDir)), label: TemplateDir}
+}
+
+// NewDir creates templates whose overrides come from dir instead of a project's
+// .layrr/templates (e.g. to try alternative prompts on recorded jobs)
+func NewDir(dir string) *Templates {
+	return &Templates{dir: dir, label: dir}
+}
+
+// Render executes the named template with data
+func (t *Templates) Render(name string, data any) (string, error) {
+	tmpl, _, err := t.parse()
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if err := tmpl.ExecuteTemplate(&out, name, data); err != nil {
+		return "", fmt.Errorf("failed to render %s prompt: %w", name, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// Overrides parses every template and returns the names the project overrides
+func (t *Templates) Overrides() ([]string, error) {
+	_, overrides, err := t.parse()
+	return overrides, err
+}
+
+// parse loads the default templates, then the project's overrides on top.
+// An override may also define extra named templates for its own use.
+func (t *Templates) parse() (*template.Template, []string, error) {
+	tmpl := template.New("layrr")
+	tmpl.Funcs(funcs(tmpl))
+
+	entries, err := defaults.ReadDir("templates")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		content, err := defaults.ReadFile("templates/" + entry.Name())
+		if err != nil {
+			return nil, nil, err
+		}
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if _, err := tmpl.New(name).Parse(string(content)); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse default %s template: %w", name, err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(t.dir, "*"+ext))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(files)
+
+	var overrides []string
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ext)
+		if _, err := tmpl.New(name).Parse(string(content)); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(t.label, filepath.Base(file)), err)
+		}
+		overrides = append(overrides, name)
+	}
+
+	return tmpl, overrides, nil
+}
+
+// funcs are the helpers available to templates
+func funcs(tmpl *template.Template) template.FuncMap {
+	return template.FuncMap{
+		// include renders another template to a string, so it can be piped ({{include "rules" . | trim}})
+		"include": func(name string, data any) (string, error) {
+			var out strings.Builder
+			if err := tmpl.ExecuteTemplate(&out, name, data); err != nil {
+				return "", err
+			}
+			return out.String(), nil
+		},
+		// truncate flattens text to one line and cuts it to at most n bytes on a character
+		// boundary, adding "..."
+		"truncate": func(n int, s string) string {
+			s = strings.TrimSpace(strings.ReplaceAll(s, "\n", " "))
+			if len(s) <= n {
+				return s
+			}
+			for n > 0 && !utf8.RuneStart(s[n]) {
+				n--
+			}
+			return s[:n] + "..."
+		},
+		"trim": strings.TrimSpace,
+		"join": func(sep string, items []string) string {
+			return strings.Join(items, sep)
+		},
+		// inc turns a 0-based index into a 1-based number
+		"inc": func(i int) int {
+			return i + 1
+		},
+	}
+}
@@ -0,0 +1,178 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	truncate := funcs(nil)["truncate"].(func(int, string) string)
+
+	tests := []struct {
+		n    int
+		s    string
+		want string
+	}{
+		{10, "short", "short"},
+		{10, "  two\nlines  ", "two lines"},
+		{3, "abcdef", "abc..."},
+		{2, "héllo", "h..."}, // é is two bytes; half of it isn't kept
+		{4, "日本語", "日..."},
+		{2, "日本語", "..."},
+	}
+
+	for _, tt := range tests {
+		got := truncate(tt.n, tt.s)
+		if got != tt.want {
+			t.Errorf("truncate(%d, %q) = %q, want %q", tt.n, tt.s, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%d, %q) split a character: %q", tt.n, tt.s, got)
+		}
+	}
+}
+
+func TestInstruction(t *testing.T) {
+	templates := New(t.TempDir())
+
+	got, err := templates.Render(Instruction, InstructionData{
+		Instruction: "Make it red",
+		Area:        Area{Width: 200, Height: 100, ElementCount: 2},
+		Elements: []Element{
+			{Selector: "button.save", Source: "src/App.jsx:12:5", InnerText: "Save\nchanges"},
+			{Selector: "span", Component: "Badge"},
+		},
+		MoreElements: 3,
+		Screenshots:  []string{"/tmp/a.png"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `Make it red (Selected 2 elements in 200x100 area: [button.save src:src/App.jsx:12:5 text:"Save changes"] [span component:<Badge>] [+3 more elements] )` +
+		` (Screenshot of what the user saw - read this image before making changes: [screenshot 1] /tmp/a.png)`
+	if got != want {
+		t.Errorf("Render()\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	project := t.TempDir()
+	dir := filepath.Join(project, filepath.FromSlash(TemplateDir))
+	write(t, filepath.Join(dir, "rules.tmpl"), "Use <Button> from src/ui.")
+	write(t, filepath.Join(dir, "instruction.tmpl"), `{{define "shout"}}{{.}}!{{end}}{{template "shout" .Instruction}}{{with include "rules" . | trim}} {{.}}{{end}}`)
+	templates := New(project)
+
+	overrides, err := templates.Overrides()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(overrides, []string{"instruction", "rules"}) {
+		t.Errorf("Overrides() = %v", overrides)
+	}
+
+	got, err := templates.Render(Instruction, InstructionData{Instruction: "Make it red"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Make it red! Use <Button> from src/ui." {
+		t.Errorf("Render() = %q", got)
+	}
+
+	// Overrides are re-read for every render
+	write(t, filepath.Join(dir, "rules.tmpl"), "Never hard-code colors.")
+	if got, _ := templates.Render(Instruction, InstructionData{Instruction: "Go"}); got != "Go! Never hard-code colors." {
+		t.Errorf("Render() after editing rules = %q", got)
+	}
+}
+
+func TestRulesInEveryPrompt(t *testing.T) {
+	project := t.TempDir()
+	write(t, filepath.Join(project, filepath.FromSlash(TemplateDir), "rules.tmpl"), "Use <Button> from src/ui.")
+	templates := New(project)
+
+	design := DesignData{Request: "Build this", Framework: "react", Styling: "tailwind", Analysis: "A form"}
+	edits := VisualEditsData{Batch: 1, TotalBatches: 1, Framework: "react", Styling: "tailwind",
+		Changes: []VisualChange{{Number: 1, Operation: "text", Selector: "h1", OldText: "Hi", NewText: "Hello"}}}
+
+	tests := []struct {
+		name string
+		data any
+	}{
+		{DesignAnalysis, design},
+		{Design, design},
+		{VisualEdits, edits},
+		{Preview, PreviewData{Instruction: "Add a button"}},
+		{Instruction, InstructionData{Instruction: "Make it red"}},
+	}
+	for _, tt := range tests {
+		got, err := templates.Render(tt.name, tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if n := strings.Count(got, "Use <Button> from src/ui."); n != 1 {
+			t.Errorf("%s prompt has the rules %d times:\n%s", tt.name, n, got)
+		}
+	}
+
+	// Design and visual-edits prompts already carry the rules when they pass through the
+	// instruction template
+	for _, name := range []string{Design, VisualEdits} {
+		data := any(design)
+		if name == VisualEdits {
+			data = edits
+		}
+		instruction, err := templates.Render(name, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := templates.Render(Instruction, InstructionData{Instruction: instruction, HasRules: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(got, "Use <Button> from src/ui."); n != 1 {
+			t.Errorf("%s prompt has the rules %d times:\n%s", name, n, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	project := t.TempDir()
+	write(t, filepath.Join(project, filepath.FromSlash(TemplateDir), "design.tmpl"), "{{.Request")
+	templates := New(project)
+
+	_, err := templates.Overrides()
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(TemplateDir, "design.tmpl")) {
+		t.Errorf("Overrides() = %v, want a parse error naming the file", err)
+	}
+	if _, err := templates.Render(Instruction, InstructionData{Instruction: "Go"}); err == nil {
+		t.Error("Render() ignored the broken override")
+	}
+
+	// Errors while rendering name the prompt
+	write(t, filepath.Join(project, filepath.FromSlash(TemplateDir), "design.tmpl"), "{{.Missing}}")
+	if _, err := templates.Render(Design, DesignData{}); err == nil || !strings.Contains(err.Error(), "design prompt") {
+		t.Errorf("Render() = %v, want an error naming the prompt", err)
+	}
+
+	// NewDir reports its own directory
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "rules.tmpl"), "{{end}}")
+	if _, err := NewDir(dir).Overrides(); err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "rules.tmpl")) {
+		t.Errorf("NewDir().Overrides() = %v", err)
+	}
+}
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thetronjohnson/layrr/internal/bridge"
+	"github.com/thetronjohnson/layrr/internal/claude"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+)
+
+// maxActivityText is the longest summary sent to the browsers, in runes
+const maxActivityText = 120
+
+// trackJob remembers which job is running, so agent stream events can be attributed to it
+func (s *Server) trackJob(job bridge.Job) {
+	s.activityMu.Lock()
+	defer s.activityMu.Unlock()
+
+	switch {
+	case job.State == bridge.JobRunning:
+		s.runningJob = job.ID
+		s.lastActivity = nil
+	case job.Finished() && job.ID == s.runningJob:
+		s.runningJob = ""
+		s.lastActivity = nil
+	}
+}
+
+// broadcastActivity summarizes an agent stream event and pushes it to every connected browser
+func (s *Server) broadcastActivity(event claude.Event) {
+	s.activityMu.Lock()
+	jobID := s.runningJob
+	s.activityMu.Unlock()
+	if jobID == "" {
+		return
+	}
+
+	// Paths are shown relative to where the job runs, which is a worktree in worktree mode
+	for _, activity := range s.activities(event, s.bridge.WorkDir(jobID)) {
+		activity.JobID = jobID
+		s.activityMu.Lock()
+		if s.runningJob == jobID {
+			s.lastActivity = &activity
+		}
+		s.activityMu.Unlock()
+		s.broadcast(activity)
+	}
+}
+
+// currentActivity returns the latest activity of the running job (nil if none)
+func (s *Server) currentActivity() *activityMessage {
+	s.activityMu.Lock()
+	defer s.activityMu.Unlock()
+	return s.lastActivity
+}
+
+// activities turns an agent stream event into one-line summaries: the tools it calls,
+// what it says, and tools that failed. File paths are made relative to dir.
+func (s *Server) activities(event claude.Event, dir string) []activityMessage {
+	var activities []activityMessage
+	now := time.Now()
+
+	switch event.Type {
+	case claude.EventAssistant:
+		if event.Message == nil {
+			break
+		}
+		for _, block := range event.Message.Content {
+			switch block.Type {
+			case claude.BlockToolUse:
+				activity := activityMessage{Type: msgActivity, Kind: activityTool, Tool: block.Name, At: now}
+				if block.Input != nil {
+					if path := block.Input.FilePath + block.Input.NotebookPath; path != "" {
+						activity.File = snapshot.RelPath(dir, path)
+					}
+				}
+				activity.Summary = truncate(toolSummary(block.Name, block.Input))
+				activities = append(activities, activity)
+
+			case claude.BlockText:
+				if text := firstLine(block.Text); text != "" {
+					activities = append(activities, activityMessage{Type: msgActivity, Kind: activityText, Summary: truncate(text), At: now})
+				}
+			}
+		}
+
+	case claude.EventUser:
+		for _, block := range event.Blocks(claude.BlockToolResult) {
+			if block.IsError {
+				activities = append(activities, activityMessage{Type: msgActivity, Kind: activityError, Summary: truncate(firstLine(block.ResultText())), At: now})
+			}
+		}
+	}
+
+	return activities
+}
+
+// toolSummary describes a tool call for people who don't read tool names,
+// e.g. "Editing styles.css" or "Searching for Header"
+func toolSummary(tool string, in *claude.ToolInput) string {
+	if in == nil {
+		in = &claude.ToolInput{}
+	}
+	file := filepath.Base(in.FilePath)
+
+	switch tool {
+	case "Read":
+		return "Reading " + file
+	case "Edit", "MultiEdit":
+		return "Editing " + file
+	case "Write":
+		return "Writing " + file
+	case "NotebookEdit":
+		return "Editing " + filepath.Base(in.NotebookPath)
+	case "Grep":
+		return fmt.Sprintf("Searching for %q", in.Pattern)
+	case "Glob":
+		return "Finding files matching " + in.Pattern
+	case "LS":
+		return "Listing " + filepath.Base(in.Path)
+	case "Bash":
+		if in.Description != "" {
+			return in.Description
+		}
+		return "Running " + firstLine(in.Command)
+	case "WebFetch":
+		if u, err := url.Parse(in.URL); err == nil && u.Host != "" {
+			return "Fetching " + u.Host
+		}
+		return "Fetching a web page"
+	case "WebSearch":
+		return fmt.Sprintf("Searching the web for %q", in.Query)
+	case "Task":
+		if in.Description != "" {
+			return "Delegating: " + in.Description
+		}
+		return "Delegating to a subagent"
+	case "TodoWrite":
+		return "Planning"
+	}
+	if target := in.Target(); target != "" {
+		return tool + " " + firstLine(target)
+	}
+	return "Using " + tool
+}
+
+// firstLine returns the first non-empty line of s, trimmed
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// truncate shortens s to maxActivityText runes
+func truncate(s string) string {
+	runes := []rune(s)
+	if len(runes) <= maxActivityText {
+		return s
+	}
+	return string(runes[:maxActivityText-1]) + "…"
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thetronjohnson/layrr/internal/bridge"
+	"github.com/thetronjohnson/layrr/internal/claude"
+)
+
+func TestActivities(t *testing.T) {
+	dir := filepath.FromSlash("/work/app")
+	styles := filepath.Join(dir, "src", "styles.css")
+
+	tests := []struct {
+		name  string
+		event string
+		want  []activityMessage // Without Type and At
+	}{
+		{
+			name:  "tool calls and text",
+			event: `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"\n  Making it red.\nThen the border."},{"type":"tool_use","id":"1","name":"Edit","input":{"file_path":` + strconv.Quote(styles) + `,"old_string":"a","new_string":"b"}}]}}`,
+			want: []activityMessage{
+				{Kind: activityText, Summary: "Making it red."},
+				{Kind: activityTool, Tool: "Edit", File: "src/styles.css", Summary: "Editing styles.css"},
+			},
+		},
+		{
+			name:  "search",
+			event: `{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"1","name":"Grep","input":{"pattern":"Header"}}]}}`,
+			want:  []activityMessage{{Kind: activityTool, Tool: "Grep", Summary: `Searching for "Header"`}},
+		},
+		{
+			name:  "bash with and without a description",
+			event: `{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"1","name":"Bash","input":{"command":"npm test","description":"Run the tests"}},{"type":"tool_use","id":"2","name":"Bash","input":{"command":"ls\nrm -rf x"}}]}}`,
+			want: []activityMessage{
+				{Kind: activityTool, Tool: "Bash", Summary: "Run the tests"},
+				{Kind: activityTool, Tool: "Bash", Summary: "Running ls"},
+			},
+		},
+		{
+			name:  "unknown tool",
+			event: `{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"1","name":"mcp__db__query","input":{}}]}}`,
+			want:  []activityMessage{{Kind: activityTool, Tool: "mcp__db__query", Summary: "Using mcp__db__query"}},
+		},
+		{
+			name:  "failed tool only",
+			event: `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"1","content":"ok"},{"type":"tool_result","tool_use_id":"2","is_error":true,"content":"String to replace not found\nin file"}]}}`,
+			want:  []activityMessage{{Kind: activityError, Summary: "String to replace not found"}},
+		},
+		{
+			name:  "nothing to show",
+			event: `{"type":"system","subtype":"init","session_id":"s"}`,
+		},
+	}
+
+	s := &Server{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := claude.ParseEvent([]byte(tt.event))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.activities(event, dir)
+			if len(got) != len(tt.want) {
+				t.Fatalf("activities = %+v, want %+v", got, tt.want)
+			}
+			for i, activity := range got {
+				if activity.Type != msgActivity || activity.At.IsZero() {
+					t.Errorf("activity %d has type %q, time %v", i, activity.Type, activity.At)
+				}
+				activity.Type, activity.At = "", tt.want[i].At
+				if activity != tt.want[i] {
+					t.Errorf("activity %d = %+v, want %+v", i, activity, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateActivity(t *testing.T) {
+	long := strings.Repeat("é", maxActivityText+5)
+	got := truncate(long)
+	if n := len([]rune(got)); n != maxActivityText || !strings.HasSuffix(got, "…") {
+		t.Errorf("truncate() = %d runes: %q", n, got)
+	}
+	if short := strings.Repeat("é", maxActivityText); truncate(short) != short {
+		t.Error("truncate() shortened a summary that fits")
+	}
+}
+
+func TestTrackJob(t *testing.T) {
+	s := &Server{}
+	s.trackJob(bridge.Job{ID: "a", State: bridge.JobRunning})
+	s.lastActivity = &activityMessage{JobID: "a", Summary: "Reading App.jsx"}
+
+	// Another job finishing doesn't clear the running one
+	s.trackJob(bridge.Job{ID: "b", State: bridge.JobCancelled})
+	if s.runningJob != "a" || s.currentActivity() == nil {
+		t.Errorf("running job = %q, activity = %v", s.runningJob, s.currentActivity())
+	}
+
+	s.trackJob(bridge.Job{ID: "a", State: bridge.JobDone})
+	if s.runningJob != "" || s.currentActivity() != nil {
+		t.Errorf("after finishing: running job = %q, activity = %v", s.runningJob, s.currentActivity())
+	}
+}
@@ -0,0 +1,264 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/thetronjohnson/layrr/internal/bridge"
+	"github.com/thetronjohnson/layrr/internal/history"
+)
+
+// The HTTP API lets editor extensions and scripts queue instructions and follow jobs
+// without a browser session. It needs the same session token as the injected page.
+
+// apiPrefix is where the HTTP API is served
+const apiPrefix = "/__layrr/api/"
+
+// maxAPIBody bounds request bodies, leaving room for a few screenshots
+const maxAPIBody = 32 << 20
+
+// Error codes only the HTTP API uses
+const (
+	codeUnauthorized = "unauthorized" // No or the wrong session token
+	codeForbidden    = "forbidden"    // A browser page on another origin
+	codeNotFound     = "not-found"    // No such endpoint, job or record
+)
+
+// apiError is the body of every failed API request
+type apiError struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// submitRequest queues an instruction. Elements can be given as CSS selectors instead of
+// a full area, since callers outside the browser rarely know their bounds.
+type submitRequest struct {
+	instructionRequest
+	Selectors []string `json:"selectors,omitempty"`
+}
+
+func (r *submitRequest) validate() error {
+	if err := r.instructionRequest.validate(); err != nil {
+		return err
+	}
+	for i, selector := range r.Selectors {
+		if strings.TrimSpace(selector) == "" {
+			return fmt.Errorf("selectors[%d] is empty", i)
+		}
+	}
+	return nil
+}
+
+// message converts the request for the bridge, adding the selectors to the area's elements
+func (r *submitRequest) message() bridge.Message {
+	msg := r.instructionRequest.message(messageID(envelope{}))
+	for _, selector := range r.Selectors {
+		msg.Area.Elements = append(msg.Area.Elements, bridge.ElementInfo{Selector: selector})
+	}
+	msg.Area.ElementCount = max(msg.Area.ElementCount, len(msg.Area.Elements))
+	return msg
+}
+
+// API responses
+type (
+	jobResponse struct {
+		Job bridge.Job `json:"job"`
+	}
+	jobsResponse struct {
+		Jobs []bridge.Job `json:"jobs"`
+	}
+	recordResponse struct {
+		Record history.Record `json:"record"`
+	}
+	recordsResponse struct {
+		Records []history.Record `json:"records"`
+	}
+)
+
+// apiHandler routes the HTTP API behind the token check
+func (s *Server) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+apiPrefix+"jobs", s.apiSubmit)
+	mux.HandleFunc("GET "+apiPrefix+"jobs", s.apiJobs)
+	mux.HandleFunc("GET "+apiPrefix+"jobs/{id}", s.apiJob)
+	mux.HandleFunc("POST "+apiPrefix+"jobs/{id}/cancel", s.apiCancel)
+	mux.HandleFunc("GET "+apiPrefix+"history", s.apiHistory)
+	mux.HandleFunc("GET "+apiPrefix+"history/{id}", s.apiRecord)
+	mux.HandleFunc(apiPrefix, func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, &protocolError{Code: codeNotFound, Message: fmt.Sprintf("no endpoint %s %s", r.Method, r.URL.Path)})
+	})
+	return s.checkToken(mux)
+}
+
+// apiSubmit queues an instruction. With ?wait=true it answers once the job has finished.
+func (s *Server) apiSubmit(w http.ResponseWriter, r *http.Request) {
+	var req submitRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	job := s.bridge.Submit(req.message())
+	if s.verbose {
+		fmt.Printf("[Proxy] 📨 Queued job %s from the HTTP API: %s\n", job.ID, job.Instruction)
+	}
+
+	if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); !wait {
+		writeJSON(w, http.StatusAccepted, jobResponse{Job: job})
+		return
+	}
+
+	// Stop waiting if the caller goes away; the job keeps running
+	done := make(chan bridge.Job, 1)
+	go func() {
+		final, _ := s.bridge.Wait(job.ID)
+		done <- final
+	}()
+	select {
+	case final := <-done:
+		writeJSON(w, http.StatusOK, jobResponse{Job: final})
+	case <-r.Context().Done():
+	}
+}
+
+// apiJobs lists the running job, queued jobs in order and recently finished jobs
+func (s *Server) apiJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jobsResponse{Jobs: s.bridge.Jobs()})
+}
+
+// apiJob reports one job's state and, once it has finished, its result
+func (s *Server) apiJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.bridge.Job(r.PathValue("id"))
+	if err != nil {
+		writeAPIError(w, fmt.Errorf("%w (older jobs are in %shistory)", err, apiPrefix))
+		return
+	}
+	writeJSON(w, http.StatusOK, jobResponse{Job: job})
+}
+
+// apiCancel drops a queued job or stops the running one. A running job is reported
+// as still running; it turns cancelled once the agent has stopped.
+func (s *Server) apiCancel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.bridge.Cancel(id); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	job, err := s.bridge.Job(id)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, jobResponse{Job: job})
+}
+
+// apiHistory lists recorded jobs, newest first, without their agent events and prompts.
+// It takes the filters of `layrr history`: state, since, q (instruction text), file and limit.
+func (s *Server) apiHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := history.Filter{State: query.Get("state"), Text: query.Get("q"), File: query.Get("file")}
+	if since := query.Get("since"); since != "" {
+		var err error
+		if filter.Since, err = history.ParseSince(since); err != nil {
+			writeAPIError(w, &protocolError{Code: codeInvalid, Message: err.Error()})
+			return
+		}
+	}
+	limit := 20
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeAPIError(w, &protocolError{Code: codeInvalid, Message: "limit must be a non-negative integer"})
+			return
+		}
+		limit = n
+	}
+
+	records, err := history.Load(s.projectDir)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	matched := []history.Record{}
+	for i := len(records) - 1; i >= 0; i-- {
+		if !filter.Match(records[i]) {
+			continue
+		}
+		record := records[i]
+		record.Events, record.Prompt, record.Message = nil, "", nil
+		matched = append(matched, record)
+		if limit > 0 && len(matched) == limit {
+			break
+		}
+	}
+	writeJSON(w, http.StatusOK, recordsResponse{Records: matched})
+}
+
+// apiRecord returns one recorded job in full; an ID prefix is enough
+func (s *Server) apiRecord(w http.ResponseWriter, r *http.Request) {
+	records, err := history.Load(s.projectDir)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	record, err := history.Find(records, r.PathValue("id"))
+	if err != nil {
+		if !errors.Is(err, history.ErrNotFound) {
+			err = &protocolError{Code: codeInvalid, Message: err.Error()}
+		}
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, recordResponse{Record: record})
+}
+
+// decodeBody reads and validates a JSON request body
+func decodeBody(w http.ResponseWriter, r *http.Request, req request) error {
+	body := http.MaxBytesReader(w, r.Body, maxAPIBody)
+	if err := json.NewDecoder(body).Decode(req); err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			return &protocolError{Code: codeInvalid, Message: fmt.Sprintf("request body is larger than %d MB", maxAPIBody>>20)}
+		case errors.Is(err, io.EOF):
+			return &protocolError{Code: codeInvalid, Message: "request body is empty"}
+		}
+		return &protocolError{Code: codeInvalid, Message: decodeError(err)}
+	}
+	if err := req.validate(); err != nil {
+		return &protocolError{Code: codeInvalid, Message: err.Error()}
+	}
+	return nil
+}
+
+// writeAPIError answers with the error's code and the matching HTTP status
+func writeAPIError(w http.ResponseWriter, err error) {
+	status, code := http.StatusInternalServerError, codeFailed
+	var protoErr *protocolError
+	switch {
+	case errors.As(err, &protoErr):
+		status, code = http.StatusBadRequest, protoErr.Code
+		if code == codeNotFound {
+			status = http.StatusNotFound
+		}
+	case errors.Is(err, bridge.ErrJobNotFound), errors.Is(err, history.ErrNotFound):
+		status, code = http.StatusNotFound, codeNotFound
+	case errors.Is(err, bridge.ErrJobNotQueued):
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, apiError{Code: code, Error: err.Error()})
+}
+
+// writeJSON answers with a JSON body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
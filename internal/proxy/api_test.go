@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thetronjohnson/layrr/internal/agent"
+	"github.com/thetronjohnson/layrr/internal/bridge"
+	"github.com/thetronjohnson/layrr/internal/events"
+)
+
+// apiServer returns a proxy whose bridge runs jobs through a scripted agent: instructions
+// containing "slow" take a minute unless cancelled, everything else finishes at once
+func apiServer(t *testing.T) (*Server, *events.Bus) {
+	t.Helper()
+
+	dir := t.TempDir()
+	fixture := filepath.Join(t.TempDir(), "fixture.json")
+	data := `{"runs":[{"match":"slow","steps":[{"delay":60000}]},{"steps":[]}]}`
+	if err := os.WriteFile(fixture, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.New()
+	scripted, err := agent.NewScriptedAgent(dir, fixture, bus, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(9999, Target{}, bridge.NewBridge(scripted, bus, dir, false), bus, nil, false, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetToken("secret")
+	return s, bus
+}
+
+// call sends an authorized API request and decodes the JSON answer into v (if not nil)
+func call(t *testing.T, s *Server, method, path, body string, v any) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, apiPrefix+path, strings.NewReader(body))
+	req.Host = "localhost:9999"
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	s.apiHandler().ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: content type %q", method, path, ct)
+	}
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v\n%s", method, path, err, rec.Body)
+		}
+	}
+	return rec.Code
+}
+
+func TestAPISubmitAndHistory(t *testing.T) {
+	s, bus := apiServer(t)
+
+	var submitted jobResponse
+	if code := call(t, s, http.MethodPost, "jobs?wait=true", `{"instruction":"Make it red","selectors":["h1.title"]}`, &submitted); code != http.StatusOK {
+		t.Fatalf("submit: %d", code)
+	}
+	id := submitted.Job.ID
+	if submitted.Job.State != bridge.JobDone {
+		t.Fatalf("waited job = %s (%s)", submitted.Job.State, submitted.Job.Error)
+	}
+	bus.Sync()
+
+	var job jobResponse
+	if code := call(t, s, http.MethodGet, "jobs/"+id, "", &job); code != http.StatusOK || job.Job.ID != id {
+		t.Errorf("job: %d %+v", code, job.Job)
+	}
+	var jobs jobsResponse
+	if code := call(t, s, http.MethodGet, "jobs", "", &jobs); code != http.StatusOK || len(jobs.Jobs) != 1 || jobs.Jobs[0].ID != id {
+		t.Errorf("jobs: %d %+v", code, jobs.Jobs)
+	}
+
+	var records recordsResponse
+	if code := call(t, s, http.MethodGet, "history?state=done&q=red", "", &records); code != http.StatusOK || len(records.Records) != 1 {
+		t.Fatalf("history: %d %+v", code, records.Records)
+	}
+	if r := records.Records[0]; r.ID != id || r.Prompt != "" || r.Events != nil {
+		t.Errorf("listed record = %+v, want %s without prompt and events", r, id)
+	}
+	if code := call(t, s, http.MethodGet, "history?state=failed", "", &records); code != http.StatusOK || records.Records == nil || len(records.Records) != 0 {
+		t.Errorf("filtered history: %d %+v", code, records.Records)
+	}
+
+	var record recordResponse
+	if code := call(t, s, http.MethodGet, "history/"+id[:4], "", &record); code != http.StatusOK || record.Record.ID != id {
+		t.Fatalf("record: %d %+v", code, record.Record)
+	}
+	if !strings.Contains(record.Record.Prompt, "h1.title") {
+		t.Errorf("prompt doesn't name the selector:\n%s", record.Record.Prompt)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	s, _ := apiServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"empty body", http.MethodPost, "jobs", "", http.StatusBadRequest, codeInvalid},
+		{"no instruction", http.MethodPost, "jobs", `{"instruction":"  "}`, http.StatusBadRequest, codeInvalid},
+		{"empty selector", http.MethodPost, "jobs", `{"instruction":"Go","selectors":[""]}`, http.StatusBadRequest, codeInvalid},
+		{"malformed body", http.MethodPost, "jobs", `{"instruction":`, http.StatusBadRequest, codeInvalid},
+		{"unknown job", http.MethodGet, "jobs/nope", "", http.StatusNotFound, codeNotFound},
+		{"cancel unknown job", http.MethodPost, "jobs/nope/cancel", "", http.StatusNotFound, codeNotFound},
+		{"unknown record", http.MethodGet, "history/nope", "", http.StatusNotFound, codeNotFound},
+		{"bad limit", http.MethodGet, "history?limit=-1", "", http.StatusBadRequest, codeInvalid},
+		{"bad since", http.MethodGet, "history?since=someday", "", http.StatusBadRequest, codeInvalid},
+		{"unknown endpoint", http.MethodGet, "nope", "", http.StatusNotFound, codeNotFound},
+		{"wrong method", http.MethodDelete, "jobs", "", http.StatusNotFound, codeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp apiError
+			if status := call(t, s, tt.method, tt.path, tt.body, &resp); status != tt.status || resp.Code != tt.code || resp.Error == "" {
+				t.Errorf("%d %+v, want %d %s", status, resp, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestAPICancel(t *testing.T) {
+	s, bus := apiServer(t)
+
+	var slow, next jobResponse
+	if code := call(t, s, http.MethodPost, "jobs", `{"instruction":"Take it slow"}`, &slow); code != http.StatusAccepted {
+		t.Fatalf("submit: %d", code)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for job, _ := s.bridge.Job(slow.Job.ID); job.State != bridge.JobRunning; job, _ = s.bridge.Job(slow.Job.ID) {
+		if time.Now().After(deadline) {
+			t.Fatalf("slow job is still %s", job.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	call(t, s, http.MethodPost, "jobs", `{"instruction":"Then this"}`, &next)
+	if next.Job.State != bridge.JobQueued || next.Job.Position != 1 {
+		t.Fatalf("second job = %s at %d, want queued at 1", next.Job.State, next.Job.Position)
+	}
+
+	// A queued job is cancelled right away, a running one once the agent stopped
+	var cancelled jobResponse
+	if code := call(t, s, http.MethodPost, "jobs/"+next.Job.ID+"/cancel", "", &cancelled); code != http.StatusOK || cancelled.Job.State != bridge.JobCancelled {
+		t.Errorf("cancel queued: %d %s", code, cancelled.Job.State)
+	}
+	if code := call(t, s, http.MethodPost, "jobs/"+slow.Job.ID+"/cancel", "", &cancelled); code != http.StatusOK {
+		t.Errorf("cancel running: %d", code)
+	}
+	if job, _ := s.bridge.Wait(slow.Job.ID); job.State != bridge.JobCancelled {
+		t.Errorf("running job = %s after cancel", job.State)
+	}
+	bus.Sync()
+
+	var resp apiError
+	if code := call(t, s, http.MethodPost, "jobs/"+slow.Job.ID+"/cancel", "", &resp); code != http.StatusConflict {
+		t.Errorf("cancel finished job: %d %+v, want 409", code, resp)
+	}
+}
+
+func TestAPINeedsToken(t *testing.T) {
+	s, _ := apiServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, apiPrefix+"jobs", nil)
+	req.Host = "localhost:9999"
+	rec := httptest.NewRecorder()
+	s.apiHandler().ServeHTTP(rec, req)
+
+	var resp apiError
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusUnauthorized || resp.Code != codeUnauthorized {
+		t.Errorf("%d %+v, want 401 %s", rec.Code, resp, codeUnauthorized)
+	}
+}
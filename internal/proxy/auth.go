@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/thetronjohnson/layrr/internal/config"
+)
+
+// TokenFile is where SaveToken writes the session token, relative to the project
+const TokenFile = ".layrr/token"
+
+// newToken generates the per-session secret the injected page uses to open the WebSockets
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SetToken replaces the generated session token, so scripts can be given one they know
+func (s *Server) SetToken(token string) {
+	s.token = token
+}
+
+// Token returns the session token the injected page and the HTTP API need
+func (s *Server) Token() string {
+	return s.token
+}
+
+// SaveToken writes the session token to TokenFile, readable only by the current user, so
+// scripts can call the HTTP API without the token showing up in the terminal
+func (s *Server) SaveToken() error {
+	path := filepath.Join(s.projectDir, filepath.FromSlash(TokenFile))
+	if err := config.IgnoreLocalFiles(s.projectDir, filepath.Base(path)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(s.token+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("failed to restrict %s: %w", path, err)
+	}
+	return nil
+}
+
+// RemoveToken deletes TokenFile once the token is no longer valid
+func (s *Server) RemoveToken() {
+	os.Remove(filepath.Join(s.projectDir, filepath.FromSlash(TokenFile)))
+}
+
+// EnableLAN makes the proxy listen on all interfaces and accept any Host, so other devices
+// on the network can open it. Anyone who can load a page through it can then drive the agent.
+func (s *Server) EnableLAN() {
+	s.lan = true
+}
+
+// checkHost rejects requests for hosts other than localhost unless LAN access is enabled.
+// Besides other machines, this stops DNS rebinding: a page on evil.example re-pointed at
+// 127.0.0.1 would otherwise be able to read the token from a proxied page.
+func (s *Server) checkHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.lan && !loopbackHost(r.Host) {
+			if s.verbose {
+				fmt.Printf("[Proxy] Rejected request for host %q\n", r.Host)
+			}
+			http.Error(w, "Forbidden: layrr only serves localhost (start it with -lan to allow other hosts)", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// upgrade opens a WebSocket for the injected page. The request must carry the session
+// token and come from a page on the proxy itself.
+func (s *Server) upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	if !s.validToken(r.URL.Query().Get("token")) {
+		http.Error(w, "Forbidden: missing or invalid token", http.StatusForbidden)
+		return nil, fmt.Errorf("missing or invalid token from %s", r.RemoteAddr)
+	}
+
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	return upgrader.Upgrade(w, r, nil)
+}
+
+// checkToken guards the HTTP API. Requests need the session token, as a bearer token or a
+// token query parameter. Browsers (which send an Origin) may only call it from the proxy's pages.
+func (s *Server) checkToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			scheme, value, _ := strings.Cut(auth, " ")
+			if strings.EqualFold(scheme, "Bearer") {
+				token = strings.TrimSpace(value)
+			}
+		}
+
+		if !s.validToken(token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, apiError{Code: codeUnauthorized, Error: "missing or invalid token"})
+			return
+		}
+		if r.Header.Get("Origin") != "" && !s.checkOrigin(r) {
+			writeJSON(w, http.StatusForbidden, apiError{Code: codeForbidden, Error: "cross-origin requests are not allowed"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validToken compares a token with the session token in constant time
+func (s *Server) validToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// checkOrigin accepts only requests from pages served from the proxy's own origin
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	if err != nil || origin.Host == "" {
+		return false
+	}
+	scheme := "http"
+	if s.tlsCert != nil {
+		scheme = "https"
+	}
+	return origin.Scheme == scheme && strings.EqualFold(origin.Host, r.Host)
+}
+
+// loopbackHost reports whether a Host header names this machine (localhost or a loopback IP)
+func loopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// ok is a handler that answers 200
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"localhost:9999", true},
+		{"LOCALHOST.:9999", true},
+		{"app.localhost:9999", true},
+		{"127.0.0.1:9999", true},
+		{"127.1.2.3", true},
+		{"[::1]:9999", true},
+		{"evil.example:9999", false},
+		{"localhost.evil.example", false},
+		{"192.168.1.20:9999", false},
+		{"", false},
+	}
+
+	for _, lan := range []bool{false, true} {
+		handler := (&Server{lan: lan}).checkHost(ok)
+		for _, tt := range tests {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if got := rec.Code == http.StatusOK; got != (tt.want || lan) {
+				t.Errorf("host %q (lan %v): status %d", tt.host, lan, rec.Code)
+			}
+		}
+	}
+}
+
+func TestCheckToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		header http.Header
+		want   int
+	}{
+		{"bearer token", "/api/jobs", http.Header{"Authorization": {"Bearer secret"}}, http.StatusOK},
+		{"lowercase scheme", "/api/jobs", http.Header{"Authorization": {"bearer  secret "}}, http.StatusOK},
+		{"query parameter", "/api/jobs?token=secret", nil, http.StatusOK},
+		{"proxy page", "/api/jobs?token=secret", http.Header{"Origin": {"http://localhost:9999"}}, http.StatusOK},
+		{"no token", "/api/jobs", nil, http.StatusUnauthorized},
+		{"wrong token", "/api/jobs", http.Header{"Authorization": {"Bearer secrets"}}, http.StatusUnauthorized},
+		{"bearer beats query", "/api/jobs?token=secret", http.Header{"Authorization": {"Bearer wrong"}}, http.StatusUnauthorized},
+		{"other origin", "/api/jobs?token=secret", http.Header{"Origin": {"http://evil.example"}}, http.StatusForbidden},
+		{"other scheme", "/api/jobs?token=secret", http.Header{"Origin": {"https://localhost:9999"}}, http.StatusForbidden},
+		{"opaque origin", "/api/jobs?token=secret", http.Header{"Origin": {"null"}}, http.StatusForbidden},
+	}
+
+	handler := (&Server{token: "secret"}).checkToken(ok)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Host = "localhost:9999"
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	s := &Server{token: "secret"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := s.upgrade(w, r); err == nil {
+			conn.Close()
+		}
+	}))
+	defer ts.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http")
+	tests := []struct {
+		name   string
+		query  string
+		origin string
+		want   bool
+	}{
+		{"proxy page", "?token=secret", ts.URL, true},
+		{"no token", "", ts.URL, false},
+		{"wrong token", "?token=nope", ts.URL, false},
+		{"other origin", "?token=secret", "http://evil.example", false},
+		{"no origin", "?token=secret", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL+tt.query, header)
+			if conn != nil {
+				conn.Close()
+			}
+			if (err == nil) != tt.want {
+				t.Errorf("Dial() = %v, want success %v", err, tt.want)
+			}
+			if !tt.want && resp != nil && resp.StatusCode != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestSaveToken(t *testing.T) {
+	dir := t.TempDir()
+	s := &Server{token: "secret", projectDir: dir}
+	path := filepath.Join(dir, filepath.FromSlash(TokenFile))
+
+	// An earlier, readable token file is tightened
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("old\n"), 0644)
+
+	if err := s.SaveToken(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %v, want 0600", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "secret\n" {
+		t.Errorf("token file = %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(filepath.Dir(path), ".gitignore")); !strings.Contains(string(data), "\ntoken\n") {
+		t.Errorf("token file isn't ignored: %q", data)
+	}
+
+	s.RemoveToken()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("token file survived RemoveToken: %v", err)
+	}
+}
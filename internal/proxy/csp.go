@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var (
+	metaTagPattern     = regexp.MustCompile(`(?i)<meta\s[^>]*>`)
+	cspEquivPattern    = regexp.MustCompile(`(?i)\shttp-equiv\s*=\s*["']?content-security-policy(?:["'\s/>]|$)`)
+	contentAttrPattern = regexp.MustCompile(`(?i)\scontent\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+)
+
+// cspRewriter extends a page's Content-Security-Policy with the nonce of the overlay's tags,
+// eval for Alpine and the proxy's origin, leaving the rest of the policy as it was
+type cspRewriter struct {
+	nonce     string // Put on the injected tags
+	origin    string // The proxy's origin as the browser sees it, e.g. http://localhost:9999
+	wsOrigin  string // The same origin for WebSockets, e.g. ws://localhost:9999
+	rewritten bool   // A policy was found and rewritten
+}
+
+// newCSPRewriter creates a rewriter with a fresh nonce for the response to req. The proxy's
+// origin comes from the X-Forwarded headers set by the Director.
+func newCSPRewriter(req *http.Request) *cspRewriter {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	c := &cspRewriter{nonce: base64.StdEncoding.EncodeToString(nonce), origin: "'self'"}
+
+	if req == nil || req.Header.Get("X-Forwarded-Host") == "" {
+		return c
+	}
+	host := req.Header.Get("X-Forwarded-Host")
+	if req.Header.Get("X-Forwarded-Proto") == "https" {
+		c.origin, c.wsOrigin = "https://"+host, "wss://"+host
+	} else {
+		c.origin, c.wsOrigin = "http://"+host, "ws://"+host
+	}
+	return c
+}
+
+// rewriteHeaders rewrites the Content-Security-Policy headers of a response.
+// Report-only policies don't block anything and are left alone.
+func (c *cspRewriter) rewriteHeaders(header http.Header) {
+	values := header.Values("Content-Security-Policy")
+	if len(values) == 0 {
+		return
+	}
+	header.Del("Content-Security-Policy")
+	for _, value := range values {
+		header.Add("Content-Security-Policy", c.rewrite(value))
+	}
+}
+
+// rewriteMeta rewrites <meta http-equiv="Content-Security-Policy"> tags in an HTML fragment
+func (c *cspRewriter) rewriteMeta(data []byte) []byte {
+	return metaTagPattern.ReplaceAllFunc(data, func(tag []byte) []byte {
+		if !cspEquivPattern.Match(tag) {
+			return tag
+		}
+		m := contentAttrPattern.FindSubmatchIndex(tag)
+		if m == nil {
+			return tag
+		}
+		var value []byte
+		if m[2] >= 0 {
+			value = tag[m[2]:m[3]]
+		} else {
+			value = tag[m[4]:m[5]] // Single-quoted
+		}
+
+		policy := c.rewrite(html.UnescapeString(string(value)))
+		rewritten := append([]byte(nil), tag[:m[0]]...)
+		rewritten = append(rewritten, ` content="`+html.EscapeString(policy)+`"`...)
+		return append(rewritten, tag[m[1]:]...)
+	})
+}
+
+// rewrite rewrites a policy value, which can hold several comma-separated policies
+func (c *cspRewriter) rewrite(value string) string {
+	c.rewritten = true
+	policies := strings.Split(value, ",")
+	for i, policy := range policies {
+		policies[i] = c.rewritePolicy(policy)
+	}
+	return strings.Join(policies, ", ")
+}
+
+// rewritePolicy adds what the overlay needs to a single policy: its own tags, which carry
+// the nonce, eval for Alpine and requests to the proxy. Everything it loads comes from the
+// proxy, and it needs no style attributes.
+func (c *cspRewriter) rewritePolicy(policy string) string {
+	p := parsePolicy(policy)
+
+	// Injected scripts, plus eval for Alpine, which compiles its x- attributes into functions
+	if d := p.ensure("script-src", "default-src"); d != nil {
+		c.allowTags(d)
+		d.add("'unsafe-eval'")
+	}
+	if d := p.lookup("script-src-elem"); d != nil {
+		c.allowTags(d)
+	}
+
+	// inject.css and the <style> elements of Tailwind and the overlay
+	if d := p.ensure("style-src", "default-src"); d != nil {
+		c.allowTags(d)
+	}
+	if d := p.lookup("style-src-elem"); d != nil {
+		c.allowTags(d)
+	}
+
+	// The WebSockets, the API and the cursor and icon images
+	if d := p.ensure("connect-src", "default-src"); d != nil {
+		d.add(c.origin)
+		if c.wsOrigin != "" {
+			d.add(c.wsOrigin)
+		}
+	}
+	if d := p.ensure("img-src", "default-src"); d != nil {
+		d.add(c.origin)
+	}
+
+	return p.String()
+}
+
+// allowTags lets the injected <script>, <link> and <style> tags load under a directive.
+// A nonce would switch off 'unsafe-inline' and break the page's own inline code, so pages
+// relying on it get the proxy's origin instead.
+func (c *cspRewriter) allowTags(d *cspDirective) {
+	if d.allowsInline() {
+		d.add(c.origin)
+	} else {
+		d.add("'nonce-" + c.nonce + "'")
+	}
+}
+
+// cspPolicy is a parsed policy; directive order is kept
+type cspPolicy struct {
+	directives []*cspDirective
+}
+
+// cspDirective is one directive of a policy and its source list
+type cspDirective struct {
+	name    string
+	sources []string
+}
+
+// parsePolicy splits a policy into directives
+func parsePolicy(policy string) *cspPolicy {
+	p := &cspPolicy{}
+	for _, part := range strings.Split(policy, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		p.directives = append(p.directives, &cspDirective{name: strings.ToLower(fields[0]), sources: fields[1:]})
+	}
+	return p
+}
+
+// lookup returns a directive, or nil if the policy doesn't have it
+func (p *cspPolicy) lookup(name string) *cspDirective {
+	for _, d := range p.directives {
+		if d.name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// ensure returns a directive, creating it as a copy of the directive it falls back to so
+// that extending it doesn't loosen anything else. It returns nil if neither is set, since
+// nothing is restricted then.
+func (p *cspPolicy) ensure(name, fallback string) *cspDirective {
+	if d := p.lookup(name); d != nil {
+		return d
+	}
+	base := p.lookup(fallback)
+	if base == nil {
+		return nil
+	}
+	d := &cspDirective{name: name, sources: append([]string(nil), base.sources...)}
+	p.directives = append(p.directives, d)
+	return d
+}
+
+// String formats the policy
+func (p *cspPolicy) String() string {
+	parts := make([]string, len(p.directives))
+	for i, d := range p.directives {
+		parts[i] = strings.Join(append([]string{d.name}, d.sources...), " ")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// has reports whether the source list contains source (keywords are case-insensitive)
+func (d *cspDirective) has(source string) bool {
+	for _, s := range d.sources {
+		if strings.EqualFold(s, source) {
+			return true
+		}
+	}
+	return false
+}
+
+// add appends sources that aren't in the list yet. 'none' can't be combined with
+// other sources, so it goes.
+func (d *cspDirective) add(sources ...string) {
+	if len(d.sources) == 1 && strings.EqualFold(d.sources[0], "'none'") {
+		d.sources = nil
+	}
+	for _, source := range sources {
+		if !d.has(source) {
+			d.sources = append(d.sources, source)
+		}
+	}
+}
+
+// allowsInline reports whether inline code is allowed: browsers ignore 'unsafe-inline'
+// next to nonces, hashes or 'strict-dynamic'
+func (d *cspDirective) allowsInline() bool {
+	if !d.has("'unsafe-inline'") {
+		return false
+	}
+	for _, s := range d.sources {
+		s = strings.ToLower(s)
+		if strings.HasPrefix(s, "'nonce-") || strings.HasPrefix(s, "'sha") || s == "'strict-dynamic'" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testCSP is a rewriter with a fixed nonce for a proxy on localhost:9999
+func testCSP() *cspRewriter {
+	return &cspRewriter{nonce: "N", origin: "http://localhost:9999", wsOrigin: "ws://localhost:9999"}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   string
+	}{
+		{"default-src 'self'", "default-src 'self'"},
+		{"  default-src   'self'  https://cdn.example ; ; img-src * ", "default-src 'self' https://cdn.example; img-src *"},
+		{"Script-Src 'SELF'", "script-src 'SELF'"},
+		{"upgrade-insecure-requests; frame-ancestors 'none'", "upgrade-insecure-requests; frame-ancestors 'none'"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := parsePolicy(tt.policy).String(); got != tt.want {
+			t.Errorf("parsePolicy(%q) = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestRewritePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		want   string
+	}{
+		{
+			name:   "default-src only",
+			policy: "default-src 'self'",
+			want: "default-src 'self'; script-src 'self' 'nonce-N' 'unsafe-eval'; style-src 'self' 'nonce-N'; " +
+				"connect-src 'self' http://localhost:9999 ws://localhost:9999; img-src 'self' http://localhost:9999",
+		},
+		{
+			name:   "unsafe-inline gets the origin instead of a nonce",
+			policy: "script-src 'self' 'unsafe-inline'; style-src 'unsafe-inline'",
+			want:   "script-src 'self' 'unsafe-inline' http://localhost:9999 'unsafe-eval'; style-src 'unsafe-inline' http://localhost:9999",
+		},
+		{
+			name:   "unsafe-inline ignored next to a nonce",
+			policy: "script-src 'nonce-abc' 'unsafe-inline' 'strict-dynamic'",
+			want:   "script-src 'nonce-abc' 'unsafe-inline' 'strict-dynamic' 'nonce-N' 'unsafe-eval'",
+		},
+		{
+			name:   "none is replaced",
+			policy: "img-src 'none'; connect-src 'none'",
+			want:   "img-src http://localhost:9999; connect-src http://localhost:9999 ws://localhost:9999",
+		},
+		{
+			name:   "elem directives",
+			policy: "script-src 'self'; script-src-elem 'self'; style-src-elem 'self'",
+			want:   "script-src 'self' 'nonce-N' 'unsafe-eval'; script-src-elem 'self' 'nonce-N'; style-src-elem 'self' 'nonce-N'",
+		},
+		{
+			name:   "sources aren't repeated",
+			policy: "connect-src http://localhost:9999 WS://LOCALHOST:9999",
+			want:   "connect-src http://localhost:9999 WS://LOCALHOST:9999",
+		},
+		{
+			name:   "unrelated directives untouched",
+			policy: "frame-ancestors 'none'; upgrade-insecure-requests",
+			want:   "frame-ancestors 'none'; upgrade-insecure-requests",
+		},
+		{
+			name:   "eval but no style attributes",
+			policy: "script-src 'self'; style-src 'self'",
+			want:   "script-src 'self' 'nonce-N' 'unsafe-eval'; style-src 'self' 'nonce-N'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testCSP().rewritePolicy(tt.policy); got != tt.want {
+				t.Errorf("rewritePolicy(%q)\n got %q\nwant %q", tt.policy, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteSeveralPolicies(t *testing.T) {
+	got := testCSP().rewrite("script-src 'self', img-src 'none'")
+	want := "script-src 'self' 'nonce-N' 'unsafe-eval', img-src http://localhost:9999"
+	if got != want {
+		t.Errorf("rewrite() = %q, want %q", got, want)
+	}
+}
+
+func TestRewriteHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Add("Content-Security-Policy", "script-src 'self'")
+	header.Set("Content-Security-Policy-Report-Only", "script-src 'none'")
+
+	c := testCSP()
+	c.rewriteHeaders(header)
+
+	if got := header.Get("Content-Security-Policy"); got != "script-src 'self' 'nonce-N' 'unsafe-eval'" {
+		t.Errorf("policy = %q", got)
+	}
+	if got := header.Get("Content-Security-Policy-Report-Only"); got != "script-src 'none'" {
+		t.Errorf("report-only policy = %q", got)
+	}
+	if !c.rewritten {
+		t.Error("rewritten not set")
+	}
+}
+
+func TestRewriteMeta(t *testing.T) {
+	html := `<meta charset="utf-8">` +
+		`<META HTTP-EQUIV="Content-Security-Policy" CONTENT="script-src &#39;self&#39;">` +
+		`<meta http-equiv='content-security-policy' content='img-src "none"'>`
+
+	got := string(testCSP().rewriteMeta([]byte(html)))
+
+	for _, want := range []string{
+		`<meta charset="utf-8">`,
+		`content="script-src &#39;self&#39; &#39;nonce-N&#39; &#39;unsafe-eval&#39;"`,
+		`content="img-src &#34;none&#34; http://localhost:9999"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("rewriteMeta() = %s\nmissing %s", got, want)
+		}
+	}
+}
+
+func TestNewCSPRewriterOrigin(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:3000/", nil)
+	req.Header.Set("X-Forwarded-Host", "localhost:9999")
+	req.Header.Set("X-Forwarded-Proto", "https")
+
+	c := newCSPRewriter(req)
+	if c.origin != "https://localhost:9999" || c.wsOrigin != "wss://localhost:9999" {
+		t.Errorf("origin = %q, %q", c.origin, c.wsOrigin)
+	}
+	if c.nonce == "" || c.nonce == newCSPRewriter(req).nonce {
+		t.Error("nonce isn't fresh per response")
+	}
+}
@@ -0,0 +1,319 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Where candidate ports come from, most trusted first
+const (
+	sourceScript  = "package.json"
+	sourceDefault = "default port"
+	sourceSocket  = "listening socket"
+)
+
+// defaultPorts are the ports popular dev servers use out of the box
+var defaultPorts = []int{5173, 3000, 8080, 4200, 8000}
+
+// portConfigs are framework configs that can set the dev server port
+var portConfigs = []string{
+	"vite.config.js", "vite.config.ts", "vite.config.mjs", "vite.config.mts", "vite.config.cjs",
+	"next.config.js", "next.config.mjs", "next.config.ts",
+	"angular.json",
+}
+
+var (
+	scriptPortPattern = regexp.MustCompile(`(?:--port[= ]|-p[= ]|PORT=)(\d{2,5})\b`)
+	configPortPattern = regexp.MustCompile(`"?\bport"?\s*:\s*(\d{2,5})\b`)
+	titlePattern      = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// frameworkHints recognize the framework behind a page by a string in its HTML. More
+// specific frameworks come first, since several of them build on Vite.
+var frameworkHints = []struct {
+	framework string
+	hint      string
+}{
+	{"SvelteKit", "__sveltekit"},
+	{"Astro", "astro-island"},
+	{"Nuxt", "/_nuxt/"},
+	{"Remix", "__remixContext"},
+	{"Next.js", "/_next/"},
+	{"Angular", "polyfills.js"},
+	{"Create React App", "/static/js/bundle.js"},
+	{"Vite", "/@vite/client"},
+}
+
+// DevServer is a dev server found on this machine
+type DevServer struct {
+	Target    Target
+	Framework string // e.g. "Vite"; empty if unknown
+	Title     string // The page's <title>
+	Source    string // Where the port came from, e.g. "vite.config.ts"
+}
+
+// String describes the dev server for the picker
+func (d DevServer) String() string {
+	s := d.Target.URL.String()
+	if d.Framework != "" {
+		s += " · " + d.Framework
+	}
+	if d.Title != "" {
+		s += fmt.Sprintf(" · %q", d.Title)
+	}
+	return s + " (" + d.Source + ")"
+}
+
+// candidate is a port that may belong to a dev server
+type candidate struct {
+	port   int
+	source string
+	rank   int // Lower is more likely
+}
+
+// DetectDevServers finds the dev servers serving HTML on this machine, most likely first.
+// Ports come from the project's package.json scripts and framework configs, the frameworks'
+// default ports and, on Linux, the listening sockets; each is probed over HTTP. The
+// proxy's own port (exclude) is skipped.
+func DetectDevServers(projectDir string, exclude int) []DevServer {
+	candidates := candidatePorts(projectDir, exclude)
+
+	// One client for every probe; its connections are closed once they're all done
+	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Timeout: 2 * time.Second, Transport: transport}
+
+	results := make([]*DevServer, len(candidates))
+	var wg sync.WaitGroup
+	for i, c := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probe(client, c)
+		}()
+	}
+	wg.Wait()
+
+	var found []DevServer
+	for _, result := range results {
+		if result != nil {
+			found = append(found, *result)
+		}
+	}
+	return found
+}
+
+// candidatePorts collects the ports to probe, ranked and without duplicates
+func candidatePorts(projectDir string, exclude int) []candidate {
+	seen := map[int]bool{exclude: true}
+	var candidates []candidate
+	add := func(port int, source string, rank int) {
+		if port <= 0 || port > 65535 || seen[port] {
+			return
+		}
+		seen[port] = true
+		candidates = append(candidates, candidate{port: port, source: source, rank: rank})
+	}
+
+	for _, port := range scriptPorts(projectDir) {
+		add(port, sourceScript, 0)
+	}
+	for _, name := range portConfigs {
+		for _, port := range configPorts(filepath.Join(projectDir, name)) {
+			add(port, name, 1)
+		}
+	}
+	for _, port := range defaultPorts {
+		add(port, sourceDefault, 2)
+	}
+	for _, port := range listeningPorts() {
+		add(port, sourceSocket, 3)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].rank < candidates[j].rank })
+	return candidates
+}
+
+// scriptPorts finds ports set on the command line of package.json scripts (--port, -p, PORT=)
+func scriptPorts(projectDir string) []int {
+	data, err := os.ReadFile(filepath.Join(projectDir, "package.json"))
+	if err != nil {
+		return nil
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if json.Unmarshal(data, &pkg) != nil {
+		return nil
+	}
+
+	// Dev scripts first, the rest in a stable order
+	names := make([]string, 0, len(pkg.Scripts))
+	for name := range pkg.Scripts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if devi, devj := names[i] == "dev", names[j] == "dev"; devi != devj {
+			return devi
+		}
+		return names[i] < names[j]
+	})
+
+	var ports []int
+	for _, name := range names {
+		for _, m := range scriptPortPattern.FindAllStringSubmatch(pkg.Scripts[name], -1) {
+			port, _ := strconv.Atoi(m[1])
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// configPorts finds "port: 1234" settings in a framework config
+func configPorts(path string) []int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var ports []int
+	for _, m := range configPortPattern.FindAllSubmatch(data, -1) {
+		port, _ := strconv.Atoi(string(m[1]))
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// listeningPorts lists the TCP ports listening on loopback or all interfaces, from
+// /proc/net/tcp and /proc/net/tcp6 (Linux only; empty elsewhere). Privileged ports are
+// skipped, since dev servers don't use them.
+func listeningPorts() []int {
+	var ports []int
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // Header
+		for scanner.Scan() {
+			// sl local_address rem_address st ...; st 0A is LISTEN
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 || fields[3] != "0A" {
+				continue
+			}
+			addr, portHex, ok := strings.Cut(fields[1], ":")
+			if !ok {
+				continue
+			}
+			port, err := strconv.ParseUint(portHex, 16, 16)
+			if err != nil || port < 1024 {
+				continue
+			}
+			if ip := procIP(addr); ip != nil && (ip.IsLoopback() || ip.IsUnspecified()) {
+				ports = append(ports, int(port))
+			}
+		}
+		f.Close()
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// procIP decodes an address from /proc/net/tcp*: hex, with each 32-bit word in host
+// (little-endian) byte order
+func procIP(s string) net.IP {
+	raw, err := hex.DecodeString(s)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return net.IP(raw)
+}
+
+// probe checks whether a candidate port serves an HTML page with client, and describes it
+func probe(client *http.Client, c candidate) *DevServer {
+	addr := fmt.Sprintf("localhost:%d", c.port)
+	conn, err := net.DialTimeout("tcp", addr, 500*time.Millisecond)
+	if err != nil {
+		return nil
+	}
+	conn.Close()
+
+	target := detectScheme(addr)
+	req, err := http.NewRequest(http.MethodGet, target.URL.String(), nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Accept", "text/html")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if !strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	// Another layrr proxy
+	if strings.Contains(string(body), "/__layrr/") {
+		return nil
+	}
+
+	server := &DevServer{Target: target, Source: c.source, Framework: framework(resp, string(body))}
+	if m := titlePattern.FindSubmatch(body); m != nil {
+		server.Title = strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	}
+	return server
+}
+
+// framework guesses the framework behind a page from its HTML and headers
+func framework(resp *http.Response, body string) string {
+	for _, f := range frameworkHints {
+		if strings.Contains(body, f.hint) {
+			return f.framework
+		}
+	}
+	if poweredBy := resp.Header.Get("X-Powered-By"); poweredBy != "" {
+		return poweredBy
+	}
+	return ""
+}
+
+// detectScheme tells whether a local dev server speaks HTTPS by attempting a TLS handshake
+func detectScheme(addr string) Target {
+	target := Target{URL: &url.URL{Scheme: "http", Host: addr, Path: "/"}}
+
+	dialer := &net.Dialer{Timeout: 500 * time.Millisecond}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return target
+	}
+	conn.Close()
+	target.URL.Scheme = "https"
+
+	if conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: "localhost"}); err == nil {
+		conn.Close()
+	} else {
+		target.Insecure = true
+	}
+	return target
+}
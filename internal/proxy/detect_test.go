@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestProcIP(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string // Empty for nil
+	}{
+		{"0100007F", "127.0.0.1"},
+		{"00000000", "0.0.0.0"},
+		{"0101A8C0", "192.168.1.1"},
+		{"00000000000000000000000001000000", "::1"},
+		{"00000000000000000000000000000000", "::"},
+		{"0000000000000000FFFF00000100007F", "127.0.0.1"}, // IPv4-mapped
+		{"B80D0120000000000000000001000000", "2001:db8::1"},
+		{"0100", ""},
+		{"ZZ00007F", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		ip := procIP(tt.addr)
+		if tt.want == "" {
+			if ip != nil {
+				t.Errorf("procIP(%q) = %s, want nil", tt.addr, ip)
+			}
+			continue
+		}
+		if !ip.Equal(net.ParseIP(tt.want)) {
+			t.Errorf("procIP(%q) = %s, want %s", tt.addr, ip, tt.want)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentType   string
+		body          string
+		want          bool
+		wantTitle     string
+		wantFramework string
+	}{
+		{
+			name:        "vite app",
+			contentType: "text/html",
+			body: `<html><head><title>  My
+				App </title><script type="module" src="/@vite/client"></script></head></html>`,
+			want:          true,
+			wantTitle:     "My App",
+			wantFramework: "Vite",
+		},
+		{
+			name:        "API",
+			contentType: "application/json",
+			body:        `{"ok":true}`,
+		},
+		{
+			name:        "another layrr proxy",
+			contentType: "text/html",
+			body:        `<html><head><script src="/__layrr/inject.js"></script></head></html>`,
+		},
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+			u, _ := url.Parse(server.URL)
+			port, _ := strconv.Atoi(u.Port())
+
+			found := probe(client, candidate{port: port, source: "test"})
+			if found == nil {
+				if tt.want {
+					t.Fatal("probe() found nothing")
+				}
+				return
+			}
+			if !tt.want {
+				t.Fatalf("probe() = %+v, want nothing", found)
+			}
+			if found.Title != tt.wantTitle || found.Framework != tt.wantFramework || found.Source != "test" {
+				t.Errorf("probe() = %+v", found)
+			}
+			if found.Target.URL.Scheme != "http" || found.Target.URL.Port() != u.Port() {
+				t.Errorf("target = %s", found.Target.URL)
+			}
+		})
+	}
+
+	// Nothing listening
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	if found := probe(client, candidate{port: port}); found != nil {
+		t.Errorf("probe() of a closed port = %+v", found)
+	}
+}
@@ -12,8 +12,12 @@
     PROCESSING_TIMEOUT: 300000, // 5 minutes max
     CLICK_DOUBLE_CLICK_DELAY: 250, // ms to distinguish single from double click
     RELOAD_DELAY: 1500, // ms before auto-reload after completion
+    CHANGES_RELOAD_DELAY: 4000, // ms before auto-reload when listing changed files
     WS_RECONNECT_DELAY: 2000, // ms before reconnecting WebSocket
     ERROR_RELOAD_DELAY: 2000, // ms before reloading on error
+    CANCELLED_DISMISS_DELAY: 4000, // ms before hiding the cancelled status
+    MAX_JOBS_SHOWN: 20, // Jobs kept in the queue panel
+    MAX_RECENT_JOBS: 5, // Finished jobs listed with undo/redo
 
     // UI Dimensions
     INPUT_WIDTH: 320,
@@ -38,6 +42,10 @@
     // WebSocket Endpoints
     WS_RELOAD_PATH: '/__layrr/ws/reload',
     WS_MESSAGE_PATH: '/__layrr/ws/message',
+    PROTOCOL_VERSION: 1, // Message WebSocket protocol this script speaks
+
+    // Session token the proxy put on this script's tag; the WebSockets need it
+    ACCESS_TOKEN: (document.currentScript && document.currentScript.dataset.layrrToken) || '',
 
     // Cursor
     CURSOR_URL: '/__layrr/cursor.svg',
@@ -51,7 +59,8 @@
     VC_UI_SELECTOR: '.vc-selection-rect, .vc-selection-info, .vc-inline-input, ' +
                    '.vc-status-indicator, .vc-text-editor, .vc-mode-toolbar, .vc-design-modal, ' +
                    '.vc-control-bar, .vc-drag-handles, .vc-visual-toolbar, .vc-hover-drag-handle, ' +
-                   '.vc-reorder-placeholder, .vc-action-menu, .vc-history-panel',
+                   '.vc-reorder-placeholder, .vc-action-menu, .vc-history-panel, .vc-cancel-button, ' +
+                   '.vc-jobs-panel, .vc-diff-panel',
   };
 
   // ============================================================================
@@ -134,6 +143,114 @@
       return path.join(' > ');
     },
 
+    /**
+     * Find where an element is defined in the project's source.
+     * Checks, in order: a data-layrr-src="file:line:column" stamp from a build plugin,
+     * React dev fibers (_debugSource and owner names), Vue's __file and Svelte's
+     * dev metadata. The server resolves the result to a project file.
+     * @param {Element} element - DOM element
+     * @returns {Object|null} { file, line, column, component, via } or null
+     */
+    getSourceInfo(element) {
+      if (!element) return null;
+
+      // Build plugin stamp, on the element or its closest stamped ancestor
+      const stamped = element.closest ? element.closest('[data-layrr-src]') : null;
+      if (stamped) {
+        const match = stamped.getAttribute('data-layrr-src').match(/^(.*?)(?::(\d+))?(?::(\d+))?$/);
+        if (match && match[1]) {
+          return {
+            file: match[1],
+            line: match[2] ? parseInt(match[2], 10) : 0,
+            column: match[3] ? parseInt(match[3], 10) : 0,
+            component: '',
+            via: 'attribute',
+          };
+        }
+      }
+
+      return this.getReactSource(element)
+        || this.getVueSource(element)
+        || this.getSvelteSource(element);
+    },
+
+    /**
+     * React dev builds keep JSX locations (React <19) and owner components on fibers
+     */
+    getReactSource(element) {
+      const key = Object.keys(element).find(k =>
+        k.startsWith('__reactFiber$') || k.startsWith('__reactInternalInstance$'));
+      if (!key) return null;
+
+      const componentName = (fiber) => {
+        const type = fiber && fiber.type;
+        if (!type || typeof type === 'string') return '';
+        return type.displayName || type.name
+          || (type.render && (type.render.displayName || type.render.name)) || '';
+      };
+
+      let component = '';
+      for (let fiber = element[key]; fiber; fiber = fiber.return) {
+        if (!component) {
+          component = componentName(fiber._debugOwner) || componentName(fiber);
+        }
+        const source = fiber._debugSource;
+        if (source && source.fileName) {
+          return {
+            file: source.fileName,
+            line: source.lineNumber || 0,
+            column: source.columnNumber || 0,
+            component: component,
+            via: 'react',
+          };
+        }
+      }
+
+      return component ? { file: '', line: 0, column: 0, component: component, via: 'react' } : null;
+    },
+
+    /**
+     * Vue dev builds record each component's single-file component path in __file
+     */
+    getVueSource(element) {
+      for (let el = element; el; el = el.parentElement) {
+        // Vue 3
+        for (let instance = el.__vueParentComponent; instance; instance = instance.parent) {
+          const type = instance.type || {};
+          if (type.__file || type.name || type.__name) {
+            return { file: type.__file || '', line: 0, column: 0, component: type.name || type.__name || '', via: 'vue' };
+          }
+        }
+        // Vue 2
+        if (el.__vue__) {
+          const options = el.__vue__.$options || {};
+          return { file: options.__file || '', line: 0, column: 0, component: options.name || '', via: 'vue' };
+        }
+      }
+      return null;
+    },
+
+    /**
+     * Svelte dev builds attach __svelte_meta.loc to elements
+     */
+    getSvelteSource(element) {
+      for (let el = element; el; el = el.parentElement) {
+        const loc = el.__svelte_meta && el.__svelte_meta.loc;
+        if (loc && loc.file) {
+          // Svelte 3/4 lines are 0-based (and carry a char offset); Svelte 5 lines are 1-based
+          const zeroBased = typeof loc.char === 'number';
+          return {
+            file: loc.file,
+            line: (loc.line || 0) + (zeroBased ? 1 : 0),
+            column: (loc.column || 0) + (zeroBased ? 1 : 0),
+            component: '',
+            via: 'svelte',
+          };
+        }
+      }
+      return null;
+    },
+
     /**
      * Get element information object
      * @param {Element} element - DOM element
@@ -213,6 +330,7 @@
         outerHTML: element.outerHTML || '',
         parent: parentInfo,
         siblings: siblings,
+        source: this.getSourceInfo(element),
       };
     },
 
@@ -436,7 +554,36 @@
     getWebSocketURL(path) {
       const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
       const host = window.location.host;
-      return `${protocol}//${host}${path}`;
+      const token = encodeURIComponent(window.VCConstants.ACCESS_TOKEN);
+      return `${protocol}//${host}${path}?token=${token}`;
+    },
+
+    /**
+     * Escape text for safe use inside x-html bindings
+     * @param {string} text - Untrusted text
+     * @returns {string} HTML-escaped text
+     */
+    escapeHTML(text) {
+      const div = document.createElement('div');
+      div.textContent = String(text);
+      return div.innerHTML;
+    },
+
+    /**
+     * Summarize the files a job changed for the status indicator
+     * @param {Array<{path: string, change: string}>} changes - Changed files
+     * @returns {string} HTML summary (escaped)
+     */
+    formatChanges(changes) {
+      if (!changes || changes.length === 0) {
+        return 'no files changed';
+      }
+
+      const markers = { created: '+', modified: '~', deleted: '−' };
+      const list = changes
+        .map(c => `${markers[c.change] || '~'} ${this.escapeHTML(c.path)}`)
+        .join(', ');
+      return `${changes.length} file${changes.length !== 1 ? 's' : ''} changed: ${list}`;
     },
 
     /**
@@ -1,51 +1,269 @@
 package proxy
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/andybalholm/brotli"
 )
 
-// InjectScript injects JavaScript and CSS into HTML responses
-func InjectScript(resp *http.Response, baseURL string) error {
+// injectMarkers are the closing tags the injection goes in front of, whichever comes first.
+// </html> catches documents without a head or body end tag.
+var injectMarkers = [][]byte{[]byte("</head>"), []byte("</body>"), []byte("</html>")}
+
+// maxHeldTag is the longest unfinished tag held back at the end of a chunk, so markers and
+// CSP meta tags split across chunks are still found
+const maxHeldTag = 8 * 1024
+
+// supportedEncodings are the content codings InjectScript can decode and re-encode
+var supportedEncodings = map[string]bool{"gzip": true, "x-gzip": true, "deflate": true, "br": true, "identity": true}
+
+// AcceptedEncodings filters an Accept-Encoding header down to the codings InjectScript
+// supports, so the dev server never compresses HTML in a way the proxy can't read
+func AcceptedEncodings(header string) string {
+	var kept []string
+	for _, part := range strings.Split(header, ",") {
+		coding, _, _ := strings.Cut(part, ";")
+		if supportedEncodings[strings.ToLower(strings.TrimSpace(coding))] {
+			kept = append(kept, strings.TrimSpace(part))
+		}
+	}
+	return strings.Join(kept, ", ")
+}
+
+// pageRequest reports whether req loads a page (or frame) rather than a subresource.
+// Pages carry the session token, so they're never revalidated against an older copy.
+func pageRequest(req *http.Request) bool {
+	switch req.Header.Get("Sec-Fetch-Dest") {
+	case "document", "iframe", "frame":
+		return true
+	case "":
+		return strings.Contains(req.Header.Get("Accept"), "text/html")
+	}
+	return false
+}
+
+// InjectScript injects JavaScript and CSS into HTML responses.
+//
+// The body is streamed: chunks are passed through as they arrive and the tags are inserted
+// as soon as </head> or </body> shows up, so streamed server rendering reaches the browser
+// without waiting for the whole page. Compressed bodies are decoded and re-encoded with the
+// same content coding.
+//
+// Content-Security-Policy headers and <meta http-equiv> policies are rewritten so the
+// injected tags (which carry a per-response nonce) and the WebSockets are allowed.
+// The session token the WebSockets require is passed to inject-utils.js. It changes
+// with every run, so injected pages are marked as not to be stored by the browser.
+func InjectScript(resp *http.Response, baseURL, token string) error {
+	// A revalidated page keeps its cached body, whose nonce only matches the cached policy
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Header.Del("Content-Security-Policy")
+		return nil
+	}
+
 	// Only inject into HTML responses
 	contentType := resp.Header.Get("Content-Type")
 	if !strings.Contains(contentType, "text/html") {
 		return nil
 	}
 
-	// Check if response is compressed
-	contentEncoding := resp.Header.Get("Content-Encoding")
-	var bodyReader io.Reader = resp.Body
+	// Nothing to inject into without a (complete) body
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return nil
+	}
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusPartialContent:
+		return nil
+	}
+	if resp.ContentLength == 0 {
+		return nil
+	}
+
+	// Leave bodies in codings we can't re-encode untouched
+	contentEncoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if contentEncoding != "" && !supportedEncodings[contentEncoding] {
+		return nil
+	}
+
+	csp := newCSPRewriter(resp.Request)
+	csp.rewriteHeaders(resp.Header)
+
+	// A cached copy would come back with an earlier run's token and nonce
+	resp.Header.Set("Cache-Control", "no-store")
+	resp.Header.Del("ETag")
+	resp.Header.Del("Last-Modified")
+	resp.Header.Del("Expires")
+
+	resp.Body = &injector{
+		src:      resp.Body,
+		encoding: contentEncoding,
+		baseURL:  baseURL,
+		token:    token,
+		csp:      csp,
+	}
+
+	// The length changes, so the body is sent chunked (which also makes the reverse proxy
+	// flush every chunk straight to the browser)
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Del("Transfer-Encoding")
+
+	return nil
+}
+
+// encoder is a compressing writer that can push out what it has buffered
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// injector is a response body that inserts tags into the HTML flowing through it
+type injector struct {
+	src      io.ReadCloser // Upstream body, possibly compressed
+	encoding string        // Content-Encoding of src (and of the output)
+	baseURL  string        // Where the injected assets are served
+	token    string        // Session token for the WebSockets
+	csp      *cspRewriter
+
+	decoded io.Reader    // src, decompressed
+	enc     encoder      // Compresses into out; nil for uncompressed bodies
+	out     bytes.Buffer // Output waiting to be read
+	buf     []byte       // Read buffer
+
+	pending  []byte // Decoded tail held back in case it's the start of a marker or meta tag
+	seen     int    // Decoded bytes seen so far
+	injected bool
+	done     bool
+	err      error
+}
+
+// Read returns the next piece of the modified body, passing upstream chunks on as soon as
+// they are read
+func (in *injector) Read(p []byte) (int, error) {
+	for in.out.Len() == 0 && !in.done {
+		if in.err != nil {
+			return 0, in.err
+		}
+		if in.decoded == nil {
+			if in.err = in.start(); in.err != nil {
+				return 0, in.err
+			}
+		}
+
+		n, err := in.decoded.Read(in.buf)
+		if n > 0 {
+			in.process(in.buf[:n])
+		}
+		switch {
+		case err == io.EOF:
+			in.finish()
+		case err != nil:
+			in.err = fmt.Errorf("failed to read response body: %w", err)
+		case in.enc != nil:
+			// Pass the chunk on now instead of when the compressor's window fills
+			in.enc.Flush()
+		}
+	}
+	if in.out.Len() == 0 {
+		if in.err != nil {
+			return 0, in.err
+		}
+		return 0, io.EOF
+	}
+	return in.out.Read(p)
+}
+
+// Close closes the upstream body
+func (in *injector) Close() error {
+	return in.src.Close()
+}
+
+// start sets up decoding and re-encoding. It's done on the first read, so a slow upstream
+// doesn't hold up the response headers.
+func (in *injector) start() error {
+	in.buf = make([]byte, 32*1024)
 
-	// Decompress if needed
-	if contentEncoding == "gzip" {
-		gzipReader, err := gzip.NewReader(resp.Body)
+	switch in.encoding {
+	case "gzip", "x-gzip":
+		r, err := gzip.NewReader(in.src)
 		if err != nil {
 			return fmt.Errorf("failed to create gzip reader: %w", err)
 		}
-		defer gzipReader.Close()
-		bodyReader = gzipReader
+		in.decoded = r
+		in.enc = gzip.NewWriter(&in.out)
+	case "deflate":
+		r, err := newDeflateReader(in.src)
+		if err != nil {
+			return fmt.Errorf("failed to create deflate reader: %w", err)
+		}
+		in.decoded = r
+		in.enc = zlib.NewWriter(&in.out)
+	case "br":
+		in.decoded = brotli.NewReader(in.src)
+		in.enc = brotli.NewWriterLevel(&in.out, brotli.DefaultCompression)
+	default:
+		in.decoded = in.src
 	}
+	return nil
+}
 
-	// Read the (potentially decompressed) response body
-	body, err := io.ReadAll(bodyReader)
+// newDeflateReader decodes "deflate" bodies, which should be zlib-wrapped but are sent as
+// raw deflate by some servers
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return nil, err
 	}
-	resp.Body.Close()
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
 
-	// Remove Content-Encoding and Transfer-Encoding headers since we're sending uncompressed
-	resp.Header.Del("Content-Encoding")
-	resp.Header.Del("Transfer-Encoding")
+// process passes a decoded chunk on, injecting the tags in front of the first marker
+func (in *injector) process(chunk []byte) {
+	in.seen += len(chunk)
+	if in.injected {
+		in.write(chunk)
+		return
+	}
 
-	// Skip injection if body is empty or too small to be valid HTML
-	if len(body) < 10 {
-		resp.Body = io.NopCloser(bytes.NewReader(body))
-		return nil
+	data := append(in.pending, chunk...)
+	in.pending = nil
+	if i := findMarker(data); i >= 0 {
+		in.write(in.csp.rewriteMeta(data[:i]))
+		in.write(in.tags())
+		in.write(data[i:])
+		in.injected = true
+		return
+	}
+
+	// Hold back an unfinished tag until the next chunk
+	end := len(data)
+	if i := bytes.LastIndexByte(data, '<'); i >= 0 && bytes.IndexByte(data[i:], '>') < 0 && len(data)-i <= maxHeldTag {
+		end = i
+	}
+	in.write(in.csp.rewriteMeta(data[:end]))
+	in.pending = append([]byte(nil), data[end:]...)
+}
+
+// tags returns the tags to inject
+func (in *injector) tags() []byte {
+	// Tailwind's runtime and the overlay create <style> elements, which a nonce-based
+	// style-src blocks unless they carry the nonce
+	var shim string
+	if in.csp.rewritten {
+		shim = fmt.Sprintf(`
+	<script nonce="%s">(()=>{const n=document.currentScript.nonce,c=document.createElement;document.createElement=function(t,o){const e=c.call(this,t,o);if(String(t).toLowerCase()==='style')e.nonce=n;return e}})()</script>`,
+			in.csp.nonce)
 	}
 
 	// Create injection tags in correct order:
@@ -54,32 +272,58 @@ func InjectScript(resp *http.Response, baseURL string) error {
 	// 3. inject-utils.js (utilities - must load before main script)
 	// 4. inject.js (main application script - deferred)
 	// 5. Alpine.js (must load last with defer)
-	injection := fmt.Sprintf(`
-	<!-- Layrr - Alpine.js + Tailwind CSS + Custom Scripts -->
-	<script src="%s/tailwind.min.js"></script>
-	<link rel="stylesheet" href="%s/inject.css">
-	<script src="%s/inject-utils.js"></script>
-	<script defer src="%s/inject.js"></script>
-	<script defer src="%s/alpine.min.js"></script>
-`, baseURL, baseURL, baseURL, baseURL, baseURL)
-
-	// Try to inject before </body>, otherwise before </html>, otherwise at the end
-	bodyStr := string(body)
-	var modified string
-
-	if strings.Contains(bodyStr, "</body>") {
-		modified = strings.Replace(bodyStr, "</body>", injection+"</body>", 1)
-	} else if strings.Contains(bodyStr, "</html>") {
-		modified = strings.Replace(bodyStr, "</html>", injection+"</html>", 1)
-	} else {
-		modified = bodyStr + injection
-	}
-
-	// Update the response body
-	modifiedBytes := []byte(modified)
-	resp.Body = io.NopCloser(bytes.NewReader(modifiedBytes))
-	resp.ContentLength = int64(len(modifiedBytes))
-	resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(modifiedBytes)))
+	return []byte(fmt.Sprintf(`
+	<!-- Layrr - Alpine.js + Tailwind CSS + Custom Scripts -->%[3]s
+	<script nonce="%[2]s" src="%[1]s/tailwind.min.js"></script>
+	<link nonce="%[2]s" rel="stylesheet" href="%[1]s/inject.css">
+	<script nonce="%[2]s" src="%[1]s/inject-utils.js" data-layrr-token="%[4]s"></script>
+	<script nonce="%[2]s" defer src="%[1]s/inject.js"></script>
+	<script nonce="%[2]s" defer src="%[1]s/alpine.min.js"></script>
+`, in.baseURL, in.csp.nonce, shim, in.token))
+}
 
-	return nil
+// finish writes whatever is left at the end of the body
+func (in *injector) finish() {
+	in.write(in.pending)
+	in.pending = nil
+
+	// No marker: append, unless the body is empty or too small to be valid HTML
+	if !in.injected && in.seen >= 10 {
+		in.write(in.tags())
+	}
+	if in.enc != nil {
+		in.enc.Close()
+	}
+	in.done = true
+}
+
+// write adds decoded bytes to the output, compressing them if needed
+func (in *injector) write(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	if in.enc != nil {
+		in.enc.Write(p) // Writes to a bytes.Buffer don't fail
+		return
+	}
+	in.out.Write(p)
+}
+
+// findMarker returns the position of the first marker in data (case-insensitively), or -1
+func findMarker(data []byte) int {
+	// ASCII-only lowering keeps positions the same as in data
+	lower := make([]byte, len(data))
+	for i, b := range data {
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		lower[i] = b
+	}
+	first := -1
+	for _, marker := range injectMarkers {
+		if i := bytes.Index(lower, marker); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	return first
 }
@@ -40,14 +40,15 @@
       showStatusIndicator: false,
       showDesignModal: false,
 
-      // UI Data
-      selectionRectStyle: '',
-      selectionInfoStyle: '',
+      // UI Data. Styles are objects: Alpine applies those through el.style, which a
+      // page's Content-Security-Policy allows, rather than as style attributes.
+      selectionRectStyle: {},
+      selectionInfoStyle: {},
       selectionInfoText: '',
-      inlineInputStyle: '',
+      inlineInputStyle: {},
       inlineInputBadge: '',
       inlineInputText: '',
-      textEditorStyle: '',
+      textEditorStyle: {},
       textEditorLabel: 'Edit text content',
       textEditorValue: '',
       textEditorPreview: '',
@@ -79,9 +80,9 @@
         elementStartHeight: 0,
       },
       showResizeHandles: false,
-      resizeHandlesStyle: '',
+      resizeHandlesStyle: {},
       showHoverDragHandle: false,
-      hoverDragHandleStyle: '',
+      hoverDragHandleStyle: {},
       hoverDragHandleElement: null,
 
       // Reorder Mode State
@@ -97,18 +98,18 @@
         draggedElementHeight: 0,
       },
       showReorderPlaceholder: false,
-      reorderPlaceholderStyle: '',
+      reorderPlaceholderStyle: {},
 
       // Drop Validation State
       currentDropTarget: null,
       showDropWarning: false,
       dropWarningText: '',
-      dropWarningStyle: '',
+      dropWarningStyle: {},
       isValidDrop: true,
 
       // Action Menu State (NEW)
       showActionMenu: false,
-      actionMenuStyle: '',
+      actionMenuStyle: {},
       actionMenuElement: null,
 
       // Change History State (Phase 2)
@@ -123,6 +124,13 @@
       pendingBatchResolvers: {}, // Maps batch number to promise resolvers
       batchIdMapping: {}, // Maps message ID to batch number
 
+      // Server-side job queue (shared by all connected tabs)
+      jobs: [], // Running, queued and recently finished jobs
+      currentJobId: null, // Job created by this tab's latest request
+      jobActivity: {}, // Latest agent activity by job ID, e.g. { kind: 'tool', summary: 'Editing styles.css' }
+      showJobsPanel: false, // Jobs panel opened from the control bar
+      jobDiff: null, // { jobId, instruction, lines } shown in the diff panel
+
       // ============================================================================
       // INITIALIZATION
       // ============================================================================
@@ -569,7 +577,7 @@
 
         // Show label tooltip
         this.selectionInfoText = label;
-        this.selectionInfoStyle = `left: ${rect.left + 10}px; top: ${rect.top - 30}px;`;
+        this.selectionInfoStyle = { left: `${rect.left + 10}px`, top: `${rect.top - 30}px` };
         this.showSelectionInfo = true;
       },
 
@@ -589,14 +597,14 @@
 
       updateSelectionRect() {
         const bounds = window.VCUtils.calculateBounds(this.dragStart, this.dragEnd);
-        this.selectionRectStyle = `left: ${bounds.left}px; top: ${bounds.top}px; width: ${bounds.width}px; height: ${bounds.height}px;`;
+        this.selectionRectStyle = { left: `${bounds.left}px`, top: `${bounds.top}px`, width: `${bounds.width}px`, height: `${bounds.height}px` };
       },
 
       updateSelectionInfo() {
         const width = Math.abs(this.dragEnd.x - this.dragStart.x);
         const height = Math.abs(this.dragEnd.y - this.dragStart.y);
         this.selectionInfoText = window.VCUtils.formatAreaSize(width, height);
-        this.selectionInfoStyle = `left: ${this.dragEnd.x + 10}px; top: ${this.dragEnd.y + 10}px;`;
+        this.selectionInfoStyle = { left: `${this.dragEnd.x + 10}px`, top: `${this.dragEnd.y + 10}px` };
         this.showSelectionInfo = true;
       },
 
@@ -619,7 +627,7 @@
           window.VCConstants.INPUT_HEIGHT
         );
 
-        this.inlineInputStyle = `left: ${pos.left}px; top: ${pos.top}px;`;
+        this.inlineInputStyle = { left: `${pos.left}px`, top: `${pos.top}px` };
         this.showInlineInput = true;
 
         // Focus textarea after render
@@ -909,7 +917,7 @@
           window.VCConstants.EDITOR_HEIGHT
         );
 
-        this.textEditorStyle = `left: ${pos.left}px; top: ${pos.top}px;`;
+        this.textEditorStyle = { left: `${pos.left}px`, top: `${pos.top}px` };
         this.showTextEditor = true;
 
         console.log('[Layrr] Text editor opened, showTextEditor =', this.showTextEditor);
@@ -1058,6 +1066,7 @@
           image: this.uploadedImage,
           imageType: this.uploadedImageType || 'image/png', // Default to PNG if type unknown
           prompt: this.designPrompt.trim(),
+          pageUrl: window.location.href,
         };
 
         console.log('[Layrr] Sending design for analysis...');
@@ -1072,6 +1081,24 @@
         }
       },
 
+      // ============================================================================
+      // CLAUDE CODE SESSION
+      // ============================================================================
+
+      startNewSession() {
+        if (this.isProcessing) {
+          console.warn('[Layrr] Cannot start a new session while Claude is working');
+          return;
+        }
+
+        if (this.messageWs && this.messageWs.readyState === WebSocket.OPEN) {
+          this.messageWs.send(JSON.stringify({ type: 'new-session' }));
+          console.log('[Layrr] Requested new Claude Code session');
+        } else {
+          console.error('[Layrr] ✗ WebSocket not connected');
+        }
+      },
+
       handleDesignProgress(data) {
         if (data.status === 'received') {
           console.log('[Layrr] Design received, analyzing...');
@@ -1086,6 +1113,11 @@
           setTimeout(() => {
             this.closeDesignModal();
           }, 1500);
+        } else if (data.status === 'cancelled') {
+          console.warn('[Layrr] Design request cancelled');
+          this.analysisError = 'Cancelled.';
+          this.isAnalyzing = false;
+          this.analysisStep = '';
         } else if (data.status === 'error') {
           console.error('[Layrr] Design error:', data.error);
           this.analysisError = data.error || 'An error occurred. Please try again.';
@@ -1118,7 +1150,7 @@
         const handleSize = 24;
         const handleLeft = rect.left - handleSize - 4;
         const handleTop = rect.top + (rect.height / 2) - (handleSize / 2);
-        this.hoverDragHandleStyle = `left: ${handleLeft}px; top: ${handleTop}px;`;
+        this.hoverDragHandleStyle = { left: `${handleLeft}px`, top: `${handleTop}px` };
         this.showHoverDragHandle = true;
 
         // Add scroll/resize listeners for this selected element
@@ -1136,7 +1168,7 @@
               const handleSize = 24;
               const handleLeft = rect.left - handleSize - 4;
               const handleTop = rect.top + (rect.height / 2) - (handleSize / 2);
-              this.hoverDragHandleStyle = `left: ${handleLeft}px; top: ${handleTop}px;`;
+              this.hoverDragHandleStyle = { left: `${handleLeft}px`, top: `${handleTop}px` };
             }
           };
           this._resizeListener = () => {
@@ -1152,7 +1184,7 @@
               const handleSize = 24;
               const handleLeft = rect.left - handleSize - 4;
               const handleTop = rect.top + (rect.height / 2) - (handleSize / 2);
-              this.hoverDragHandleStyle = `left: ${handleLeft}px; top: ${handleTop}px;`;
+              this.hoverDragHandleStyle = { left: `${handleLeft}px`, top: `${handleTop}px` };
             }
           };
           window.addEventListener('scroll', this._scrollListener, true);
@@ -1228,7 +1260,7 @@
           top = rect.bottom + 10;
         }
 
-        this.actionMenuStyle = `left: ${left}px; top: ${top}px;`;
+        this.actionMenuStyle = { left: `${left}px`, top: `${top}px` };
       },
 
       actionMenuEdit() {
@@ -1329,6 +1361,7 @@
           type: type, // 'transform', 'reorder', 'text'
           element: element,
           selector: window.VCUtils.getSelector(element),
+          source: window.VCUtils.getSourceInfo(element),
           timestamp: Date.now(),
           selected: true, // Default to selected
           data: data,
@@ -1716,6 +1749,19 @@
         console.log('[Layrr] Total estimated tokens:', totalTokens);
 
         try {
+          // Files changed across all batches, by path
+          const changedFiles = {};
+          let inReview = false;
+          const recordChanges = (result) => {
+            if (result && result.review) inReview = true;
+            (result && result.changes || []).forEach(c => {
+              // A file created by an earlier batch stays "created"
+              if (!changedFiles[c.path] || c.change === 'deleted') {
+                changedFiles[c.path] = c;
+              }
+            });
+          };
+
           // Check if we need to batch
           if (totalTokens > 6000) {
             console.log('[Layrr] Creating batches...');
@@ -1725,20 +1771,31 @@
             // Process batches sequentially
             for (let i = 0; i < batches.length; i++) {
               console.log(`[Layrr] Processing batch ${i + 1}/${batches.length}...`);
-              await this.sendBatchToBackend(batches[i], i + 1, batches.length);
+              recordChanges(await this.sendBatchToBackend(batches[i], i + 1, batches.length));
             }
           } else {
             // Send all changes in one batch
-            await this.sendBatchToBackend(changes, 1, 1);
+            recordChanges(await this.sendBatchToBackend(changes, 1, 1));
           }
 
           // All batches completed successfully
-          console.log('[Layrr] ✓ All changes committed successfully');
-          this.setStatus('idle');
+          const changed = Object.values(changedFiles).sort((a, b) => a.path.localeCompare(b.path));
+          console.log('[Layrr] ✓ All changes committed successfully, files changed:', changed);
+          if (inReview) {
+            this.showReviewReady(changed);
+          } else {
+            this.setStatus('complete', changed);
+          }
 
           // Clear history after successful commit
           this.clearHistory();
         } catch (error) {
+          if (error.cancelled) {
+            console.warn('[Layrr] ⏹ Commit cancelled');
+            this.showCancelled(error.files);
+            return;
+          }
+
           console.error('[Layrr] ✗ Commit failed:', error);
           this.setStatus('idle');
 
@@ -1753,6 +1810,7 @@
           const changeData = {
             selector: change.selector,
             operation: change.type || 'transform',
+            source: change.source,
           };
 
           if (change.type === 'reorder' && change.data.reorderData) {
@@ -1773,8 +1831,8 @@
           return changeData;
         });
 
-        // Generate unique message ID for this batch
-        const messageId = Date.now() + Math.random();
+        // Generate unique message ID for this batch (the protocol wants an integer)
+        const messageId = Date.now();
 
         const message = {
           type: 'apply-visual-edits',
@@ -1784,6 +1842,7 @@
             number: batchNumber,
             total: totalBatches,
           },
+          pageUrl: window.location.href,
         };
 
         if (this.messageWs && this.messageWs.readyState === WebSocket.OPEN) {
@@ -1818,8 +1877,9 @@
           console.log(`[Layrr] ✓ Batch ${batchNumber}/${totalBatches} sent`);
 
           // Wait for backend to complete this batch before proceeding
+          let result;
           try {
-            await completionPromise;
+            result = await completionPromise;
             console.log(`[Layrr] ✓ Batch ${batchNumber}/${totalBatches} completed`);
           } catch (error) {
             console.error(`[Layrr] ✗ Batch ${batchNumber}/${totalBatches} failed:`, error);
@@ -1830,6 +1890,8 @@
           if (batchNumber < totalBatches) {
             await new Promise(resolve => setTimeout(resolve, 1000));
           }
+
+          return result;
         } else {
           console.error('[Layrr] ✗ WebSocket not connected');
           throw new Error('WebSocket not connected');
@@ -1843,7 +1905,7 @@
         }
 
         const rect = this.selectedElement.getBoundingClientRect();
-        this.resizeHandlesStyle = `left: ${rect.left}px; top: ${rect.top}px; width: ${rect.width}px; height: ${rect.height}px;`;
+        this.resizeHandlesStyle = { left: `${rect.left}px`, top: `${rect.top}px`, width: `${rect.width}px`, height: `${rect.height}px` };
       },
 
       startDrag(e, direction = 'move') {
@@ -2108,15 +2170,15 @@
         // Get layout gap for proper spacing
         const gap = this.reorderMode.layoutContext.gap || 0;
 
-        let placeholderStyle = '';
+        let placeholderStyle = {};
         if (isVertical) {
           // Show slot above or below target
           const y = insertBefore ? rect.top - gap : rect.bottom + gap;
-          placeholderStyle = `left: ${rect.left}px; top: ${y}px; width: ${draggedWidth}px; height: ${draggedHeight}px;`;
+          placeholderStyle = { left: `${rect.left}px`, top: `${y}px`, width: `${draggedWidth}px`, height: `${draggedHeight}px` };
         } else {
           // Show slot left or right of target
           const x = insertBefore ? rect.left - gap : rect.right + gap;
-          placeholderStyle = `left: ${x}px; top: ${rect.top}px; width: ${draggedWidth}px; height: ${draggedHeight}px;`;
+          placeholderStyle = { left: `${x}px`, top: `${rect.top}px`, width: `${draggedWidth}px`, height: `${draggedHeight}px` };
         }
 
         this.reorderPlaceholderStyle = placeholderStyle;
@@ -2270,7 +2332,7 @@
       showInvalidDropWarning(x, y) {
         this.showDropWarning = true;
         this.isValidDrop = false;
-        this.dropWarningStyle = `left: ${x + 15}px; top: ${y + 15}px;`;
+        this.dropWarningStyle = { left: `${x + 15}px`, top: `${y + 15}px` };
 
         // Add invalid cursor class
         document.body.classList.add('vc-dragging-invalid');
@@ -2436,7 +2498,7 @@
       // STATUS INDICATOR
       // ============================================================================
 
-      setStatus(status) {
+      setStatus(status, changes) {
         this.statusClass = '';
 
         if (status === 'processing') {
@@ -2459,15 +2521,22 @@
             this.processingTimeout = null;
           }
 
-          this.statusText = 'Done ✓';
+          this.statusText = changes
+            ? 'Done ✓ · ' + window.VCUtils.formatChanges(changes)
+            : 'Done ✓';
           this.statusClass = 'vc-complete';
           this.showStatusIndicator = true;
           this.isProcessing = false;
 
+          // Leave the changed files on screen long enough to read
+          const delay = changes && changes.length > 0
+            ? window.VCConstants.CHANGES_RELOAD_DELAY
+            : window.VCConstants.RELOAD_DELAY;
+
           console.log('[Layrr] Task completed, reloading...');
           setTimeout(() => {
             window.location.reload();
-          }, window.VCConstants.RELOAD_DELAY);
+          }, delay);
 
         } else {
           if (this.processingTimeout) {
@@ -2480,6 +2549,228 @@
         }
       },
 
+      // ============================================================================
+      // JOB QUEUE
+      // ============================================================================
+
+      // Insert or update a job pushed by the server
+      upsertJob(job) {
+        const index = this.jobs.findIndex(j => j.id === job.id);
+        if (index >= 0) {
+          this.jobs.splice(index, 1, job);
+        } else {
+          this.jobs.push(job);
+        }
+        this.jobs = this.sortJobs(this.jobs).slice(0, window.VCConstants.MAX_JOBS_SHOWN);
+
+        // Activity only describes running jobs
+        if (job.state !== 'running' && this.jobActivity[job.id]) {
+          const { [job.id]: _, ...rest } = this.jobActivity;
+          this.jobActivity = rest;
+        }
+
+        if (job.id === this.currentJobId) {
+          this.updateJobStatus(job);
+        }
+      },
+
+      // Record what the agent is doing in a running job (pushed to every tab)
+      handleActivity(activity) {
+        this.jobActivity = { ...this.jobActivity, [activity.jobId]: activity };
+
+        if (activity.jobId === this.currentJobId) {
+          const job = this.jobs.find(j => j.id === activity.jobId);
+          if (job) this.updateJobStatus(job);
+        }
+      },
+
+      // Running first, then queued in order, then awaiting review, then most recently finished
+      sortJobs(jobs) {
+        const rank = { running: 0, queued: 1, review: 2 };
+        return [...jobs].sort((a, b) => {
+          const ra = rank[a.state] ?? 3;
+          const rb = rank[b.state] ?? 3;
+          if (ra !== rb) return ra - rb;
+          if (a.state === 'queued') return a.position - b.position;
+          return new Date(b.finishedAt || b.createdAt) - new Date(a.finishedAt || a.createdAt);
+        });
+      },
+
+      // Reflect this tab's job in the status indicator while it waits or runs
+      updateJobStatus(job) {
+        if (!this.isProcessing) return;
+
+        if (job.state === 'queued') {
+          this.statusText = `<span class="vc-spinner"></span>Queued (#${job.position})`;
+        } else if (job.state === 'running') {
+          const activity = this.jobActivity[job.id];
+          this.statusText = '<span class="vc-spinner"></span>' +
+            (activity ? window.VCUtils.escapeHTML(activity.summary) : 'Processing...');
+        }
+      },
+
+      get activeJobs() {
+        return this.jobs.filter(j => j.state === 'queued' || j.state === 'running');
+      },
+
+      get recentJobs() {
+        return this.jobs
+          .filter(j => j.state !== 'queued' && j.state !== 'running')
+          .slice(0, window.VCConstants.MAX_RECENT_JOBS);
+      },
+
+      // Finished jobs with a git checkpoint and changed files can be undone
+      canUndoJob(job) {
+        return !!job.checkpoint && (job.files || []).length > 0;
+      },
+
+      // Restore the source files changed by a job (undo) or re-apply them (redo)
+      undoJob(job) {
+        this.sendControlMessage({ type: job.undone ? 'redo-job' : 'undo-job', jobId: job.id });
+      },
+
+      // Jobs run in worktree mode wait for review before touching the project
+      acceptJob(job) {
+        this.sendControlMessage({ type: 'accept-job', jobId: job.id });
+      },
+
+      rejectJob(job) {
+        this.sendControlMessage({ type: 'reject-job', jobId: job.id });
+        if (this.jobDiff && this.jobDiff.jobId === job.id) this.jobDiff = null;
+      },
+
+      showJobDiff(job) {
+        this.sendControlMessage({ type: 'job-diff', jobId: job.id });
+      },
+
+      // Show the diff of a job awaiting review
+      handleJobDiff(data) {
+        if (data.status !== 'complete') {
+          console.error('[Layrr] ✗ Failed to load diff:', data.error);
+          return;
+        }
+
+        const job = this.jobs.find(j => j.id === data.jobId);
+        this.jobDiff = {
+          jobId: data.jobId,
+          instruction: job ? job.instruction : '',
+          lines: (data.diff || '').split('\n'),
+        };
+      },
+
+      // Show that a finished instruction waits in a worktree instead of reloading
+      showReviewReady(changes) {
+        if (this.processingTimeout) {
+          clearTimeout(this.processingTimeout);
+          this.processingTimeout = null;
+        }
+
+        this.statusText = 'Ready for review · ' + window.VCUtils.formatChanges(changes);
+        this.statusClass = 'vc-complete';
+        this.showStatusIndicator = true;
+        this.isProcessing = false;
+        this.currentMessageId = null;
+        this.showJobsPanel = true;
+
+        setTimeout(() => {
+          if (!this.isProcessing) this.showStatusIndicator = false;
+        }, window.VCConstants.CHANGES_RELOAD_DELAY);
+      },
+
+      // Show the result of an accept/reject request
+      handleReviewResult(data) {
+        const action = data.type === 'accept-job' ? 'Accept' : 'Reject';
+
+        if (data.status === 'complete') {
+          console.log(`[Layrr] 🔍 ${action} complete:`, data.job.files);
+          this.upsertJob(data.job);
+          if (this.jobDiff && this.jobDiff.jobId === data.jobId) this.jobDiff = null;
+          this.statusText = action === 'Accept'
+            ? `Accepted ✓ · ${window.VCUtils.formatChanges(data.job.changes)}`
+            : 'Rejected · worktree discarded';
+          this.statusClass = action === 'Accept' ? 'vc-complete' : '';
+        } else {
+          console.error(`[Layrr] ✗ ${action} failed:`, data.error);
+          this.statusText = `${action} failed: ${window.VCUtils.escapeHTML(data.error)}`;
+          this.statusClass = '';
+        }
+
+        this.showStatusIndicator = true;
+        setTimeout(() => {
+          if (!this.isProcessing) this.showStatusIndicator = false;
+        }, window.VCConstants.CANCELLED_DISMISS_DELAY);
+      },
+
+      // Show the result of an undo/redo request
+      handleUndoResult(data) {
+        const action = data.type === 'undo-job' ? 'Undo' : 'Redo';
+
+        if (data.status === 'complete') {
+          console.log(`[Layrr] ↶ ${action} complete:`, data.job.files);
+          this.upsertJob(data.job);
+          this.statusText = `${action} ✓ · ${window.VCUtils.formatChanges(data.job.changes)}`;
+          this.statusClass = 'vc-complete';
+        } else {
+          console.error(`[Layrr] ✗ ${action} failed:`, data.error);
+          this.statusText = `${action} failed: ${window.VCUtils.escapeHTML(data.error)}`;
+          this.statusClass = '';
+        }
+
+        this.showStatusIndicator = true;
+        setTimeout(() => {
+          if (!this.isProcessing) this.showStatusIndicator = false;
+        }, window.VCConstants.CANCELLED_DISMISS_DELAY);
+      },
+
+      moveJob(job, delta) {
+        this.sendControlMessage({ type: 'move-job', jobId: job.id, position: job.position + delta });
+      },
+
+      cancelJob(job) {
+        this.sendControlMessage({ type: 'cancel', jobId: job.id });
+      },
+
+      sendControlMessage(message) {
+        if (this.messageWs && this.messageWs.readyState === WebSocket.OPEN) {
+          this.messageWs.send(JSON.stringify(message));
+        } else {
+          console.error('[Layrr] ✗ WebSocket not connected');
+        }
+      },
+
+      // Ask the server to stop the running Claude Code instruction
+      cancelProcessing() {
+        if (this.messageWs && this.messageWs.readyState === WebSocket.OPEN) {
+          this.messageWs.send(JSON.stringify({ type: 'cancel' }));
+          this.statusText = '<span class="vc-spinner"></span>Cancelling...';
+          console.log('[Layrr] ⏹ Cancel requested');
+        } else {
+          console.error('[Layrr] ✗ WebSocket not connected');
+        }
+      },
+
+      // Show the cancelled state, listing files Claude edited before it was stopped
+      showCancelled(files) {
+        if (this.processingTimeout) {
+          clearTimeout(this.processingTimeout);
+          this.processingTimeout = null;
+        }
+
+        const edited = files || [];
+        this.statusText = edited.length > 0
+          ? `Cancelled · ${edited.length} file${edited.length !== 1 ? 's' : ''} edited: ` +
+            edited.map(f => window.VCUtils.escapeHTML(f)).join(', ')
+          : 'Cancelled · no files edited';
+        this.statusClass = '';
+        this.showStatusIndicator = true;
+        this.isProcessing = false;
+        this.currentMessageId = null;
+
+        setTimeout(() => {
+          if (!this.isProcessing) this.showStatusIndicator = false;
+        }, window.VCConstants.CANCELLED_DISMISS_DELAY);
+      },
+
       // ============================================================================
       // WEBSOCKET CONNECTIONS
       // ============================================================================
@@ -2510,6 +2801,8 @@
 
         this.messageWs.onopen = () => {
           console.log('[Layrr] Connected to Claude Code');
+          // Say which protocol version we speak; the server answers with the job queue
+          this.messageWs.send(JSON.stringify({ type: 'hello', version: window.VCConstants.PROTOCOL_VERSION }));
         };
 
         this.messageWs.onmessage = (event) => {
@@ -2517,10 +2810,72 @@
             const data = JSON.parse(event.data);
             console.log('[Layrr] Message from server:', data);
 
+            // Protocol handshake
+            if (data.type === 'hello') {
+              if (data.status === 'error') {
+                console.error('[Layrr] ✗ Protocol mismatch:', data.error);
+                this.statusText = 'Layrr was updated · reload the page';
+                this.statusClass = '';
+                this.showStatusIndicator = true;
+              }
+              return;
+            }
+            if (data.type === 'error') {
+              console.error(`[Layrr] ✗ Server rejected message (${data.code}):`, data.error);
+              return;
+            }
+
+            // Session reset acknowledgement
+            if (data.type === 'new-session') {
+              console.log('[Layrr] ↺ New Claude Code session started');
+              this.statusText = 'New session started';
+              this.statusClass = '';
+              this.showStatusIndicator = true;
+              setTimeout(() => {
+                if (!this.isProcessing) this.showStatusIndicator = false;
+              }, window.VCConstants.RELOAD_DELAY);
+              return;
+            }
+
+            // Job queue updates (broadcast to every tab)
+            if (data.type === 'jobs') {
+              this.jobs = this.sortJobs(data.jobs || []).slice(0, window.VCConstants.MAX_JOBS_SHOWN);
+              return;
+            }
+            if (data.type === 'job') {
+              this.upsertJob(data.job);
+              return;
+            }
+            if (data.type === 'activity') {
+              this.handleActivity(data);
+              return;
+            }
+            if (data.type === 'undo-job' || data.type === 'redo-job') {
+              this.handleUndoResult(data);
+              return;
+            }
+            if (data.type === 'accept-job' || data.type === 'reject-job') {
+              this.handleReviewResult(data);
+              return;
+            }
+            if (data.type === 'job-diff') {
+              this.handleJobDiff(data);
+              return;
+            }
+            if (data.type === 'move-job' || data.type === 'cancel') {
+              if (data.status === 'error') {
+                console.warn('[Layrr] ⚠️  Job update rejected:', data.error);
+              } else if (data.status === 'idle') {
+                // Nothing was running when cancel was requested
+                this.setStatus('idle');
+              }
+              return;
+            }
+
             // Handle design analysis progress
-            if (this.currentDesignMessageId && data.id === this.currentDesignMessageId) {
+            if (data.type === 'analyze-design') {
               this.handleDesignProgress(data);
-              if (data.status === 'complete' || data.status === 'error') {
+              if (data.status === 'complete' || data.status === 'error' || data.status === 'cancelled') {
                 this.currentDesignMessageId = null;
               }
               return;
@@ -2543,16 +2898,19 @@
                 return;
               }
 
-              if (!this.currentMessageId && (data.status === 'complete' || data.status === 'error')) {
+              if (!this.currentMessageId && (data.status === 'complete' || data.status === 'error' || data.status === 'cancelled')) {
                 console.warn('[Layrr] ⚠️  Ignoring completion with no active request');
                 return;
               }
             }
 
             if (data.status === 'received') {
-              console.log('[Layrr] ✅ Server acknowledged');
+              console.log('[Layrr] ✅ Server acknowledged (job ' + data.jobId + ')');
+              this.currentJobId = data.jobId;
+              const job = this.jobs.find(j => j.id === data.jobId);
+              if (job) this.updateJobStatus(job);
             } else if (data.status === 'complete') {
-              console.log('[Layrr] 🎉 Task completed');
+              console.log('[Layrr] 🎉 Task completed, files changed:', data.changes);
 
               // Check if this is a batch completion that needs to resolve a promise
               let isBatchOperation = false;
@@ -2563,7 +2921,11 @@
                 if (batchNumber !== undefined && this.pendingBatchResolvers[batchNumber]) {
                   console.log(`[Layrr] ✓ Resolving batch ${batchNumber}`);
                   // Call the resolver - it will clean up both maps
-                  this.pendingBatchResolvers[batchNumber].resolve({ status: 'complete' });
+                  this.pendingBatchResolvers[batchNumber].resolve({
+                    status: 'complete',
+                    changes: data.changes || [],
+                    review: !!data.review,
+                  });
                   delete this.pendingBatchResolvers[batchNumber];
                   // Note: batchIdMapping is already cleaned up by the resolver callback
                   isBatchOperation = true;
@@ -2573,7 +2935,11 @@
               // Only set status to 'complete' if this is NOT a batch operation
               // Batch operations handle their own status updates in commitChanges()
               if (!isBatchOperation) {
-                this.setStatus('complete');
+                if (data.review) {
+                  this.showReviewReady(data.changes || []);
+                } else {
+                  this.setStatus('complete', data.changes || []);
+                }
                 this.currentMessageId = null;
               }
             } else if (data.status === 'error') {
@@ -2606,6 +2972,27 @@
                   window.location.reload();
                 }, window.VCConstants.ERROR_RELOAD_DELAY);
               }
+            } else if (data.status === 'cancelled') {
+              console.warn('[Layrr] ⏹ Cancelled, files edited:', data.files);
+
+              // Reject pending batches so commitChanges() stops sending the rest
+              let isBatchOperation = false;
+              if (this.pendingBatchResolvers && this.batchIdMapping && data.id) {
+                const batchNumber = this.batchIdMapping[data.id];
+
+                if (batchNumber !== undefined && this.pendingBatchResolvers[batchNumber]) {
+                  const error = new Error('Cancelled');
+                  error.cancelled = true;
+                  error.files = data.files || [];
+                  this.pendingBatchResolvers[batchNumber].reject(error);
+                  delete this.pendingBatchResolvers[batchNumber];
+                  isBatchOperation = true;
+                }
+              }
+
+              if (!isBatchOperation) {
+                this.showCancelled(data.files);
+              }
             }
           } catch (err) {
             console.error('[Layrr] Failed to parse message:', err);
@@ -2763,14 +3150,137 @@
          x-transition
          class="vc-status-indicator fixed bottom-6 left-6 px-5 py-3 rounded-lg bg-white text-gray-700 border border-gray-300 text-sm font-medium font-sans z-[1000000] flex items-center gap-2 shadow-lg transition-all duration-200 ease">
     </div>
+    <button x-show="isProcessing"
+            @click="cancelProcessing()"
+            title="Stop Claude Code"
+            class="vc-cancel-button fixed bottom-20 left-6 px-3 py-1.5 rounded-md bg-white text-red-600 border border-gray-300 text-xs font-medium font-sans z-[1000000] flex items-center gap-1 shadow-lg cursor-pointer hover:bg-red-50 active:scale-95">
+      <i class="ph ph-stop-circle text-sm"></i>
+      Cancel
+    </button>
+  `;
+
+  // Job Queue Panel (jobs from every connected tab)
+  app.innerHTML += `
+    <div x-show="activeJobs.length > 0 || showJobsPanel"
+         x-transition
+         class="vc-jobs-panel fixed bottom-24 right-6 w-80 max-h-72 overflow-y-auto bg-white border border-gray-300 rounded-lg shadow-lg z-[1000003] font-sans">
+      <div class="flex items-center justify-between px-3 py-2 border-b border-gray-200 text-xs font-semibold text-gray-700 uppercase tracking-wide">
+        <span>Claude Code jobs</span>
+        <button x-show="showJobsPanel" @click="showJobsPanel = false" title="Close"
+                class="w-5 h-5 flex items-center justify-center rounded text-gray-400 hover:bg-gray-100 cursor-pointer">
+          <i class="ph ph-x text-xs"></i>
+        </button>
+      </div>
+      <div x-show="activeJobs.length === 0 && recentJobs.length === 0"
+           class="px-3 py-3 text-xs text-gray-400">
+        No jobs yet
+      </div>
+      <template x-for="job in activeJobs" :key="job.id">
+        <div class="flex items-center gap-2 px-3 py-2 border-b border-gray-100 last:border-b-0">
+          <span class="text-[10px] font-semibold px-1.5 py-0.5 rounded uppercase"
+                x-bind:class="job.state === 'running' ? 'bg-blue-600 text-white' : 'bg-gray-100 text-gray-600'"
+                x-text="job.state === 'queued' ? '#' + job.position : 'running'"></span>
+          <div class="flex-1 min-w-0">
+            <div class="truncate text-xs text-gray-700" x-text="job.instruction" x-bind:title="job.instruction"></div>
+            <div x-show="job.state === 'running' && jobActivity[job.id]"
+                 class="truncate text-[10px]"
+                 x-bind:class="(jobActivity[job.id] || {}).kind === 'error' ? 'text-red-500' : 'text-gray-400'"
+                 x-text="(jobActivity[job.id] || {}).summary"
+                 x-bind:title="(jobActivity[job.id] || {}).file || (jobActivity[job.id] || {}).summary"></div>
+          </div>
+          <template x-if="job.state === 'queued'">
+            <div class="flex items-center">
+              <button @click="moveJob(job, -1)" x-bind:disabled="job.position <= 1" title="Move up"
+                      class="w-6 h-6 flex items-center justify-center rounded text-gray-500 hover:bg-gray-100 disabled:opacity-30 cursor-pointer">
+                <i class="ph ph-caret-up text-sm"></i>
+              </button>
+              <button @click="moveJob(job, 1)" title="Move down"
+                      class="w-6 h-6 flex items-center justify-center rounded text-gray-500 hover:bg-gray-100 cursor-pointer">
+                <i class="ph ph-caret-down text-sm"></i>
+              </button>
+            </div>
+          </template>
+          <button @click="cancelJob(job)" x-bind:title="job.state === 'queued' ? 'Remove from queue' : 'Stop'"
+                  class="w-6 h-6 flex items-center justify-center rounded text-gray-400 hover:text-red-600 hover:bg-red-50 cursor-pointer">
+            <i class="ph text-sm" x-bind:class="job.state === 'queued' ? 'ph-x' : 'ph-stop-circle'"></i>
+          </button>
+        </div>
+      </template>
+      <template x-for="job in recentJobs" :key="job.id">
+        <div class="flex items-center gap-2 px-3 py-2 border-b border-gray-100 last:border-b-0"
+             x-bind:class="job.undone ? 'opacity-60' : ''">
+          <i class="ph text-sm"
+             x-bind:class="{
+               'ph-check-circle text-green-600': job.state === 'done',
+               'ph-x-circle text-red-500': job.state === 'failed',
+               'ph-stop-circle text-gray-400': job.state === 'cancelled' || job.state === 'rejected',
+               'ph-git-branch text-orange-500': job.state === 'review'
+             }"></i>
+          <span class="flex-1 min-w-0 truncate text-xs text-gray-700"
+                x-bind:class="job.undone ? 'line-through' : ''"
+                x-text="job.instruction"
+                x-bind:title="(job.files || []).join('\\n') || job.instruction"></span>
+          <span class="text-[10px] text-gray-400" x-text="(job.files || []).length + ' files'"></span>
+          <template x-if="job.state === 'review'">
+            <div class="flex items-center">
+              <button @click="showJobDiff(job)" title="Show diff"
+                      class="w-6 h-6 flex items-center justify-center rounded text-gray-500 hover:bg-gray-100 cursor-pointer">
+                <i class="ph ph-git-diff text-sm"></i>
+              </button>
+              <button @click="acceptJob(job)" title="Accept: apply these changes to the project"
+                      x-bind:disabled="activeJobs.some(j => j.state === 'running')"
+                      class="w-6 h-6 flex items-center justify-center rounded text-green-600 hover:bg-green-50 disabled:opacity-30 cursor-pointer">
+                <i class="ph ph-check text-sm"></i>
+              </button>
+              <button @click="rejectJob(job)" title="Reject: discard the worktree"
+                      class="w-6 h-6 flex items-center justify-center rounded text-gray-400 hover:text-red-600 hover:bg-red-50 cursor-pointer">
+                <i class="ph ph-x text-sm"></i>
+              </button>
+            </div>
+          </template>
+          <button x-show="canUndoJob(job)" @click="undoJob(job)"
+                  x-bind:disabled="activeJobs.some(j => j.state === 'running')"
+                  x-bind:title="job.undone ? 'Redo: re-apply these file changes' : 'Undo: restore files to before this job'"
+                  class="w-6 h-6 flex items-center justify-center rounded text-gray-500 hover:bg-gray-100 disabled:opacity-30 cursor-pointer">
+            <i class="ph text-sm" x-bind:class="job.undone ? 'ph-arrow-clockwise' : 'ph-arrow-counter-clockwise'"></i>
+          </button>
+        </div>
+      </template>
+    </div>
+  `;
+
+  // Worktree Diff Panel (changes of a job awaiting review)
+  app.innerHTML += `
+    <div x-show="jobDiff"
+         x-transition
+         class="vc-diff-panel fixed top-6 right-6 bottom-24 w-[560px] max-w-[90vw] flex flex-col bg-white border border-gray-300 rounded-lg shadow-lg z-[1000004] font-sans">
+      <div class="flex items-center gap-2 px-3 py-2 border-b border-gray-200">
+        <i class="ph ph-git-diff text-gray-600"></i>
+        <span class="flex-1 min-w-0 truncate text-xs font-semibold text-gray-700" x-text="jobDiff && jobDiff.instruction"></span>
+        <button @click="acceptJob({ id: jobDiff.jobId })" title="Accept"
+                class="px-2 py-1 text-xs font-semibold rounded bg-green-600 text-white hover:bg-green-700 cursor-pointer">Accept</button>
+        <button @click="rejectJob({ id: jobDiff.jobId })" title="Reject"
+                class="px-2 py-1 text-xs font-semibold rounded text-red-600 hover:bg-red-50 cursor-pointer">Reject</button>
+        <button @click="jobDiff = null" title="Close"
+                class="w-6 h-6 flex items-center justify-center rounded text-gray-400 hover:bg-gray-100 cursor-pointer">
+          <i class="ph ph-x text-sm"></i>
+        </button>
+      </div>
+      <pre class="flex-1 overflow-auto m-0 p-3 text-[11px] leading-4 font-mono bg-gray-50"><template x-for="(line, i) in (jobDiff ? jobDiff.lines : [])" :key="i"><div x-text="line || ' '"
+             x-bind:class="{
+               'text-green-700 bg-green-50': line.startsWith('+') && !line.startsWith('+++'),
+               'text-red-700 bg-red-50': line.startsWith('-') && !line.startsWith('---'),
+               'text-blue-600': line.startsWith('@@'),
+               'text-gray-500 font-semibold': line.startsWith('diff ')
+             }"></div></template></pre>
+    </div>
   `;
 
   // Design-to-Code Modal
   app.innerHTML += `
     <div x-show="showDesignModal"
          x-transition
-         class="vc-design-modal fixed inset-0 z-[1000004] flex items-center justify-center p-4"
-         style="background: rgba(0, 0, 0, 0.5);">
+         class="vc-design-modal fixed inset-0 z-[1000004] flex items-center justify-center p-4 bg-black/50">
 
       <div @click.away="closeDesignModal()"
            class="bg-white border border-gray-300 rounded-lg w-full max-w-4xl max-h-[90vh] overflow-y-auto shadow-xl">
@@ -2895,10 +3405,17 @@
               <!-- Progress Bar -->
               <div class="w-full bg-blue-100 rounded-full h-1.5 overflow-hidden">
                 <div class="bg-blue-600 h-full rounded-full transition-all duration-500 ease-out"
-                     x-bind:style="'width: ' + (analysisStep === 'analyzing' ? '50' : analysisStep === 'complete' ? '100' : '75') + '%'">
+                     x-bind:style="{ width: (analysisStep === 'analyzing' ? '50' : analysisStep === 'complete' ? '100' : '75') + '%' }">
                 </div>
               </div>
 
+              <!-- Cancel -->
+              <button x-show="analysisStep !== 'complete'"
+                      @click="cancelProcessing()"
+                      class="text-xs text-red-600 hover:text-red-700 font-medium cursor-pointer">
+                Cancel
+              </button>
+
               <!-- Success Message -->
               <div x-show="analysisStep === 'complete'"
                    x-transition
@@ -2985,7 +3502,7 @@
 
   // Bottom Control Bar (Pill Design) - Simplified unified mode
   app.innerHTML += `
-    <div class="vc-control-bar fixed bottom-6 right-6 z-[1000003] flex items-center border border-gray-300 rounded-full shadow-lg" style="background-color: #fffefc;">
+    <div class="vc-control-bar fixed bottom-6 right-6 z-[1000003] flex items-center border border-gray-300 rounded-full shadow-lg bg-[#fffefc]">
       <!-- Design Upload Button -->
       <button @click="openDesignModal()"
               title="Create from Design"
@@ -2996,6 +3513,32 @@
       <!-- Divider -->
       <div class="w-px h-8 bg-gray-300"></div>
 
+      <!-- New Session Button -->
+      <button @click="startNewSession()"
+              x-bind:disabled="isProcessing"
+              title="New Claude Code session"
+              class="flex items-center justify-center w-12 h-12 text-gray-700 outline-none transition-all duration-200 ease cursor-pointer hover:bg-gray-100 active:scale-95 disabled:opacity-50 disabled:cursor-not-allowed">
+        <i class="ph ph-chat-circle-dots text-xl"></i>
+      </button>
+
+      <!-- Divider -->
+      <div class="w-px h-8 bg-gray-300"></div>
+
+      <!-- Jobs Panel Button -->
+      <button @click="showJobsPanel = !showJobsPanel"
+              x-bind:class="{'bg-blue-600 text-white': showJobsPanel, 'bg-transparent text-gray-700': !showJobsPanel}"
+              title="Claude Code jobs (undo / redo)"
+              class="flex items-center justify-center w-12 h-12 outline-none transition-all duration-200 ease cursor-pointer hover:bg-gray-100 active:scale-95 relative">
+        <i class="ph ph-list-checks text-xl"></i>
+        <span x-show="activeJobs.length > 0"
+              x-text="activeJobs.length"
+              class="absolute -top-1 -right-1 bg-blue-600 text-white text-[10px] font-bold rounded-full w-5 h-5 flex items-center justify-center border-2 border-white">
+        </span>
+      </button>
+
+      <!-- Divider -->
+      <div class="w-px h-8 bg-gray-300"></div>
+
       <!-- History Panel Button -->
       <button @click="toggleHistoryPanel()"
               x-bind:class="{'bg-blue-600 text-white': showHistoryPanel, 'bg-transparent text-gray-700': !showHistoryPanel}"
@@ -3018,7 +3561,7 @@
               x-bind:title="modeTitle"
               class="vc-mode-toggle flex items-center justify-center w-12 h-12 outline-none transition-all duration-200 ease cursor-pointer rounded-r-full active:scale-95">
         <template x-if="isEditMode">
-          <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 32 32" style="display: block;">
+          <svg xmlns="http://www.w3.org/2000/svg" width="20" height="20" viewBox="0 0 32 32" class="block">
             <g transform="rotate(-35 16 16)">
               <path d="M 16 2 L 28 22 L 20 18 L 16 28 L 12 18 L 4 22 Z"
                     fill="currentColor"
@@ -3042,11 +3585,10 @@
          x-transition:leave="transition ease-in duration-150"
          x-transition:leave-start="translate-x-0"
          x-transition:leave-end="-translate-x-full"
-         class="vc-history-panel fixed left-0 top-0 bottom-0 w-96 border-r border-gray-200 shadow-xl z-[1000004] overflow-hidden flex flex-col"
-         style="background-color: #fffefc;">
+         class="vc-history-panel fixed left-0 top-0 bottom-0 w-96 border-r border-gray-200 shadow-xl z-[1000004] overflow-hidden flex flex-col bg-[#fffefc]">
 
       <!-- Header -->
-      <div class="flex items-center justify-between px-6 py-4 border-b border-gray-200" style="background-color: #fffefc;">
+      <div class="flex items-center justify-between px-6 py-4 border-b border-gray-200 bg-[#fffefc]">
         <div class="flex items-center gap-3">
           <i class="ph ph-clock-counter-clockwise text-xl text-gray-700"></i>
           <h2 class="text-base font-semibold text-gray-900 tracking-tight">Change History</h2>
@@ -3062,7 +3604,7 @@
       </div>
 
       <!-- Actions Bar -->
-      <div class="flex items-center gap-2 px-4 py-3 border-b border-gray-100" style="background-color: #fffefc;">
+      <div class="flex items-center gap-2 px-4 py-3 border-b border-gray-100 bg-[#fffefc]">
         <button @click="selectAllChanges()"
                 class="text-xs font-medium px-3 py-1.5 text-gray-700 hover:bg-gray-100 rounded-md cursor-pointer transition-all">
           Select All
@@ -3090,7 +3632,7 @@
 
         <!-- Change Items -->
         <template x-for="change in changeHistory" :key="change.id">
-          <div class="vc-change-item border border-gray-200 rounded-lg p-3.5 hover:border-gray-300 hover:shadow-sm transition-all cursor-pointer" style="background-color: #fffefc;">
+          <div class="vc-change-item border border-gray-200 rounded-lg p-3.5 hover:border-gray-300 hover:shadow-sm transition-all cursor-pointer bg-[#fffefc]">
             <div class="flex items-start gap-3">
               <!-- Checkbox -->
               <input type="checkbox"
@@ -3102,7 +3644,7 @@
                 <!-- Type Badge and Timestamp -->
                 <div class="flex items-center gap-2 mb-2">
                   <span class="text-[10px] font-semibold px-2 py-0.5 rounded uppercase tracking-wide"
-                        x-bind:style="'background-color: ' + getChangeTypeBadge(change.type).color + '; color: white;'"
+                        x-bind:style="{ backgroundColor: getChangeTypeBadge(change.type).color, color: 'white' }"
                         x-text="getChangeTypeBadge(change.type).text">
                   </span>
                   <span class="text-[11px] text-gray-500 font-medium" x-text="formatTimestamp(change.timestamp)"></span>
@@ -3126,7 +3668,7 @@
       </div>
 
       <!-- Footer Actions -->
-      <div class="border-t border-gray-200 px-4 py-4" style="background-color: #fffefc;">
+      <div class="border-t border-gray-200 px-4 py-4 bg-[#fffefc]">
         <div class="text-xs text-gray-500 font-medium mb-3">
           <span x-text="getSelectedChanges().length"></span> of <span x-text="changeHistory.length"></span> selected
         </div>
@@ -3158,6 +3700,12 @@
     .vc-text-editor *,
     .vc-status-indicator,
     .vc-status-indicator *,
+    .vc-cancel-button,
+    .vc-cancel-button *,
+    .vc-jobs-panel,
+    .vc-jobs-panel *,
+    .vc-diff-panel,
+    .vc-diff-panel *,
     .vc-design-modal,
     .vc-design-modal *,
     .vc-control-bar,
@@ -3212,18 +3760,6 @@
   `;
   document.head.appendChild(style);
 
-  // Load Phosphor Icons (Notion-style iconography)
-  const phosphorLink = document.createElement('link');
-  phosphorLink.rel = 'stylesheet';
-  phosphorLink.href = 'https://unpkg.com/@phosphor-icons/web@2.1.1/src/regular/style.css';
-  document.head.appendChild(phosphorLink);
-
-  // Load Inter Font (Notion-style typography)
-  const interLink = document.createElement('link');
-  interLink.rel = 'stylesheet';
-  interLink.href = 'https://fonts.googleapis.com/css2?family=Inter:wght@400;500;600;700&display=swap';
-  document.head.appendChild(interLink);
-
   // Append to body
   document.body.appendChild(app);
 
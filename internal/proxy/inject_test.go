@@ -0,0 +1,302 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/andybalholm/brotli"
+)
+
+// chunkReader returns one chunk per Read, like a server streaming its response
+type chunkReader struct {
+	chunks []string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	if r.chunks[0] = r.chunks[0][n:]; r.chunks[0] == "" {
+		r.chunks = r.chunks[1:]
+	}
+	return n, nil
+}
+
+// htmlResponse is an HTML response from the dev server with body as its content
+func htmlResponse(body io.Reader, encoding string) *http.Response {
+	header := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+	header.Set("Content-Length", "123")
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost:3000/", nil)
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          io.NopCloser(body),
+		ContentLength: 123,
+		Request:       req,
+	}
+}
+
+// inject runs a response through InjectScript and returns its decoded body
+func inject(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	if err := InjectScript(resp, "/__layrr", "tok"); err != nil {
+		t.Fatal(err)
+	}
+	body, err := decode(resp.Body, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		t.Fatalf("failed to decode the injected body: %v", err)
+	}
+	return body
+}
+
+// decode reads a body in the given content coding
+func decode(r io.Reader, encoding string) (string, error) {
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		r, err = gzip.NewReader(r)
+	case "deflate":
+		r, err = zlib.NewReader(r)
+	case "br":
+		r = brotli.NewReader(r)
+	}
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(r)
+	return string(data), err
+}
+
+// encode compresses a body with the given content coding
+func encode(t *testing.T, body, encoding string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		return []byte(body)
+	}
+	io.WriteString(w, body)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// checkInjected checks that the tags were injected once, right before marker
+func checkInjected(t *testing.T, body, marker string) {
+	t.Helper()
+
+	if n := strings.Count(body, `src="/__layrr/inject.js"`); n != 1 {
+		t.Fatalf("tags injected %d times:\n%s", n, body)
+	}
+	if !strings.Contains(body, `data-layrr-token="tok"`) {
+		t.Errorf("token missing:\n%s", body)
+	}
+	tags := strings.Index(body, "<!-- Layrr")
+	end := strings.Index(body, `alpine.min.js"></script>`)
+	at := strings.Index(strings.ToLower(body), marker)
+	if tags < 0 || at < 0 || strings.TrimSpace(body[end+len(`alpine.min.js"></script>`):at]) != "" {
+		t.Errorf("tags aren't right before %s:\n%s", marker, body)
+	}
+}
+
+const page = `<!doctype html><html><head><title>App</title></head><body><div id="root">Hello</div></body></html>`
+
+func TestInjectAcrossChunks(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		marker string
+	}{
+		{"one chunk", []string{page}, "</head>"},
+		{"marker split", []string{`<html><head><title>App</title></he`, `ad><body>Hello</body></html>`}, "</head>"},
+		{"marker split after <", []string{`<html><head><title>App</title><`, `/head><body></body></html>`}, "</head>"},
+		{"one byte at a time", strings.Split(page, ""), "</head>"},
+		{"uppercase marker", []string{`<HTML><HEAD><TITLE>App</TITLE></HEAD><BODY></BODY></HTML>`}, "</head>"},
+		{"body only", []string{`<html><body>Hello`, `</body></html>`}, "</body>"},
+		{"html only", []string{`<html>Hello world`, `</html>`}, "</html>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := strings.Join(tt.chunks, "")
+			resp := htmlResponse(&chunkReader{chunks: slices.Clone(tt.chunks)}, "")
+			body := inject(t, resp)
+
+			checkInjected(t, body, tt.marker)
+			if strings.Replace(body, string(resp.Body.(*injector).tags()), "", 1) != original {
+				t.Errorf("page changed beyond the tags:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestInjectWithoutMarker(t *testing.T) {
+	body := inject(t, htmlResponse(strings.NewReader(`<div>A fragment without any end tags</div>`), ""))
+	if !strings.HasPrefix(body, `<div>A fragment without any end tags</div>`) || !strings.Contains(body, `src="/__layrr/inject.js"`) {
+		t.Errorf("tags weren't appended:\n%s", body)
+	}
+
+	// Too small to be a page
+	if body := inject(t, htmlResponse(strings.NewReader(`ok`), "")); body != "ok" {
+		t.Errorf("tiny body = %q", body)
+	}
+}
+
+func TestInjectEncodings(t *testing.T) {
+	for _, encoding := range []string{"", "identity", "gzip", "x-gzip", "deflate", "raw-deflate", "br"} {
+		t.Run(encoding, func(t *testing.T) {
+			header := encoding
+			switch encoding {
+			case "raw-deflate":
+				header = "deflate" // Some servers send raw deflate as "deflate"
+			case "x-gzip":
+				encoding = "gzip"
+			}
+
+			data := encode(t, page, encoding)
+			resp := htmlResponse(iotest.OneByteReader(bytes.NewReader(data)), header)
+			body := inject(t, resp)
+
+			checkInjected(t, body, "</head>")
+			if resp.ContentLength != -1 || resp.Header.Get("Content-Length") != "" {
+				t.Errorf("content length = %d, %q", resp.ContentLength, resp.Header.Get("Content-Length"))
+			}
+			if got := resp.Header.Get("Content-Encoding"); got != header {
+				t.Errorf("content encoding = %q, want %q", got, header)
+			}
+		})
+	}
+}
+
+func TestInjectCSPMetaAcrossChunks(t *testing.T) {
+	chunks := []string{
+		`<html><head><meta http-equiv="Content-Security-Policy" con`,
+		`tent="script-src 'self'"><title>App</title></head><body></body></html>`,
+	}
+	resp := htmlResponse(&chunkReader{chunks: chunks}, "")
+	body := inject(t, resp)
+
+	nonce := resp.Body.(*injector).csp.nonce
+	if !strings.Contains(body, `content="script-src &#39;self&#39; &#39;nonce-`+nonce+`&#39; &#39;unsafe-eval&#39;"`) {
+		t.Errorf("meta policy wasn't rewritten:\n%s", body)
+	}
+	if !strings.Contains(body, `<script nonce="`+nonce+`" defer src="/__layrr/inject.js">`) {
+		t.Errorf("tags don't carry the nonce:\n%s", body)
+	}
+}
+
+func TestInjectStreams(t *testing.T) {
+	for _, encoding := range []string{"", "gzip"} {
+		t.Run(encoding, func(t *testing.T) {
+			r, w := io.Pipe()
+			defer w.Close()
+
+			resp := htmlResponse(r, encoding)
+			if err := InjectScript(resp, "/__layrr", "tok"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Send the head, keep the body back
+			go func() {
+				var out io.Writer = w
+				if encoding == "gzip" {
+					gz := gzip.NewWriter(w)
+					defer gz.Flush()
+					out = gz
+				}
+				io.WriteString(out, `<html><head><title>App</title></head><body>`)
+			}()
+
+			var body io.Reader = resp.Body
+			if encoding == "gzip" {
+				gz, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			}
+			var got []byte
+			buf := make([]byte, 4096)
+			for !bytes.Contains(got, []byte("</head>")) {
+				n, err := body.Read(buf)
+				if err != nil {
+					t.Fatalf("read %q, then: %v", got, err)
+				}
+				got = append(got, buf[:n]...)
+			}
+			if !bytes.Contains(got, []byte(`src="/__layrr/inject.js"`)) {
+				t.Errorf("head arrived without the tags: %s", got)
+			}
+		})
+	}
+}
+
+func TestInjectSkips(t *testing.T) {
+	// Not HTML
+	resp := htmlResponse(strings.NewReader(page), "")
+	resp.Header.Set("Content-Type", "application/json")
+	if body := inject(t, resp); body != page {
+		t.Errorf("JSON body changed: %s", body)
+	}
+
+	// A coding that can't be re-encoded
+	resp = htmlResponse(strings.NewReader(page), "zstd")
+	if err := InjectScript(resp, "/__layrr", "tok"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resp.Body.(*injector); ok || resp.ContentLength != 123 {
+		t.Error("zstd body was touched")
+	}
+
+	// A revalidated page keeps its cached body and policy
+	resp = htmlResponse(http.NoBody, "")
+	resp.StatusCode = http.StatusNotModified
+	resp.Header.Set("Content-Security-Policy", "script-src 'self'")
+	if err := InjectScript(resp, "/__layrr", "tok"); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("Content-Security-Policy") != "" {
+		t.Error("policy kept on 304")
+	}
+}
+
+func TestAcceptedEncodings(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"gzip, deflate, br, zstd", "gzip, deflate, br"},
+		{"zstd", ""},
+		{"GZIP;q=0.5, identity", "GZIP;q=0.5, identity"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := AcceptedEncodings(tt.header); got != tt.want {
+			t.Errorf("AcceptedEncodings(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,501 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/thetronjohnson/layrr/internal/ai"
+	"github.com/thetronjohnson/layrr/internal/bridge"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+	"github.com/thetronjohnson/layrr/internal/sourcemap"
+)
+
+// The message WebSocket protocol (/__layrr/ws/message).
+//
+// Every message is a JSON object with a "type". A client starts with a hello carrying the
+// protocol version it speaks; the server answers with its own version and the job queue,
+// or with an "unsupported-version" error and closes the socket. Requests may carry an
+// integer "id" that the server echoes in its replies. Every request gets one reply with the
+// request's type and a status; job submissions get a "received" reply when queued and a
+// final one when the job ends. Job updates and the agent's activity are pushed to every client.
+
+const (
+	// protocolVersion is the protocol the server speaks. It goes up when a message or field
+	// is removed or changes meaning; new messages and optional fields keep it.
+	protocolVersion = 1
+	// minProtocolVersion is the oldest version a client may still speak
+	minProtocolVersion = 1
+)
+
+// Message types
+const (
+	msgHello            = "hello"
+	msgInstruction      = "instruction"
+	msgAnalyzeDesign    = "analyze-design"
+	msgApplyVisualEdits = "apply-visual-edits"
+	msgAIPreview        = "ai-preview"
+	msgCancel           = "cancel"
+	msgMoveJob          = "move-job"
+	msgUndoJob          = "undo-job"
+	msgRedoJob          = "redo-job"
+	msgAcceptJob        = "accept-job"
+	msgRejectJob        = "reject-job"
+	msgJobDiff          = "job-diff"
+	msgNewSession       = "new-session"
+
+	// Sent by the server only
+	msgJobs     = "jobs"     // The whole queue, after the hello
+	msgJob      = "job"      // A job changed state
+	msgActivity = "activity" // What the agent is doing in the running job
+	msgError    = "error"    // A message the server couldn't attribute to a request type
+)
+
+// Reply statuses
+const (
+	statusReceived  = "received" // The job was queued
+	statusComplete  = "complete"
+	statusCancelled = "cancelled"
+	statusError     = "error"
+	statusIdle      = "idle" // Cancel without a job ID while nothing was running
+)
+
+// Error codes, so clients can tell protocol mistakes from failed requests
+const (
+	codeBadMessage         = "bad-message"         // Not a JSON object with a type
+	codeUnknownType        = "unknown-type"        // No such request type
+	codeHandshakeRequired  = "handshake-required"  // A request before the hello
+	codeUnsupportedVersion = "unsupported-version" // The server doesn't speak the client's version
+	codeInvalid            = "invalid"             // A field is missing or malformed
+	codeFailed             = "failed"              // The request was valid but couldn't be carried out
+)
+
+// protocolError is an error reported to the client with a code
+type protocolError struct {
+	Code    string
+	Message string
+}
+
+func (e *protocolError) Error() string {
+	return e.Message
+}
+
+// envelope holds the fields every inbound message has
+type envelope struct {
+	Type string `json:"type"`
+	ID   int    `json:"id,omitempty"` // Chosen by the client, echoed in replies
+}
+
+// request is the body of an inbound message
+type request interface {
+	validate() error
+}
+
+// requestTypes create the request for each inbound message type
+var requestTypes = map[string]func() request{
+	msgHello:            func() request { return &helloRequest{} },
+	msgInstruction:      func() request { return &instructionRequest{} },
+	msgAnalyzeDesign:    func() request { return &designRequest{} },
+	msgApplyVisualEdits: func() request { return &visualEditsRequest{} },
+	msgAIPreview:        func() request { return &aiPreviewRequest{} },
+	msgCancel:           func() request { return &cancelRequest{} },
+	msgMoveJob:          func() request { return &moveJobRequest{} },
+	msgUndoJob:          func() request { return &jobRequest{} },
+	msgRedoJob:          func() request { return &jobRequest{} },
+	msgAcceptJob:        func() request { return &jobRequest{} },
+	msgRejectJob:        func() request { return &jobRequest{} },
+	msgJobDiff:          func() request { return &jobRequest{} },
+	msgNewSession:       func() request { return &newSessionRequest{} },
+}
+
+// parseRequest decodes an inbound message and validates it. The envelope is returned
+// even when the rest fails, so the error reply can name the request.
+func parseRequest(data []byte) (envelope, request, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		// A type error without a field is the message itself, e.g. an array
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) || typeErr.Field == "" {
+			return env, nil, &protocolError{Code: codeBadMessage, Message: "message is not a JSON object"}
+		}
+		return env, nil, &protocolError{Code: codeInvalid, Message: decodeError(err)}
+	}
+	if env.Type == "" {
+		return env, nil, &protocolError{Code: codeBadMessage, Message: "message has no type"}
+	}
+
+	newRequest, ok := requestTypes[env.Type]
+	if !ok {
+		return env, nil, &protocolError{Code: codeUnknownType, Message: fmt.Sprintf("unknown message type %q", env.Type)}
+	}
+	req := newRequest()
+	if err := json.Unmarshal(data, req); err != nil {
+		return env, nil, &protocolError{Code: codeInvalid, Message: decodeError(err)}
+	}
+	if err := req.validate(); err != nil {
+		return env, nil, &protocolError{Code: codeInvalid, Message: err.Error()}
+	}
+	return env, req, nil
+}
+
+// decodeError describes a JSON decoding error in terms of the message's fields,
+// e.g. "position must be an integer"
+func decodeError(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Sprintf("%s must be %s", typeErr.Field, jsonKind(typeErr.Type))
+	}
+	return strings.TrimPrefix(err.Error(), "json: ")
+}
+
+// jsonKind names the JSON value a Go type is decoded from
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// helloRequest opens the conversation with the client's protocol version
+type helloRequest struct {
+	Version int `json:"version"`
+}
+
+func (r *helloRequest) validate() error {
+	if r.Version <= 0 {
+		return errors.New("version is required")
+	}
+	return nil
+}
+
+// instructionRequest queues a free-form instruction about a selected area
+type instructionRequest struct {
+	Instruction string          `json:"instruction"`
+	Area        bridge.AreaInfo `json:"area"`
+	Screenshot  string          `json:"screenshot,omitempty"`  // Base64 encoded image
+	Screenshots []string        `json:"screenshots,omitempty"` // Further images, referenced as [screenshot N]
+	PageURL     string          `json:"pageUrl,omitempty"`
+}
+
+func (r *instructionRequest) validate() error {
+	if strings.TrimSpace(r.Instruction) == "" {
+		return errors.New("instruction is required")
+	}
+	return nil
+}
+
+// message converts the request for the bridge
+func (r *instructionRequest) message(id int) bridge.Message {
+	return bridge.Message{
+		ID:          id,
+		Area:        r.Area,
+		Instruction: r.Instruction,
+		Screenshot:  r.Screenshot,
+		Screenshots: r.Screenshots,
+		PageURL:     r.PageURL,
+	}
+}
+
+// designImageTypes are the image types the vision API accepts
+var designImageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// designRequest asks to build a design from an image
+type designRequest struct {
+	Image     string `json:"image"`     // Base64, without a data: prefix
+	ImageType string `json:"imageType"` // One of designImageTypes; image/png if empty
+	Prompt    string `json:"prompt"`
+	PageURL   string `json:"pageUrl,omitempty"`
+}
+
+func (r *designRequest) validate() error {
+	if r.Image == "" {
+		return errors.New("image is required")
+	}
+	if strings.TrimSpace(r.Prompt) == "" {
+		return errors.New("prompt is required")
+	}
+	if r.ImageType != "" && !slices.Contains(designImageTypes, r.ImageType) {
+		return fmt.Errorf("imageType %q is not supported (use %s)", r.ImageType, strings.Join(designImageTypes, ", "))
+	}
+	return nil
+}
+
+// visualEditsRequest applies edits made on the page to the source
+type visualEditsRequest struct {
+	Changes []visualEdit `json:"changes"`
+	Batch   *editBatch   `json:"batch,omitempty"` // Set when the edits are sent in several requests
+	PageURL string       `json:"pageUrl,omitempty"`
+}
+
+// editBatch numbers one of several visual edits requests
+type editBatch struct {
+	Number int `json:"number"` // 1-based
+	Total  int `json:"total"`
+}
+
+// Visual edit operations
+const (
+	opTransform = "transform"
+	opReorder   = "reorder"
+	opText      = "text"
+	opAI        = "ai"
+)
+
+// visualEdit is one change made on the page. Which fields are set depends on the operation.
+type visualEdit struct {
+	Operation string              `json:"operation"` // transform (default), reorder, text or ai
+	Selector  string              `json:"selector"`
+	Source    *sourcemap.Location `json:"source,omitempty"`
+
+	Styles       *editStyles  `json:"styles,omitempty"`      // transform
+	ReorderData  *editReorder `json:"reorderData,omitempty"` // reorder
+	OldText      string       `json:"oldText,omitempty"`     // text
+	NewText      string       `json:"newText,omitempty"`     // text
+	Instruction  string       `json:"instruction,omitempty"` // ai
+	ElementCount int          `json:"elementCount,omitempty"`
+	Bounds       *editBounds  `json:"bounds,omitempty"`
+	Screenshot   string       `json:"screenshot,omitempty"`
+}
+
+// editStyles are the inline styles a move or resize left on an element
+type editStyles struct {
+	Transform string `json:"transform,omitempty"`
+	Width     string `json:"width,omitempty"`
+	Height    string `json:"height,omitempty"`
+}
+
+// editReorder describes an element moved among its siblings
+type editReorder struct {
+	ParentSelector       string `json:"parentSelector"`
+	FromIndex            int    `json:"fromIndex"`
+	ToIndex              int    `json:"toIndex"`
+	InsertBeforeSelector string `json:"insertBeforeSelector,omitempty"`
+	InsertAfterSelector  string `json:"insertAfterSelector,omitempty"`
+}
+
+// editBounds is the selected area of an ai edit, in CSS pixels
+type editBounds struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+func (r *visualEditsRequest) validate() error {
+	if len(r.Changes) == 0 {
+		return errors.New("changes is required")
+	}
+	if r.Batch != nil && (r.Batch.Number < 1 || r.Batch.Number > r.Batch.Total) {
+		return fmt.Errorf("batch %d of %d is out of range", r.Batch.Number, r.Batch.Total)
+	}
+	for i, change := range r.Changes {
+		if err := change.validate(); err != nil {
+			return fmt.Errorf("changes[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (e *visualEdit) validate() error {
+	switch e.Operation {
+	case "", opTransform, opText:
+	case opReorder:
+		if e.ReorderData == nil {
+			return errors.New("reorderData is required for a reorder")
+		}
+	case opAI:
+		if strings.TrimSpace(e.Instruction) == "" {
+			return errors.New("instruction is required for an ai edit")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown operation %q (use %s, %s, %s or %s)", e.Operation, opTransform, opReorder, opText, opAI)
+	}
+	if e.Selector == "" {
+		return errors.New("selector is required")
+	}
+	return nil
+}
+
+// aiPreviewRequest asks for DOM changes that preview an instruction without editing files
+type aiPreviewRequest struct {
+	Instruction  string           `json:"instruction"`
+	Screenshot   string           `json:"screenshot,omitempty"`
+	Elements     []ai.ElementInfo `json:"elements"`
+	DesignTokens *ai.DesignTokens `json:"designTokens,omitempty"`
+}
+
+func (r *aiPreviewRequest) validate() error {
+	if strings.TrimSpace(r.Instruction) == "" {
+		return errors.New("instruction is required")
+	}
+	if len(r.Elements) == 0 {
+		return errors.New("elements is required")
+	}
+	return nil
+}
+
+// cancelRequest drops a queued job or stops a running one (the running job without a job ID)
+type cancelRequest struct {
+	JobID string `json:"jobId,omitempty"`
+}
+
+func (r *cancelRequest) validate() error {
+	return nil
+}
+
+// moveJobRequest moves a queued job to another place in the queue
+type moveJobRequest struct {
+	JobID    string `json:"jobId"`
+	Position int    `json:"position"` // 1-based
+}
+
+func (r *moveJobRequest) validate() error {
+	if r.JobID == "" {
+		return errors.New("jobId is required")
+	}
+	if r.Position < 1 {
+		return errors.New("position must be 1 or more")
+	}
+	return nil
+}
+
+// jobRequest acts on a job: undo, redo, accept, reject or job-diff
+type jobRequest struct {
+	JobID string `json:"jobId"`
+}
+
+func (r *jobRequest) validate() error {
+	if r.JobID == "" {
+		return errors.New("jobId is required")
+	}
+	return nil
+}
+
+// newSessionRequest makes the next instruction start a new agent session
+type newSessionRequest struct{}
+
+func (r *newSessionRequest) validate() error {
+	return nil
+}
+
+// reply starts every reply to a request
+type reply struct {
+	Type   string `json:"type"`         // The request's type
+	ID     int    `json:"id,omitempty"` // The request's id
+	Status string `json:"status"`
+	Code   string `json:"code,omitempty"` // Set with status "error"
+	Error  string `json:"error,omitempty"`
+}
+
+// newReply starts a reply to a request
+func newReply(env envelope, status string) reply {
+	return reply{Type: env.Type, ID: env.ID, Status: status}
+}
+
+// errorReply reports a failed request. Messages that can't be attributed to a request
+// type, and requests before the hello, are answered with an "error" message.
+func errorReply(env envelope, err error) reply {
+	r := newReply(env, statusError)
+	r.Code = codeFailed
+	var protoErr *protocolError
+	if errors.As(err, &protoErr) {
+		r.Code = protoErr.Code
+	}
+	r.Error = err.Error()
+
+	switch r.Code {
+	case codeBadMessage, codeUnknownType, codeHandshakeRequired:
+		r.Type = msgError
+	}
+	return r
+}
+
+// helloReply accepts the client's protocol version
+type helloReply struct {
+	reply
+	Version    int `json:"version"`
+	MinVersion int `json:"minVersion"`
+}
+
+// receivedReply acknowledges a queued job
+type receivedReply struct {
+	reply
+	JobID    string `json:"jobId"`
+	Position int    `json:"position"` // 1-based place in the queue
+}
+
+// jobResult reports how a submitted job ended
+type jobResult struct {
+	reply
+	JobID   string            `json:"jobId"`
+	Files   []string          `json:"files"`            // Every file touched, also before a cancel or error
+	Changes []snapshot.Change `json:"changes"`          // How each file changed
+	Review  bool              `json:"review,omitempty"` // The changes wait in a worktree for review
+}
+
+// jobReply answers a request about a job: cancel, move, undo, redo, accept or reject
+type jobReply struct {
+	reply
+	JobID     string      `json:"jobId,omitempty"`
+	Job       *bridge.Job `json:"job,omitempty"`       // The job after the change
+	Conflicts []string    `json:"conflicts,omitempty"` // Files an undo or redo couldn't restore
+}
+
+// diffReply carries the patch a job awaiting review would apply
+type diffReply struct {
+	reply
+	JobID string `json:"jobId"`
+	Diff  string `json:"diff"`
+}
+
+// previewReply carries the DOM changes that preview an instruction
+type previewReply struct {
+	reply
+	Changes []ai.DOMChange `json:"changes"`
+}
+
+// jobsMessage sends the whole job queue
+type jobsMessage struct {
+	Type string       `json:"type"`
+	Jobs []bridge.Job `json:"jobs"`
+}
+
+// jobMessage pushes a job state change
+type jobMessage struct {
+	Type string     `json:"type"`
+	Job  bridge.Job `json:"job"`
+}
+
+// Activity kinds
+const (
+	activityTool  = "tool"  // The agent called a tool
+	activityText  = "text"  // The agent said something
+	activityError = "error" // A tool call failed
+)
+
+// activityMessage pushes a one-line summary of what the agent is doing in the running job
+type activityMessage struct {
+	Type    string    `json:"type"`
+	JobID   string    `json:"jobId"`
+	Kind    string    `json:"kind"`           // tool, text or error
+	Tool    string    `json:"tool,omitempty"` // The tool called, e.g. "Edit"
+	File    string    `json:"file,omitempty"` // The file the tool acts on, project-relative when possible
+	Summary string    `json:"summary"`        // e.g. "Editing styles.css"
+	At      time.Time `json:"at"`
+}
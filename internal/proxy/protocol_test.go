@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		wantType string
+		wantID   int
+		wantCode string // Empty for a valid request
+		wantErr  string // Substring of the error message
+	}{
+		{name: "hello", message: `{"type":"hello","version":1}`, wantType: msgHello},
+		{name: "hello without version", message: `{"type":"hello"}`, wantType: msgHello, wantCode: codeInvalid, wantErr: "version is required"},
+		{name: "not JSON", message: `hello`, wantCode: codeBadMessage},
+		{name: "not an object", message: `[1,2]`, wantCode: codeBadMessage},
+		{name: "no type", message: `{"id":3}`, wantID: 3, wantCode: codeBadMessage, wantErr: "no type"},
+		{name: "unknown type", message: `{"type":"launch","id":4}`, wantType: "launch", wantID: 4, wantCode: codeUnknownType},
+		{name: "id of the wrong kind", message: `{"type":"cancel","id":"x"}`, wantType: msgCancel, wantCode: codeInvalid, wantErr: "id must be an integer"},
+
+		{name: "instruction", message: `{"type":"instruction","id":7,"instruction":"Make it red","area":{"width":10}}`, wantType: msgInstruction, wantID: 7},
+		{name: "blank instruction", message: `{"type":"instruction","instruction":"  "}`, wantType: msgInstruction, wantCode: codeInvalid, wantErr: "instruction is required"},
+		{name: "area of the wrong kind", message: `{"type":"instruction","instruction":"x","area":{"width":"wide"}}`, wantType: msgInstruction, wantCode: codeInvalid, wantErr: "area.width must be an integer"},
+
+		{name: "design", message: `{"type":"analyze-design","image":"abc","prompt":"Build it"}`, wantType: msgAnalyzeDesign},
+		{name: "design without image", message: `{"type":"analyze-design","prompt":"Build it"}`, wantType: msgAnalyzeDesign, wantCode: codeInvalid, wantErr: "image is required"},
+		{name: "design image type", message: `{"type":"analyze-design","image":"abc","prompt":"x","imageType":"image/tiff"}`, wantType: msgAnalyzeDesign, wantCode: codeInvalid, wantErr: "image/tiff"},
+
+		{name: "visual edits", message: `{"type":"apply-visual-edits","changes":[{"selector":"#a","styles":{"width":"10px"}},{"operation":"ai","instruction":"Tidy up"}]}`, wantType: msgApplyVisualEdits},
+		{name: "no visual edits", message: `{"type":"apply-visual-edits","changes":[]}`, wantType: msgApplyVisualEdits, wantCode: codeInvalid, wantErr: "changes is required"},
+		{name: "edit without selector", message: `{"type":"apply-visual-edits","changes":[{"operation":"text","newText":"Hi"}]}`, wantType: msgApplyVisualEdits, wantCode: codeInvalid, wantErr: "changes[0]: selector is required"},
+		{name: "reorder without data", message: `{"type":"apply-visual-edits","changes":[{"selector":"#a"},{"operation":"reorder","selector":"#b"}]}`, wantType: msgApplyVisualEdits, wantCode: codeInvalid, wantErr: "changes[1]: reorderData"},
+		{name: "unknown operation", message: `{"type":"apply-visual-edits","changes":[{"operation":"rotate","selector":"#a"}]}`, wantType: msgApplyVisualEdits, wantCode: codeInvalid, wantErr: `unknown operation "rotate"`},
+		{name: "batch out of range", message: `{"type":"apply-visual-edits","changes":[{"selector":"#a"}],"batch":{"number":3,"total":2}}`, wantType: msgApplyVisualEdits, wantCode: codeInvalid, wantErr: "batch 3 of 2"},
+
+		{name: "ai preview", message: `{"type":"ai-preview","instruction":"Bigger","elements":[{"tagName":"DIV"}]}`, wantType: msgAIPreview},
+		{name: "ai preview without elements", message: `{"type":"ai-preview","instruction":"Bigger"}`, wantType: msgAIPreview, wantCode: codeInvalid, wantErr: "elements is required"},
+
+		{name: "cancel running", message: `{"type":"cancel"}`, wantType: msgCancel},
+		{name: "move job", message: `{"type":"move-job","jobId":"a1","position":2}`, wantType: msgMoveJob},
+		{name: "move to 0", message: `{"type":"move-job","jobId":"a1","position":0}`, wantType: msgMoveJob, wantCode: codeInvalid, wantErr: "position must be 1 or more"},
+		{name: "position of the wrong kind", message: `{"type":"move-job","jobId":"a1","position":"top"}`, wantType: msgMoveJob, wantCode: codeInvalid, wantErr: "position must be an integer"},
+		{name: "undo without job", message: `{"type":"undo-job"}`, wantType: msgUndoJob, wantCode: codeInvalid, wantErr: "jobId is required"},
+		{name: "accept job", message: `{"type":"accept-job","jobId":"a1"}`, wantType: msgAcceptJob},
+		{name: "new session", message: `{"type":"new-session"}`, wantType: msgNewSession},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, req, err := parseRequest([]byte(tt.message))
+
+			if env.Type != tt.wantType || env.ID != tt.wantID {
+				t.Errorf("envelope = %+v, want type %q and id %d", env, tt.wantType, tt.wantID)
+			}
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("parseRequest() error = %v", err)
+				}
+				if req == nil {
+					t.Fatal("parseRequest() returned no request")
+				}
+				return
+			}
+
+			var protoErr *protocolError
+			if !errors.As(err, &protoErr) {
+				t.Fatalf("parseRequest() error = %v, want a protocol error", err)
+			}
+			if protoErr.Code != tt.wantCode || !strings.Contains(protoErr.Message, tt.wantErr) {
+				t.Errorf("error = %s: %q, want %s: %q", protoErr.Code, protoErr.Message, tt.wantCode, tt.wantErr)
+			}
+			if req != nil {
+				t.Errorf("invalid message returned a request: %+v", req)
+			}
+		})
+	}
+}
+
+func TestInstructionRequestMessage(t *testing.T) {
+	_, req, err := parseRequest([]byte(`{"type":"instruction","id":5,"instruction":"Make it red","screenshot":"AAA","screenshots":["BBB"],"pageUrl":"/about"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := req.(*instructionRequest).message(42)
+	if msg.ID != 42 || msg.Instruction != "Make it red" || msg.Screenshot != "AAA" || len(msg.Screenshots) != 1 || msg.PageURL != "/about" {
+		t.Errorf("message = %+v", msg)
+	}
+}
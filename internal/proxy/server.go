@@ -2,22 +2,30 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
 	"embed"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"os"
+	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/thetronjohnson/layrr/internal/ai"
 	"github.com/thetronjohnson/layrr/internal/analyzer"
 	"github.com/thetronjohnson/layrr/internal/bridge"
+	"github.com/thetronjohnson/layrr/internal/claude"
 	"github.com/thetronjohnson/layrr/internal/config"
+	"github.com/thetronjohnson/layrr/internal/events"
+	"github.com/thetronjohnson/layrr/internal/prompt"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+	"github.com/thetronjohnson/layrr/internal/sourcemap"
 	"github.com/thetronjohnson/layrr/internal/watcher"
 )
 
@@ -27,58 +35,165 @@ var clientAssets embed.FS
 //go:embed cursor.svg
 var cursorAsset []byte
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for development
-	},
+//go:embed icons
+var iconAssets embed.FS
+
+// clientConn is a message WebSocket that can be written to from several goroutines
+type clientConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+// WriteJSON writes a JSON message with a short write deadline
+func (c *clientConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	return c.Conn.WriteJSON(v)
 }
 
 // Server is the proxy server
 type Server struct {
 	proxyPort  int
-	targetPort int
 	bridge     *bridge.Bridge
 	watcher    *watcher.Watcher
 	verbose    bool
 	httpServer *http.Server
+	tlsCert    *tls.Certificate // Serve HTTPS with this certificate (nil = plain HTTP)
+	token      string           // Session secret the injected page needs to open WebSockets
+	lan        bool             // Listen on all interfaces instead of loopback only
 	projectDir string
+	sources    *sourcemap.Resolver
+	prompts    *prompt.Templates
+
+	// Dev server behind the proxy; it moves when a supervised dev server restarts on another port
+	target    Target
+	transport *http.Transport
+	targetMu  sync.RWMutex
+
+	// Connected message WebSockets that receive job updates
+	clients   map[*clientConn]bool
+	clientsMu sync.RWMutex
+
+	// Agent activity of the running job, tracked from the bus
+	activityMu   sync.Mutex
+	runningJob   string
+	lastActivity *activityMessage // Sent to clients that connect mid-run
 }
 
 // NewServer creates a new proxy server
-func NewServer(proxyPort, targetPort int, bridge *bridge.Bridge, watcher *watcher.Watcher, verbose bool, projectDir string) *Server {
-	return &Server{
+func NewServer(proxyPort int, target Target, bridge *bridge.Bridge, bus *events.Bus, watcher *watcher.Watcher, verbose bool, projectDir string) (*Server, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
 		proxyPort:  proxyPort,
-		targetPort: targetPort,
 		bridge:     bridge,
 		watcher:    watcher,
 		verbose:    verbose,
 		projectDir: projectDir,
+		sources:    sourcemap.NewResolver(projectDir),
+		prompts:    prompt.New(projectDir),
+		clients:    make(map[*clientConn]bool),
+		token:      token,
+		target:     target,
+		transport:  target.transport(),
 	}
+
+	// Push job state changes and agent activity to every connected browser
+	bus.Subscribe(s.handleEvent)
+
+	return s, nil
 }
 
-// Start starts the proxy server
-func (s *Server) Start() error {
-	// Create the reverse proxy
-	target, err := url.Parse(fmt.Sprintf("http://localhost:%d", s.targetPort))
-	if err != nil {
-		return fmt.Errorf("failed to parse target URL: %w", err)
+// SetTarget makes the proxy forward to another dev server from the next request on
+func (s *Server) SetTarget(target Target) {
+	s.targetMu.Lock()
+	old := s.transport
+	s.target = target
+	s.transport = target.transport()
+	s.targetMu.Unlock()
+
+	old.CloseIdleConnections()
+}
+
+// currentTarget returns the dev server behind the proxy and the transport that reaches it
+func (s *Server) currentTarget() (Target, *http.Transport) {
+	s.targetMu.RLock()
+	defer s.targetMu.RUnlock()
+	return s.target, s.transport
+}
+
+// targetTransport follows the proxy's target when SetTarget moves it
+type targetTransport struct {
+	server *Server
+}
+
+// RoundTrip sends a proxied request to the dev server with its current transport
+func (t targetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, transport := t.server.currentTarget()
+	return transport.RoundTrip(req)
+}
+
+// EnableHTTPS makes the proxy serve HTTPS with cert, giving the page a secure context
+func (s *Server) EnableHTTPS(cert tls.Certificate) {
+	s.tlsCert = &cert
+}
+
+// URL returns the proxy's address as seen by the browser
+func (s *Server) URL() string {
+	scheme := "http"
+	if s.tlsCert != nil {
+		scheme = "https"
 	}
+	return fmt.Sprintf("%s://localhost:%d", scheme, s.proxyPort)
+}
 
-	proxy := httputil.NewSingleHostReverseProxy(target)
+// handler routes the proxy's own endpoints and proxies everything else to the target
+func (s *Server) handler() http.Handler {
+	// Create the reverse proxy. Paths are passed through unchanged; the target's path
+	// is only where the browser starts.
+	proxy := &httputil.ReverseProxy{Transport: targetTransport{server: s}}
 
-	// Customize the Director to preserve the original host
-	originalDirector := proxy.Director
+	// Send each request to the current target with its host, as if the browser talked to it directly
+	forwardedProto := "http"
+	if s.tlsCert != nil {
+		forwardedProto = "https"
+	}
 	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-		req.Host = target.Host
-		// Remove Accept-Encoding to prevent compression issues with injection
-		// This ensures we get uncompressed HTML for easier manipulation
-		req.Header.Del("Accept-Encoding")
+		target, _ := s.currentTarget()
+		origin := target.origin()
+		proxyHost := req.Host
+		req.URL.Scheme = origin.Scheme
+		req.URL.Host = origin.Host
+		req.Host = origin.Host
+		if _, ok := req.Header["User-Agent"]; !ok {
+			req.Header.Set("User-Agent", "") // Don't add Go's default User-Agent
+		}
+		req.Header.Set("X-Forwarded-Host", proxyHost)
+		req.Header.Set("X-Forwarded-Proto", forwardedProto)
+		// Only offer the compressions the injector can re-encode
+		if accept := AcceptedEncodings(req.Header.Get("Accept-Encoding")); accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
+		} else {
+			req.Header.Del("Accept-Encoding")
+		}
+		// A browser revalidating a page cached by an earlier run would keep its old token
+		if pageRequest(req) {
+			req.Header.Del("If-None-Match")
+			req.Header.Del("If-Modified-Since")
+		}
 	}
 
-	// Modify responses to inject our scripts and styles
+	// Keep redirects and cookies on the proxy, then inject our scripts and styles
 	proxy.ModifyResponse = func(resp *http.Response) error {
-		return InjectScript(resp, "/__layrr")
+		target, _ := s.currentTarget()
+		target.rewriteLocation(resp)
+		target.rewriteCookies(resp, s.tlsCert != nil)
+		return InjectScript(resp, "/__layrr", s.token)
 	}
 
 	// Suppress "context canceled" errors that occur during normal operation
@@ -88,6 +203,11 @@ func (s *Server) Start() error {
 			if s.verbose {
 				fmt.Fprintf(os.Stderr, "[Proxy] Error: %v\n", err)
 			}
+			var certErr *tls.CertificateVerificationError
+			if errors.As(err, &certErr) {
+				http.Error(w, "Bad Gateway: the dev server's TLS certificate is not trusted (run layrr with -target-insecure for self-signed certs)", http.StatusBadGateway)
+				return
+			}
 			http.Error(w, "Bad Gateway", http.StatusBadGateway)
 		}
 	}
@@ -105,28 +225,80 @@ func (s *Server) Start() error {
 	// Serve the custom cursor asset
 	mux.HandleFunc("/__layrr/cursor.svg", s.handleCursorAsset)
 
+	// Serve the overlay's icons from this origin, so the page's CSP needn't allow another host
+	mux.HandleFunc("/__layrr/icons/", s.handleIconAsset)
+
 	// WebSocket endpoint for live reload
 	mux.HandleFunc("/__layrr/ws/reload", s.handleReloadWebSocket)
 
 	// WebSocket endpoint for messaging
 	mux.HandleFunc("/__layrr/ws/message", s.handleMessageWebSocket)
 
+	// JSON API for scripts and editor extensions
+	mux.Handle(apiPrefix, s.apiHandler())
+
 	// Proxy all other requests
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		proxy.ServeHTTP(w, r)
 	})
 
+	return s.checkHost(mux)
+}
+
+// Start starts the proxy server
+func (s *Server) Start() error {
 	// Create the HTTP server
-	addr := fmt.Sprintf(":%d", s.proxyPort)
 	s.httpServer = &http.Server{
-		Addr:    addr,
-		Handler: mux,
+		Handler: s.handler(),
+	}
+	if s.tlsCert != nil {
+		s.httpServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{*s.tlsCert}}
+	}
+
+	listeners, err := s.listen()
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("🚀 Layrr proxy server starting on http://localhost%s\n", addr)
-	fmt.Printf("   Proxying to: http://localhost:%d\n", s.targetPort)
+	fmt.Printf("🚀 Layrr proxy server starting on %s\n", s.URL())
+	target, _ := s.currentTarget()
+	fmt.Printf("   Proxying to: %s\n", target)
 
-	return s.httpServer.ListenAndServe()
+	errs := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func() {
+			if s.tlsCert != nil {
+				errs <- s.httpServer.ServeTLS(ln, "", "")
+			} else {
+				errs <- s.httpServer.Serve(ln)
+			}
+		}()
+	}
+	return <-errs
+}
+
+// listen opens the proxy port on the IPv4 and IPv6 loopback addresses (the browser may
+// resolve localhost to either), or on all interfaces with LAN access enabled
+func (s *Server) listen() ([]net.Listener, error) {
+	if s.lan {
+		ln, err := net.Listen("tcp", fmt.Sprintf(":%d", s.proxyPort))
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", s.proxyPort))
+	if err != nil {
+		return nil, err
+	}
+	listeners := []net.Listener{ln}
+	if ln6, err := net.Listen("tcp", fmt.Sprintf("[::1]:%d", s.proxyPort)); err == nil {
+		listeners = append(listeners, ln6)
+	} else if s.verbose {
+		fmt.Printf("[Proxy] Not listening on IPv6 loopback: %v\n", err)
+	}
+	return listeners, nil
 }
 
 // handleAsset returns a handler function for serving embedded assets
@@ -151,20 +323,27 @@ func (s *Server) handleCursorAsset(w http.ResponseWriter, r *http.Request) {
 	w.Write(cursorAsset)
 }
 
+// handleIconAsset serves one of the overlay's icon SVGs
+func (s *Server) handleIconAsset(w http.ResponseWriter, r *http.Request) {
+	icon, err := iconAssets.ReadFile("icons/" + path.Base(r.URL.Path))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(icon)
+}
+
 // handleAnalyzeDesign handles design analysis and passes context to Claude Code
-func (s *Server) handleAnalyzeDesign(conn *websocket.Conn, data map[string]interface{}) error {
+func (s *Server) handleAnalyzeDesign(conn *clientConn, env envelope, req *designRequest) error {
 	if s.verbose {
 		fmt.Println("[Proxy] Handling analyze-design request")
 	}
 
-	// Extract fields
-	imageBase64, _ := data["image"].(string)
-	imageType, _ := data["imageType"].(string)
-	userPrompt, _ := data["prompt"].(string)
-
-	if imageBase64 == "" || userPrompt == "" {
-		return fmt.Errorf("missing required fields: image or prompt")
-	}
+	imageBase64 := req.Image
+	imageType := req.ImageType
+	userPrompt := req.Prompt
 
 	// Default to image/png if type not provided
 	if imageType == "" {
@@ -200,48 +379,17 @@ func (s *Server) handleAnalyzeDesign(conn *websocket.Conn, data map[string]inter
 	}
 
 	// Build vision analysis prompt
-	visionPrompt := fmt.Sprintf(`You are analyzing a design image for a %s project using %s for styling.
-
-User's request: %s
-
-CRITICAL: Analyze EVERY element in this design image. Do not skip or omit anything.
-
-Provide a comprehensive description that includes:
-
-1. **Layout & Structure** (TOP TO BOTTOM, LEFT TO RIGHT):
-   - Header/navigation (logo, menu items, buttons)
-   - Hero section (headings, subheadings, all text content)
-   - Call-to-action buttons (text, colors, placement)
-   - Feature sections (cards, icons, descriptions)
-   - Decorative elements (shapes, illustrations, backgrounds)
-   - Footer elements
-
-2. **All Text Content**:
-   - Write out EVERY piece of text you see (headings, paragraphs, button labels, etc.)
-   - Note text sizes, weights, and colors
-
-3. **Colors & Styling**:
-   - Background colors/gradients
-   - Text colors
-   - Button colors (normal and hover states if visible)
-   - Border colors and radius values
-   - Shadow effects
-
-4. **Spacing & Dimensions**:
-   - Margins and padding between sections
-   - Element sizes (buttons, cards, etc.)
-   - Alignment (left, center, right)
-
-5. **Interactive Elements**:
-   - All buttons (primary, secondary, text links)
-   - Input fields if present
-   - Icons and their purposes
-
-6. **Responsive/Layout Notes**:
-   - How elements are arranged (grid, flex)
-   - Relative positioning
-
-Be EXHAUSTIVELY detailed. A developer should be able to recreate this pixel-perfect from your description alone.`, ctx.String(), ctx.Styling, userPrompt)
+	design := prompt.DesignData{
+		Request:    userPrompt,
+		Project:    ctx.String(),
+		Framework:  ctx.Framework,
+		Styling:    ctx.Styling,
+		TypeScript: ctx.TypeScript,
+	}
+	visionPrompt, err := s.prompts.Render(prompt.DesignAnalysis, design)
+	if err != nil {
+		return err
+	}
 
 	// Call Claude Vision API
 	client := ai.NewClient(apiKey)
@@ -254,26 +402,11 @@ Be EXHAUSTIVELY detailed. A developer should be able to recreate this pixel-perf
 		fmt.Printf("[Proxy] ✓ Vision analysis completed (%d bytes)\n", len(visualAnalysis))
 	}
 
-	// Format as a message for Claude Code
-	instruction := fmt.Sprintf(`%s
-
-IMPORTANT: Implement EVERY element described below. Do not skip or omit any components, text, buttons, or decorative elements.
-
-Design Analysis:
-%s
-
-Create a complete, production-ready component that includes:
-- All text content exactly as described
-- All buttons and interactive elements
-- All styling (colors, spacing, typography)
-- All decorative elements and shapes
-- Proper layout and responsive behavior
-
-The result should be pixel-perfect to the original design.`, userPrompt, visualAnalysis)
-
-	// Create a bridge message (similar to element selection)
+	// Create a bridge message (similar to element selection);
+	// the bridge renders the design template around the analysis
+	design.Analysis = visualAnalysis
 	msg := bridge.Message{
-		ID: int(time.Now().UnixNano() / 1000000), // Use timestamp as ID
+		ID: messageID(env),
 		Area: bridge.AreaInfo{
 			X:            0,
 			Y:            0,
@@ -282,68 +415,49 @@ The result should be pixel-perfect to the original design.`, userPrompt, visualA
 			ElementCount: 0,
 			Elements:     []bridge.ElementInfo{},
 		},
-		Instruction: instruction,
+		Instruction: userPrompt,
 		Screenshot:  "", // We already analyzed the image, no need to send again
+		PageURL:     req.PageURL,
+		Design:      &design,
 	}
 
 	if s.verbose {
-		fmt.Printf("[Proxy] Sending to Claude Code: %s\n", instruction[:min(100, len(instruction))])
+		fmt.Printf("[Proxy] Sending to Claude Code: %s\n", userPrompt[:min(100, len(userPrompt))])
 	}
 
-	// Send acknowledgment to frontend
-	conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-	conn.WriteJSON(map[string]interface{}{
-		"id":     msg.ID,
-		"status": "received",
-	})
-
-	// Send to Claude Code through the bridge
-	// This will block until Claude Code completes
-	fmt.Printf("[Proxy] ⏳ Processing design request (ID %d)...\n", msg.ID)
-	err = s.bridge.HandleMessage(msg)
+	// Queue for Claude Code through the bridge
+	// This will block until the job completes
+	if s.verbose {
+		fmt.Printf("[Proxy] ⏳ Processing design request (ID %d)...\n", msg.ID)
+	}
+	job := s.submitJob(conn, env, msg)
 
 	// Send completion status
-	if err != nil {
-		fmt.Printf("[Proxy] ❌ Error processing design: %v\n", err)
-		conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-		conn.WriteJSON(map[string]interface{}{
-			"id":     msg.ID,
-			"status": "error",
-			"error":  err.Error(),
-		})
-	} else {
-		fmt.Printf("[Proxy] 🎉 Design implementation complete (ID %d)\n", msg.ID)
-		conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-		conn.WriteJSON(map[string]interface{}{
-			"id":     msg.ID,
-			"status": "complete",
-		})
+	if s.verbose {
+		switch job.State {
+		case bridge.JobCancelled:
+			fmt.Printf("[Proxy] ⏹  Design request cancelled (ID %d)\n", msg.ID)
+		case bridge.JobFailed:
+			fmt.Printf("[Proxy] ❌ Error processing design: %s\n", job.Error)
+		default:
+			fmt.Printf("[Proxy] 🎉 Design implementation complete (ID %d)\n", msg.ID)
+		}
 	}
+	conn.WriteJSON(newJobResult(env, job))
 
 	return nil
 }
 
 // handleApplyVisualEdits handles applying visual drag/resize changes to the codebase
-func (s *Server) handleApplyVisualEdits(conn *websocket.Conn, data map[string]interface{}) error {
+func (s *Server) handleApplyVisualEdits(conn *clientConn, env envelope, req *visualEditsRequest) error {
 	if s.verbose {
 		fmt.Println("[Proxy] Handling apply-visual-edits request")
 	}
 
-	// Extract changes array
-	changesData, ok := data["changes"].([]interface{})
-	if !ok || len(changesData) == 0 {
-		return fmt.Errorf("missing or invalid changes array")
-	}
-
-	// Extract batch info if present (Phase 3)
 	var batchNumber, totalBatches int
-	if batchData, ok := data["batch"].(map[string]interface{}); ok {
-		if num, ok := batchData["number"].(float64); ok {
-			batchNumber = int(num)
-		}
-		if total, ok := batchData["total"].(float64); ok {
-			totalBatches = int(total)
-		}
+	if req.Batch != nil {
+		batchNumber = req.Batch.Number
+		totalBatches = req.Batch.Total
 	}
 
 	// Analyze project context
@@ -365,222 +479,123 @@ func (s *Server) handleApplyVisualEdits(conn *websocket.Conn, data map[string]in
 	}
 
 	// Build detailed instruction for Claude
-	var instruction strings.Builder
-	if totalBatches > 1 {
-		instruction.WriteString(fmt.Sprintf("BATCH %d of %d: I made the following visual changes to elements:\n\n", batchNumber, totalBatches))
-	} else {
-		instruction.WriteString("I made the following visual changes to elements:\n\n")
+	edits := prompt.VisualEditsData{
+		Batch:        batchNumber,
+		TotalBatches: totalBatches,
+		Framework:    ctx.Framework,
+		Styling:      ctx.Styling,
 	}
+	var screenshots []string // Forwarded to Claude Code as [screenshot N]
 
-	for i, changeData := range changesData {
-		changeMap, ok := changeData.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		selector, _ := changeMap["selector"].(string)
-		operation, _ := changeMap["operation"].(string)
+	for i, edit := range req.Changes {
+		operation := edit.Operation
 
 		// Default to transform if operation not specified (backward compatibility)
 		if operation == "" {
-			operation = "transform"
+			operation = opTransform
 		}
 
-		if operation == "reorder" {
-			// REORDER OPERATION
-			reorderData, ok := changeMap["reorderData"].(map[string]interface{})
-			if !ok {
-				continue
-			}
-
-			parentSelector, _ := reorderData["parentSelector"].(string)
-			fromIndex, _ := reorderData["fromIndex"].(float64) // JSON numbers are float64
-			toIndex, _ := reorderData["toIndex"].(float64)
-			insertBeforeSelector, _ := reorderData["insertBeforeSelector"].(string)
-			insertAfterSelector, _ := reorderData["insertAfterSelector"].(string)
-
-			instruction.WriteString(fmt.Sprintf("%d. REORDER: Element '%s'\n", i+1, selector))
-			instruction.WriteString(fmt.Sprintf("   - Parent container: %s\n", parentSelector))
-			instruction.WriteString(fmt.Sprintf("   - Move from position %d to position %d\n", int(fromIndex), int(toIndex)))
+		change := prompt.VisualChange{
+			Number:    i + 1,
+			Operation: operation,
+			Selector:  edit.Selector,
+			Source:    s.sourceLocation(edit.Source),
+		}
 
-			if insertBeforeSelector != "" {
-				instruction.WriteString(fmt.Sprintf("   - Insert before: %s\n", insertBeforeSelector))
-			} else if insertAfterSelector != "" {
-				instruction.WriteString(fmt.Sprintf("   - Insert after: %s\n", insertAfterSelector))
+		switch operation {
+		case opReorder:
+			change.ParentSelector = edit.ReorderData.ParentSelector
+			change.FromIndex = edit.ReorderData.FromIndex
+			change.ToIndex = edit.ReorderData.ToIndex
+			change.InsertBefore = edit.ReorderData.InsertBeforeSelector
+			change.InsertAfter = edit.ReorderData.InsertAfterSelector
+
+		case opText:
+			change.OldText = edit.OldText
+			change.NewText = edit.NewText
+
+		case opAI:
+			change.Instruction = edit.Instruction
+			change.ElementCount = edit.ElementCount
+
+			if edit.Bounds != nil {
+				change.Bounds = &prompt.Area{
+					X:      int(math.Round(edit.Bounds.X)),
+					Y:      int(math.Round(edit.Bounds.Y)),
+					Width:  int(math.Round(edit.Bounds.Width)),
+					Height: int(math.Round(edit.Bounds.Height)),
+				}
 			}
-			instruction.WriteString("\n")
-		} else if operation == "text" {
-			// TEXT EDIT OPERATION
-			oldText, _ := changeMap["oldText"].(string)
-			newText, _ := changeMap["newText"].(string)
-
-			instruction.WriteString(fmt.Sprintf("%d. TEXT EDIT: Element '%s'\n", i+1, selector))
-			instruction.WriteString(fmt.Sprintf("   - Old text: \"%s\"\n", oldText))
-			instruction.WriteString(fmt.Sprintf("   - New text: \"%s\"\n", newText))
-			instruction.WriteString("\n")
-		} else if operation == "ai" {
-			// AI INSTRUCTION OPERATION
-			aiInstruction, _ := changeMap["instruction"].(string)
-			boundsData, _ := changeMap["bounds"].(map[string]interface{})
-			elementCount, _ := changeMap["elementCount"].(float64)
-
-			instruction.WriteString(fmt.Sprintf("%d. AI INSTRUCTION: '%s'\n", i+1, aiInstruction))
-			instruction.WriteString(fmt.Sprintf("   - Target: Element '%s'\n", selector))
-			instruction.WriteString(fmt.Sprintf("   - Affected elements: %d\n", int(elementCount)))
-
-			if boundsData != nil {
-				x, _ := boundsData["x"].(float64)
-				y, _ := boundsData["y"].(float64)
-				width, _ := boundsData["width"].(float64)
-				height, _ := boundsData["height"].(float64)
-				instruction.WriteString(fmt.Sprintf("   - Area: (%.0f, %.0f) - %.0f×%.0fpx\n", x, y, width, height))
+			if edit.Screenshot != "" {
+				screenshots = append(screenshots, edit.Screenshot)
+				change.Screenshot = len(screenshots)
 			}
-			instruction.WriteString("\n")
-		} else {
-			// TRANSFORM/RESIZE OPERATION
-			stylesData, _ := changeMap["styles"].(map[string]interface{})
-
-			instruction.WriteString(fmt.Sprintf("%d. TRANSFORM: Element '%s'\n", i+1, selector))
 
-			if transform, ok := stylesData["transform"].(string); ok && transform != "" {
-				instruction.WriteString(fmt.Sprintf("   - Position changed: %s\n", transform))
-			}
-			if width, ok := stylesData["width"].(string); ok && width != "" {
-				instruction.WriteString(fmt.Sprintf("   - Width: %s\n", width))
-			}
-			if height, ok := stylesData["height"].(string); ok && height != "" {
-				instruction.WriteString(fmt.Sprintf("   - Height: %s\n", height))
+		default:
+			// TRANSFORM/RESIZE OPERATION
+			if edit.Styles != nil {
+				change.Transform = edit.Styles.Transform
+				change.Width = edit.Styles.Width
+				change.Height = edit.Styles.Height
 			}
-			instruction.WriteString("\n")
 		}
-	}
-
-	instruction.WriteString(fmt.Sprintf(`
-Apply these visual changes to the %s codebase (%s styling).
 
-For each change:
-- Find the element using the selector
-- Update the source code to match the changes described above
-- Use the project's existing patterns and styling approach
-
-Make the changes permanent in the appropriate files.`, ctx.Framework, ctx.Styling))
+		edits.Changes = append(edits.Changes, change)
+	}
 
-	// Create a bridge message
+	// Create a bridge message; the bridge renders the visual-edits template
 	msg := bridge.Message{
-		ID: int(time.Now().UnixNano() / 1000000),
+		ID: messageID(env),
 		Area: bridge.AreaInfo{
 			X:            0,
 			Y:            0,
 			Width:        0,
 			Height:       0,
-			ElementCount: len(changesData),
+			ElementCount: len(req.Changes),
 			Elements:     []bridge.ElementInfo{},
 		},
-		Instruction: instruction.String(),
-		Screenshot:  "",
+		Instruction: summarizeEdits(edits.Changes),
+		Screenshots: screenshots,
+		PageURL:     req.PageURL,
+		Edits:       &edits,
 	}
 
 	if s.verbose {
-		fmt.Printf("[Proxy] Sending to Claude Code (%d changes)\n", len(changesData))
+		fmt.Printf("[Proxy] Sending to Claude Code (%d changes)\n", len(req.Changes))
 	}
 
-	// Send acknowledgment to frontend
-	conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-	conn.WriteJSON(map[string]interface{}{
-		"id":     msg.ID,
-		"status": "received",
-	})
-
-	// Send to Claude Code through the bridge
-	fmt.Printf("[Proxy] ⏳ Processing visual edits (ID %d)...\n", msg.ID)
-	err = s.bridge.HandleMessage(msg)
+	// Queue for Claude Code through the bridge
+	// This will block until the job completes
+	if s.verbose {
+		fmt.Printf("[Proxy] ⏳ Processing visual edits (ID %d)...\n", msg.ID)
+	}
+	job := s.submitJob(conn, env, msg)
 
 	// Send completion status
-	if err != nil {
-		fmt.Printf("[Proxy] ❌ Error processing visual edits: %v\n", err)
-		conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-		conn.WriteJSON(map[string]interface{}{
-			"id":     msg.ID,
-			"status": "error",
-			"error":  err.Error(),
-		})
-	} else {
-		fmt.Printf("[Proxy] 🎉 Visual edits applied successfully (ID %d)\n", msg.ID)
-		conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-		conn.WriteJSON(map[string]interface{}{
-			"id":     msg.ID,
-			"status": "complete",
-		})
+	if s.verbose {
+		switch job.State {
+		case bridge.JobCancelled:
+			fmt.Printf("[Proxy] ⏹  Visual edits cancelled (ID %d)\n", msg.ID)
+		case bridge.JobFailed:
+			fmt.Printf("[Proxy] ❌ Error processing visual edits: %s\n", job.Error)
+		default:
+			fmt.Printf("[Proxy] 🎉 Visual edits applied successfully (ID %d)\n", msg.ID)
+		}
 	}
+	conn.WriteJSON(newJobResult(env, job))
 
 	return nil
 }
 
 // handleAIPreview handles AI instruction preview requests - returns DOM changes without modifying files
-func (s *Server) handleAIPreview(conn *websocket.Conn, data map[string]interface{}) error {
+func (s *Server) handleAIPreview(conn *clientConn, env envelope, req *aiPreviewRequest) error {
 	if s.verbose {
 		fmt.Println("[Proxy] Handling AI preview request")
 	}
 
-	// Extract instruction
-	instruction, ok := data["instruction"].(string)
-	if !ok || instruction == "" {
-		return fmt.Errorf("missing or invalid instruction")
-	}
-
-	// Extract screenshot (optional)
-	screenshot := getString(data, "screenshot")
-
-	// Extract elements info
-	elementsData, _ := data["elements"].([]interface{})
-	elements := make([]ai.ElementInfo, 0, len(elementsData))
-	for _, el := range elementsData {
-		elMap, ok := el.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		// Parse parent info (optional)
-		var parentInfo *ai.ParentInfo
-		if parentData, ok := elMap["parent"].(map[string]interface{}); ok {
-			parentInfo = &ai.ParentInfo{
-				TagName:   getString(parentData, "tagName"),
-				ID:        getString(parentData, "id"),
-				Classes:   getString(parentData, "classes"),
-				Selector:  getString(parentData, "selector"),
-				OuterHTML: getString(parentData, "outerHTML"),
-			}
-		}
-
-		// Parse siblings info (optional)
-		var siblings []ai.SiblingInfo
-		if siblingsData, ok := elMap["siblings"].([]interface{}); ok {
-			for _, sibData := range siblingsData {
-				if sibMap, ok := sibData.(map[string]interface{}); ok {
-					siblings = append(siblings, ai.SiblingInfo{
-						TagName:   getString(sibMap, "tagName"),
-						Classes:   getString(sibMap, "classes"),
-						OuterHTML: getString(sibMap, "outerHTML"),
-					})
-				}
-			}
-		}
-
-		elements = append(elements, ai.ElementInfo{
-			TagName:   getString(elMap, "tagName"),
-			ID:        getString(elMap, "id"),
-			Classes:   getString(elMap, "classes"),
-			Selector:  getString(elMap, "selector"),
-			InnerText: getString(elMap, "innerText"),
-			OuterHTML: getString(elMap, "outerHTML"),
-			Parent:    parentInfo,
-			Siblings:  siblings,
-		})
-	}
-
-	if len(elements) == 0 {
-		return fmt.Errorf("no elements provided")
-	}
+	instruction := req.Instruction
+	screenshot := req.Screenshot
+	elements := req.Elements
 
 	// DEBUG: Log received element info
 	if len(elements) > 0 {
@@ -613,48 +628,7 @@ func (s *Server) handleAIPreview(conn *websocket.Conn, data map[string]interface
 		}
 	}
 
-	// Extract design tokens (optional)
-	var designTokens *ai.DesignTokens
-	if tokensData, ok := data["designTokens"].(map[string]interface{}); ok {
-		designTokens = &ai.DesignTokens{
-			Colors:     make(map[string]string),
-			Spacing:    make(map[string]string),
-			Typography: make(map[string]string),
-			Other:      make(map[string]string),
-		}
-
-		if colors, ok := tokensData["colors"].(map[string]interface{}); ok {
-			for k, v := range colors {
-				if str, ok := v.(string); ok {
-					designTokens.Colors[k] = str
-				}
-			}
-		}
-
-		if spacing, ok := tokensData["spacing"].(map[string]interface{}); ok {
-			for k, v := range spacing {
-				if str, ok := v.(string); ok {
-					designTokens.Spacing[k] = str
-				}
-			}
-		}
-
-		if typography, ok := tokensData["typography"].(map[string]interface{}); ok {
-			for k, v := range typography {
-				if str, ok := v.(string); ok {
-					designTokens.Typography[k] = str
-				}
-			}
-		}
-
-		if other, ok := tokensData["other"].(map[string]interface{}); ok {
-			for k, v := range other {
-				if str, ok := v.(string); ok {
-					designTokens.Other[k] = str
-				}
-			}
-		}
-	}
+	designTokens := req.DesignTokens
 
 	if s.verbose {
 		fmt.Printf("[Proxy] AI preview request: '%s' for %d element(s)\n",
@@ -668,7 +642,9 @@ func (s *Server) handleAIPreview(conn *websocket.Conn, data map[string]interface
 	// Get API key from config
 	apiKey, err := config.GetAnthropicAPIKey(s.projectDir)
 	if err != nil {
-		fmt.Printf("[Proxy] ❌ Failed to get API key: %v\n", err)
+		if s.verbose {
+			fmt.Printf("[Proxy] ❌ Failed to get API key: %v\n", err)
+		}
 		return fmt.Errorf("API key not configured. Please set ANTHROPIC_API_KEY in .claude/settings.json")
 	}
 
@@ -676,10 +652,14 @@ func (s *Server) handleAIPreview(conn *websocket.Conn, data map[string]interface
 	client := ai.NewClient(apiKey)
 
 	// Call Claude API for preview
-	fmt.Println("[Proxy] ⏳ Requesting AI preview from Claude API...")
-	changes, err := client.GeneratePreview(instruction, elements, screenshot, designTokens)
+	if s.verbose {
+		fmt.Println("[Proxy] ⏳ Requesting AI preview from Claude API...")
+	}
+	changes, err := client.GeneratePreview(s.prompts, instruction, elements, screenshot, designTokens)
 	if err != nil {
-		fmt.Printf("[Proxy] ❌ AI preview failed: %v\n", err)
+		if s.verbose {
+			fmt.Printf("[Proxy] ❌ AI preview failed: %v\n", err)
+		}
 		return err
 	}
 
@@ -687,69 +667,65 @@ func (s *Server) handleAIPreview(conn *websocket.Conn, data map[string]interface
 		fmt.Printf("[Proxy] ✅ Claude returned %d DOM change(s)\n", len(changes))
 	}
 
-	// DEBUG: Log AI response details
-	fmt.Println("[Proxy] 🤖 AI Response Changes:")
-	for i, change := range changes {
-		fmt.Printf("  %d. Action: %s, Selector: %s\n", i+1, change.Action, change.Selector)
-		if change.Position != "" {
-			fmt.Printf("     Position: %s\n", change.Position)
-		}
-		if change.Value != "" {
-			// Truncate long HTML values
-			val := change.Value
-			if len(val) > 100 {
-				val = val[:100] + "..."
+	if s.verbose {
+		// DEBUG: Log AI response details
+		fmt.Println("[Proxy] 🤖 AI Response Changes:")
+		for i, change := range changes {
+			fmt.Printf("  %d. Action: %s, Selector: %s\n", i+1, change.Action, change.Selector)
+			if change.Position != "" {
+				fmt.Printf("     Position: %s\n", change.Position)
+			}
+			if change.Value != "" {
+				// Truncate long HTML values
+				val := change.Value
+				if len(val) > 100 {
+					val = val[:100] + "..."
+				}
+				fmt.Printf("     Value: %s\n", val)
 			}
-			fmt.Printf("     Value: %s\n", val)
-		}
-	}
-
-	// Convert ai.DOMChange to frontend format
-	changesForFrontend := make([]map[string]interface{}, 0, len(changes))
-	for _, change := range changes {
-		changeMap := map[string]interface{}{
-			"selector": change.Selector,
-			"action":   change.Action,
-		}
-
-		if change.Value != "" {
-			changeMap["value"] = change.Value
-		}
-		if change.Property != "" {
-			changeMap["property"] = change.Property
-		}
-		if change.Attribute != "" {
-			changeMap["attribute"] = change.Attribute
-		}
-		if change.Position != "" {
-			changeMap["position"] = change.Position
 		}
-
-		changesForFrontend = append(changesForFrontend, changeMap)
 	}
 
 	// Send response back to browser
-	conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-	err = conn.WriteJSON(map[string]interface{}{
-		"type":    "ai-preview-result",
-		"status":  "success",
-		"changes": changesForFrontend,
-	})
-
-	if err != nil {
+	if err := conn.WriteJSON(previewReply{reply: newReply(env, statusComplete), Changes: changes}); err != nil {
 		return fmt.Errorf("failed to send response: %w", err)
 	}
 
-	fmt.Printf("[Proxy] ✅ AI preview complete - sent %d changes to browser\n", len(changes))
+	if s.verbose {
+		fmt.Printf("[Proxy] ✅ AI preview complete - sent %d changes to browser\n", len(changes))
+	}
 	return nil
 }
 
-// getString is a helper to safely extract string from map
-func getString(m map[string]interface{}, key string) string {
-	if val, ok := m[key].(string); ok {
-		return val
+// summarizeEdits describes a batch of visual edits in one line for job listings and the TUI
+func summarizeEdits(changes []prompt.VisualChange) string {
+	parts := make([]string, 0, len(changes))
+	for _, change := range changes {
+		switch change.Operation {
+		case "ai":
+			parts = append(parts, change.Instruction)
+		case "text":
+			parts = append(parts, fmt.Sprintf("text %q", change.NewText))
+		case "reorder":
+			parts = append(parts, "reorder "+change.Selector)
+		default:
+			parts = append(parts, "move/resize "+change.Selector)
+		}
+	}
+	return "Visual edits: " + strings.Join(parts, "; ")
+}
+
+// sourceLocation resolves a change's source for the prompt (empty when unknown)
+func (s *Server) sourceLocation(source *sourcemap.Location) string {
+	if source == nil {
+		return ""
+	}
+
+	loc, found := s.sources.Resolve(*source)
+	if !found && loc.Component == "" {
+		return ""
 	}
-	return ""
+	return loc.String()
 }
 
 // min helper function
@@ -762,7 +738,7 @@ func min(a, b int) int {
 
 // handleReloadWebSocket handles WebSocket connections for live reload
 func (s *Server) handleReloadWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := s.upgrade(w, r)
 	if err != nil {
 		if s.verbose {
 			fmt.Printf("[Proxy] Failed to upgrade WebSocket: %v\n", err)
@@ -786,153 +762,368 @@ func (s *Server) handleReloadWebSocket(w http.ResponseWriter, r *http.Request) {
 
 // handleMessageWebSocket handles WebSocket connections for messaging
 func (s *Server) handleMessageWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	wsConn, err := s.upgrade(w, r)
 	if err != nil {
 		if s.verbose {
 			fmt.Printf("[Proxy] Failed to upgrade WebSocket: %v\n", err)
 		}
 		return
 	}
-	defer conn.Close()
+	defer wsConn.Close()
+	conn := &clientConn{Conn: wsConn}
 
 	if s.verbose {
 		fmt.Println("[Proxy] Message WebSocket connected")
 	}
 
-	// Read messages from the browser
+	// The hello registers the client for job broadcasts
+	defer func() {
+		s.clientsMu.Lock()
+		delete(s.clients, conn)
+		s.clientsMu.Unlock()
+	}()
+
+	// Every client must say which protocol version it speaks before anything else
+	greeted := false
+
+	// Read messages from the browser. Claude Code runs are handled in their own
+	// goroutines so control messages like "cancel" are still read while they run.
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
 			break
 		}
 
-		// First, try to parse as generic map to check message type
-		var data map[string]interface{}
-		if err := json.Unmarshal(message, &data); err != nil {
+		env, req, err := parseRequest(message)
+		if err != nil {
 			if s.verbose {
-				fmt.Printf("[Proxy] Failed to parse message: %v\n", err)
+				fmt.Printf("[Proxy] Rejected %q message: %v\n", env.Type, err)
 			}
+			conn.WriteJSON(errorReply(env, err))
 			continue
 		}
 
-		// Check if this is a design analysis message
-		if msgType, ok := data["type"].(string); ok {
-			switch msgType {
-			case "analyze-design":
-				// Handle design analysis - this will block until Claude Code completes
-				if err := s.handleAnalyzeDesign(conn, data); err != nil {
-					if s.verbose {
-						fmt.Printf("[Proxy] ❌ Design analysis error: %v\n", err)
-					}
-					conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-					conn.WriteJSON(map[string]interface{}{
-						"status": "error",
-						"error":  err.Error(),
-					})
+		if hello, ok := req.(*helloRequest); ok {
+			if !s.handleHello(conn, env, hello) {
+				return
+			}
+			greeted = true
+			continue
+		}
+		if !greeted {
+			conn.WriteJSON(errorReply(env, &protocolError{
+				Code:    codeHandshakeRequired,
+				Message: fmt.Sprintf("send a hello with the protocol version (%d) first", protocolVersion),
+			}))
+			continue
+		}
+
+		s.handleRequest(conn, env, req)
+	}
+}
+
+// handleHello checks the client's protocol version, then registers it for job broadcasts
+// and sends the current queue and what the agent is doing. A client speaking a version
+// the server doesn't is told so and disconnected; false is returned.
+func (s *Server) handleHello(conn *clientConn, env envelope, hello *helloRequest) bool {
+	if hello.Version < minProtocolVersion || hello.Version > protocolVersion {
+		if s.verbose {
+			fmt.Printf("[Proxy] ⚠️  Client speaks protocol version %d, layrr speaks %d to %d\n", hello.Version, minProtocolVersion, protocolVersion)
+		}
+		conn.WriteJSON(helloReply{
+			reply: errorReply(env, &protocolError{
+				Code:    codeUnsupportedVersion,
+				Message: fmt.Sprintf("protocol version %d is not supported (layrr speaks %d to %d); reload the page or update the script", hello.Version, minProtocolVersion, protocolVersion),
+			}),
+			Version:    protocolVersion,
+			MinVersion: minProtocolVersion,
+		})
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseProtocolError, "unsupported protocol version"),
+			time.Now().Add(time.Second))
+		return false
+	}
+
+	s.clientsMu.Lock()
+	s.clients[conn] = true
+	s.clientsMu.Unlock()
+
+	conn.WriteJSON(helloReply{reply: newReply(env, statusComplete), Version: protocolVersion, MinVersion: minProtocolVersion})
+	conn.WriteJSON(jobsMessage{Type: msgJobs, Jobs: s.bridge.Jobs()})
+	if activity := s.currentActivity(); activity != nil {
+		conn.WriteJSON(activity)
+	}
+	return true
+}
+
+// handleRequest carries out a validated request from a client
+func (s *Server) handleRequest(conn *clientConn, env envelope, req request) {
+	switch req := req.(type) {
+	case *instructionRequest:
+		go s.handleInstruction(conn, env, req.message(messageID(env)))
+
+	case *designRequest:
+		// Handle design analysis - runs until Claude Code completes or is cancelled
+		go func() {
+			if err := s.handleAnalyzeDesign(conn, env, req); err != nil {
+				if s.verbose {
+					fmt.Printf("[Proxy] ❌ Design analysis error: %v\n", err)
 				}
-				continue
-
-			case "apply-visual-edits":
-				// Handle visual edits - this will block until Claude Code completes
-				if err := s.handleApplyVisualEdits(conn, data); err != nil {
-					if s.verbose {
-						fmt.Printf("[Proxy] ❌ Visual edits error: %v\n", err)
-					}
-					conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-					conn.WriteJSON(map[string]interface{}{
-						"status": "error",
-						"error":  err.Error(),
-					})
+				conn.WriteJSON(errorReply(env, err))
+			}
+		}()
+
+	case *visualEditsRequest:
+		// Handle visual edits - runs until Claude Code completes or is cancelled
+		go func() {
+			if err := s.handleApplyVisualEdits(conn, env, req); err != nil {
+				if s.verbose {
+					fmt.Printf("[Proxy] ❌ Visual edits error: %v\n", err)
 				}
-				continue
-
-			case "ai-preview":
-				// Handle AI preview request - get DOM changes without modifying code
-				if err := s.handleAIPreview(conn, data); err != nil {
-					if s.verbose {
-						fmt.Printf("[Proxy] ❌ AI preview error: %v\n", err)
-					}
-					conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-					conn.WriteJSON(map[string]interface{}{
-						"type":   "ai-preview-result",
-						"status": "error",
-						"error":  err.Error(),
-					})
+				conn.WriteJSON(errorReply(env, err))
+			}
+		}()
+
+	case *aiPreviewRequest:
+		// Handle AI preview request - get DOM changes without modifying code
+		go func() {
+			if err := s.handleAIPreview(conn, env, req); err != nil {
+				if s.verbose {
+					fmt.Printf("[Proxy] ❌ AI preview error: %v\n", err)
 				}
-				continue
+				conn.WriteJSON(errorReply(env, err))
 			}
+		}()
+
+	case *cancelRequest:
+		// Drop a queued job or kill a running one; its handler reports "cancelled".
+		// Without a jobId the running job is cancelled.
+		if s.verbose {
+			fmt.Printf("[Proxy] ⏹  Cancel requested (job %q)\n", req.JobID)
+		}
+		if req.JobID == "" {
+			status := statusComplete
+			if !s.bridge.CancelRunning() {
+				status = statusIdle
+			}
+			conn.WriteJSON(jobReply{reply: newReply(env, status)})
+		} else if err := s.bridge.Cancel(req.JobID); err != nil {
+			conn.WriteJSON(jobReply{reply: errorReply(env, err), JobID: req.JobID})
+		} else {
+			conn.WriteJSON(jobReply{reply: newReply(env, statusComplete), JobID: req.JobID})
 		}
 
-		// Otherwise, handle as regular element selection message
-		var msg bridge.Message
-		if err := json.Unmarshal(message, &msg); err != nil {
-			if s.verbose {
-				fmt.Printf("[Proxy] Failed to parse message: %v\n", err)
+	case *moveJobRequest:
+		// Reorder a queued job (position is 1-based)
+		if err := s.bridge.Move(req.JobID, req.Position); err != nil {
+			conn.WriteJSON(jobReply{reply: errorReply(env, err), JobID: req.JobID})
+		} else {
+			conn.WriteJSON(jobReply{reply: newReply(env, statusComplete), JobID: req.JobID})
+		}
+
+	case *jobRequest:
+		switch env.Type {
+		case msgUndoJob, msgRedoJob:
+			// Restore the files changed by a finished job from its git checkpoints
+			go s.handleUndoJob(conn, env, req.JobID)
+		case msgAcceptJob, msgRejectJob:
+			// Apply or discard the worktree changes of a job awaiting review
+			go s.handleReviewJob(conn, env, req.JobID)
+		case msgJobDiff:
+			// Send the patch a job awaiting review would apply
+			diff, err := s.bridge.JobDiff(req.JobID)
+			if err != nil {
+				conn.WriteJSON(diffReply{reply: errorReply(env, err), JobID: req.JobID})
+			} else {
+				conn.WriteJSON(diffReply{reply: newReply(env, statusComplete), JobID: req.JobID, Diff: diff})
 			}
-			continue
 		}
 
-		// Send acknowledgment that message was received
-		fmt.Printf("[Proxy] 📨 Sending 'received' ack for message ID %d\n", msg.ID)
-		conn.WriteJSON(map[string]interface{}{
-			"id":     msg.ID,
-			"status": "received",
-		})
+	case *newSessionRequest:
+		// Forget the current Claude Code session so the next instruction starts fresh
+		s.bridge.ResetSession()
+		if s.verbose {
+			fmt.Println("[Proxy] Started new Claude Code session")
+		}
+		conn.WriteJSON(newReply(env, statusComplete))
+	}
+}
+
+// messageID is the bridge message ID for a request: the client's id, or a timestamp
+func messageID(env envelope) int {
+	if env.ID != 0 {
+		return env.ID
+	}
+	return int(time.Now().UnixNano() / 1000000)
+}
 
-		// Handle the message (TUI will show all feedback)
-		// This blocks until Claude Code finishes
+// handleInstruction queues an element selection message and reports its status
+func (s *Server) handleInstruction(conn *clientConn, env envelope, msg bridge.Message) {
+	// Queue the message (TUI will show all feedback)
+	// This blocks until the job finishes or is cancelled
+	if s.verbose {
 		fmt.Printf("[Proxy] ⏳ Processing message ID %d...\n", msg.ID)
-		err = s.bridge.HandleMessage(msg)
+	}
+	job := s.submitJob(conn, env, msg)
 
-		// Send completion status with write deadline
-		if err != nil {
-			fmt.Printf("[Proxy] ❌ Sending 'error' status for message ID %d: %v\n", msg.ID, err)
-			conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-			if writeErr := conn.WriteJSON(map[string]interface{}{
-				"id":     msg.ID,
-				"status": "error",
-				"error":  err.Error(),
-			}); writeErr != nil {
-				fmt.Fprintf(os.Stderr, "[Proxy] Failed to send error to browser: %v\n", writeErr)
-			}
-		} else {
+	// Send completion status
+	if s.verbose {
+		switch job.State {
+		case bridge.JobCancelled:
+			fmt.Printf("[Proxy] ⏹  Sending 'cancelled' status for message ID %d\n", msg.ID)
+		case bridge.JobFailed:
+			fmt.Printf("[Proxy] ❌ Sending 'error' status for message ID %d: %s\n", msg.ID, job.Error)
+		default:
 			fmt.Printf("[Proxy] 🎉 Sending 'complete' status for message ID %d\n", msg.ID)
-			conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
-			if writeErr := conn.WriteJSON(map[string]interface{}{
-				"id":     msg.ID,
-				"status": "complete",
-			}); writeErr != nil {
-				fmt.Fprintf(os.Stderr, "[Proxy] ⚠️  Failed to send completion to browser: %v\n", writeErr)
-			} else {
-				fmt.Printf("[Proxy] ✅ Successfully sent 'complete' for message ID %d\n", msg.ID)
-			}
 		}
 	}
+
+	if writeErr := conn.WriteJSON(newJobResult(env, job)); writeErr != nil {
+		fmt.Fprintf(os.Stderr, "[Proxy] ⚠️  Failed to send status to browser: %v\n", writeErr)
+	}
 }
 
-// Shutdown gracefully shuts down the HTTP server
-func (s *Server) Shutdown(ctx context.Context) error {
-	if s.httpServer != nil {
+// submitJob queues a message, acknowledges it with its job ID and queue position,
+// and blocks until the job finishes
+func (s *Server) submitJob(conn *clientConn, env envelope, msg bridge.Message) bridge.Job {
+	job := s.bridge.Submit(msg)
+
+	if s.verbose {
+		fmt.Printf("[Proxy] 📨 Sending 'received' ack for message ID %d (job %s)\n", msg.ID, job.ID)
+	}
+	conn.WriteJSON(receivedReply{
+		reply:    newReply(env, statusReceived),
+		JobID:    job.ID,
+		Position: job.Position,
+	})
+
+	final, err := s.bridge.Wait(job.ID)
+	if err != nil {
+		final = job
+		final.State = bridge.JobFailed
+		final.Error = err.Error()
+	}
+	return final
+}
+
+// newJobResult builds the completion reply for the client that submitted a job
+func newJobResult(env envelope, job bridge.Job) jobResult {
+	result := jobResult{
+		reply: newReply(env, statusComplete),
+		JobID: job.ID,
+		// Report every file the job touched, including partial edits before a cancel or error
+		Files:   job.Files,
+		Changes: job.Changes,
+	}
+	if result.Files == nil {
+		result.Files = []string{}
+	}
+	if result.Changes == nil {
+		result.Changes = []snapshot.Change{}
+	}
+
+	switch job.State {
+	case bridge.JobCancelled:
+		result.Status = statusCancelled
+	case bridge.JobFailed:
+		result.Status = statusError
+		result.Code = codeFailed
+		result.Error = job.Error
+	case bridge.JobReview:
+		// Changes wait in a worktree; the page won't change until they're accepted
+		result.Review = true
+	}
+	return result
+}
+
+// handleUndoJob undoes or redoes a job and replies with the updated job
+func (s *Server) handleUndoJob(conn *clientConn, env envelope, jobID string) {
+	var job bridge.Job
+	var err error
+	if env.Type == msgUndoJob {
+		job, err = s.bridge.UndoJob(jobID)
+	} else {
+		job, err = s.bridge.RedoJob(jobID)
+	}
+
+	if err != nil {
 		if s.verbose {
-			fmt.Println("[Proxy] Shutting down HTTP server...")
+			fmt.Printf("[Proxy] ❌ %s failed for job %q: %v\n", env.Type, jobID, err)
 		}
-		return s.httpServer.Shutdown(ctx)
+		reply := jobReply{reply: errorReply(env, err), JobID: jobID}
+		var conflict *bridge.ConflictError
+		if errors.As(err, &conflict) {
+			reply.Conflicts = conflict.Paths
+		}
+		conn.WriteJSON(reply)
+		return
+	}
+
+	if s.verbose {
+		fmt.Printf("[Proxy] ↶ %s job %q (%d files)\n", env.Type, jobID, len(job.Files))
+	}
+	conn.WriteJSON(jobReply{reply: newReply(env, statusComplete), JobID: jobID, Job: &job})
+}
+
+// handleReviewJob accepts or rejects a job awaiting review and replies with the updated job
+func (s *Server) handleReviewJob(conn *clientConn, env envelope, jobID string) {
+	var job bridge.Job
+	var err error
+	if env.Type == msgAcceptJob {
+		job, err = s.bridge.AcceptJob(jobID)
+	} else {
+		job, err = s.bridge.RejectJob(jobID)
+	}
+
+	if err != nil {
+		if s.verbose {
+			fmt.Printf("[Proxy] ❌ %s failed for job %q: %v\n", env.Type, jobID, err)
+		}
+		conn.WriteJSON(jobReply{reply: errorReply(env, err), JobID: jobID})
+		return
+	}
+
+	if s.verbose {
+		fmt.Printf("[Proxy] 🔍 %s job %q (%d files)\n", env.Type, jobID, len(job.Files))
+	}
+	conn.WriteJSON(jobReply{reply: newReply(env, statusComplete), JobID: jobID, Job: &job})
+}
+
+// handleEvent forwards bus events the browsers care about
+func (s *Server) handleEvent(event any) {
+	switch msg := event.(type) {
+	case bridge.JobMsg:
+		s.trackJob(msg.Job)
+		s.broadcastJob(msg.Job)
+	case claude.StreamMsg:
+		s.broadcastActivity(msg.Event)
 	}
-	return nil
 }
 
-// DetectDevServer attempts to detect a running dev server
-func DetectDevServer() (int, error) {
-	commonPorts := []int{5173, 3000, 8080, 4200, 8000}
+// broadcastJob pushes a job state change to every connected browser
+func (s *Server) broadcastJob(job bridge.Job) {
+	s.broadcast(jobMessage{Type: msgJob, Job: job})
+}
 
-	for _, port := range commonPorts {
-		addr := fmt.Sprintf("localhost:%d", port)
-		conn, err := net.DialTimeout("tcp", addr, 500*time.Millisecond)
-		if err == nil {
-			conn.Close()
-			return port, nil
+// broadcast sends a message to every connected message WebSocket
+func (s *Server) broadcast(v interface{}) {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+
+	for client := range s.clients {
+		if err := client.WriteJSON(v); err != nil && s.verbose {
+			fmt.Printf("[Proxy] Failed to broadcast to client: %v\n", err)
 		}
 	}
+}
 
-	return 0, fmt.Errorf("no dev server found on common ports")
+// Shutdown gracefully shuts down the HTTP server
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.httpServer != nil {
+		if s.verbose {
+			fmt.Println("[Proxy] Shutting down HTTP server...")
+		}
+		return s.httpServer.Shutdown(ctx)
+	}
+	return nil
 }
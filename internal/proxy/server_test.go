@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/thetronjohnson/layrr/internal/events"
+)
+
+// testServer returns a proxy on localhost:9999 in front of upstream
+func testServer(t *testing.T, upstream *httptest.Server, token string) *Server {
+	t.Helper()
+
+	target, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(9999, Target{URL: target}, nil, events.New(), nil, false, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetToken(token)
+	return s
+}
+
+// get sends a request for path through the proxy's handler
+func get(s *Server, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = "localhost:9999"
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPageAfterRestart(t *testing.T) {
+	// A dev server that answers revalidations of its only version with 304
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	defer upstream.Close()
+
+	// The first run's page must not be cached
+	rec := get(testServer(t, upstream, "first"), "/", http.Header{"Accept": {"text/html"}})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `data-layrr-token="first"`) {
+		t.Fatalf("first run: %d %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("ETag") != "" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("first run's page is cacheable: %v", rec.Header())
+	}
+
+	// A browser still holding a copy revalidates it with the next run and gets the new token
+	second := testServer(t, upstream, "second")
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"navigation", http.Header{"Sec-Fetch-Dest": {"document"}, "Accept": {"text/html"}}},
+		{"frame", http.Header{"Sec-Fetch-Dest": {"iframe"}}},
+		{"without fetch metadata", http.Header{"Accept": {"text/html,application/xhtml+xml"}}},
+	}
+	for _, tt := range tests {
+		tt.header.Set("If-None-Match", `"v1"`)
+		tt.header.Set("If-Modified-Since", "Mon, 01 Jan 2024 00:00:00 GMT")
+		rec := get(second, "/", tt.header)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `data-layrr-token="second"`) {
+			t.Errorf("%s: %d %s", tt.name, rec.Code, rec.Body)
+		}
+	}
+
+	// Subresources are still revalidated
+	rec = get(second, "/app.js", http.Header{"Sec-Fetch-Dest": {"script"}, "If-None-Match": {`"v1"`}})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("script revalidation = %d, want 304", rec.Code)
+	}
+}
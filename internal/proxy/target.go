@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Target is the dev server behind the proxy
+type Target struct {
+	URL      *url.URL // Scheme and host to proxy to; the path is where the browser starts
+	Insecure bool     // Skip TLS certificate verification (self-signed dev certs)
+}
+
+// origin returns the target without its path
+func (t Target) origin() *url.URL {
+	return &url.URL{Scheme: t.URL.Scheme, Host: t.URL.Host}
+}
+
+// StartPath is the path (and query) the browser should open on the proxy
+func (t Target) StartPath() string {
+	path := t.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if t.URL.RawQuery != "" {
+		path += "?" + t.URL.RawQuery
+	}
+	return path
+}
+
+// String describes the target for startup output
+func (t Target) String() string {
+	s := t.URL.String()
+	if t.Insecure && t.URL.Scheme == "https" {
+		s += " (TLS verification off)"
+	}
+	return s
+}
+
+// local reports whether the target runs on this machine
+func (t Target) local() bool {
+	host := t.URL.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// transport returns the HTTP transport used to reach the target
+func (t Target) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if t.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return transport
+}
+
+// Check reports whether the target accepts connections
+func (t Target) Check() error {
+	addr := t.URL.Host
+	if t.URL.Port() == "" {
+		port := "80"
+		if t.URL.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(t.URL.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return fmt.Errorf("dev server %s is not reachable: %w", t.origin(), err)
+	}
+	conn.Close()
+	return nil
+}
+
+// rewriteLocation turns redirects to the target's own origin into proxy-relative ones,
+// so the browser stays on the proxy
+func (t Target) rewriteLocation(resp *http.Response) {
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return
+	}
+	u, err := url.Parse(location)
+	if err != nil || !strings.EqualFold(u.Host, t.URL.Host) || (u.Scheme != "http" && u.Scheme != "https") {
+		return
+	}
+	u.Scheme = ""
+	u.Host = ""
+	resp.Header.Set("Location", u.String())
+}
+
+// rewriteCookies fixes cookies set by a remote or HTTPS target for the proxy's origin:
+// Domain is dropped, and so is Secure unless the proxy itself serves HTTPS (secureProxy)
+func (t Target) rewriteCookies(resp *http.Response, secureProxy bool) {
+	cookies := resp.Header.Values("Set-Cookie")
+	if len(cookies) == 0 || (t.URL.Scheme == "http" && t.local()) {
+		return
+	}
+
+	resp.Header.Del("Set-Cookie")
+	for _, cookie := range cookies {
+		parts := strings.Split(cookie, ";")
+		kept := parts[:1]
+		for _, attr := range parts[1:] {
+			name, _, _ := strings.Cut(strings.TrimSpace(attr), "=")
+			if strings.EqualFold(name, "Domain") || (!secureProxy && strings.EqualFold(name, "Secure")) {
+				continue
+			}
+			// SameSite=None requires Secure, so fall back to the browser default
+			if !secureProxy && strings.EqualFold(strings.TrimSpace(attr), "SameSite=None") {
+				continue
+			}
+			kept = append(kept, attr)
+		}
+		resp.Header.Add("Set-Cookie", strings.Join(kept, ";"))
+	}
+}
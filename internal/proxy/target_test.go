@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+// testTarget parses a target URL
+func testTarget(t *testing.T, rawURL string) Target {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Target{URL: u}
+}
+
+func TestRewriteLocation(t *testing.T) {
+	target := testTarget(t, "https://app.example.com:8443/dashboard")
+
+	tests := []struct {
+		location string
+		want     string
+	}{
+		{"https://app.example.com:8443/login?next=%2F", "/login?next=%2F"},
+		{"http://APP.example.com:8443/", "/"},
+		{"https://auth.example.com/login", "https://auth.example.com/login"},
+		{"https://app.example.com/login", "https://app.example.com/login"}, // Another port is another origin
+		{"/relative", "/relative"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.location != "" {
+			resp.Header.Set("Location", tt.location)
+		}
+		target.rewriteLocation(resp)
+		if got := resp.Header.Get("Location"); got != tt.want {
+			t.Errorf("rewriteLocation(%q) = %q, want %q", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteCookies(t *testing.T) {
+	cookies := []string{
+		"session=abc; Domain=app.example.com; Path=/; Secure; HttpOnly; SameSite=None",
+		"theme=dark;domain=.example.com;secure",
+	}
+
+	tests := []struct {
+		name        string
+		target      string
+		secureProxy bool
+		want        []string
+	}{
+		{
+			name:   "local http target untouched",
+			target: "http://localhost:3000",
+			want:   cookies,
+		},
+		{
+			name:   "remote target behind an http proxy",
+			target: "https://app.example.com",
+			want:   []string{"session=abc; Path=/; HttpOnly", "theme=dark"},
+		},
+		{
+			name:        "remote target behind an https proxy",
+			target:      "https://app.example.com",
+			secureProxy: true,
+			want:        []string{"session=abc; Path=/; Secure; HttpOnly; SameSite=None", "theme=dark;secure"},
+		},
+		{
+			name:   "local https target",
+			target: "https://127.0.0.1:3000",
+			want:   []string{"session=abc; Path=/; HttpOnly", "theme=dark"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{"Set-Cookie": slices.Clone(cookies)}}
+			testTarget(t, tt.target).rewriteCookies(resp, tt.secureProxy)
+			if got := resp.Header.Values("Set-Cookie"); !slices.Equal(got, tt.want) {
+				t.Errorf("cookies = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartPath(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"http://localhost:3000", "/"},
+		{"http://localhost:3000/admin/users?tab=new", "/admin/users?tab=new"},
+		{"https://app.example.com/a%20b", "/a%20b"},
+	}
+	for _, tt := range tests {
+		if got := testTarget(t, tt.target).StartPath(); got != tt.want {
+			t.Errorf("StartPath(%s) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
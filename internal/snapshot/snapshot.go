@@ -0,0 +1,192 @@
+package snapshot
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ChangeKind describes how a file changed between two snapshots
+type ChangeKind string
+
+const (
+	Created  ChangeKind = "created"
+	Modified ChangeKind = "modified"
+	Deleted  ChangeKind = "deleted"
+)
+
+// Change is a single file that differs between two snapshots
+type Change struct {
+	Path string     `json:"path"` // Relative to the project directory, slash-separated
+	Kind ChangeKind `json:"change"`
+}
+
+// maxFiles bounds how many files a snapshot records, to keep huge trees cheap
+const maxFiles = 50000
+
+// skipDirs are never scanned (dependencies, build output, VCS and Layrr state)
+var skipDirs = map[string]bool{
+	"node_modules": true,
+	".git":         true,
+	"dist":         true,
+	"build":        true,
+	".next":        true,
+	".nuxt":        true,
+	".svelte-kit":  true,
+	".turbo":       true,
+	".cache":       true,
+	"coverage":     true,
+	".layrr":       true,
+}
+
+// SkipDir reports whether a directory with this name is left out of project scans
+func SkipDir(name string) bool {
+	return skipDirs[name]
+}
+
+// fileState is what a snapshot remembers about a file
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Snapshot is the state of a project's files at one point in time
+type Snapshot struct {
+	root  string
+	files map[string]fileState
+}
+
+// Take records the size and modification time of every project file
+func Take(root string) (*Snapshot, error) {
+	s := &Snapshot{
+		root:  root,
+		files: make(map[string]fileState),
+	}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can vanish mid-walk; skip anything unreadable
+			if d != nil && d.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if path != root && SkipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if len(s.files) >= maxFiles {
+			return filepath.SkipAll
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		s.files[filepath.ToSlash(rel)] = fileState{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Diff returns the files created, modified or deleted since s, sorted by path
+func (s *Snapshot) Diff(after *Snapshot) []Change {
+	var changes []Change
+
+	for path, before := range s.files {
+		now, ok := after.files[path]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Path: path, Kind: Deleted})
+		case now.size != before.size || !now.modTime.Equal(before.modTime):
+			changes = append(changes, Change{Path: path, Kind: Modified})
+		}
+	}
+	for path := range after.files {
+		if _, ok := s.files[path]; !ok {
+			changes = append(changes, Change{Path: path, Kind: Created})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// Merge adds files reported by the agent that the snapshot diff missed
+// (for example edits inside skipped directories). Missing files count as deleted.
+func Merge(root string, changes []Change, reported []string) []Change {
+	seen := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		seen[c.Path] = true
+	}
+
+	for _, file := range reported {
+		path := file
+		if filepath.IsAbs(path) {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				continue
+			}
+			path = rel
+		}
+		path = filepath.ToSlash(filepath.Clean(path))
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		kind := Modified
+		if _, err := os.Stat(filepath.Join(root, path)); os.IsNotExist(err) {
+			kind = Deleted
+		}
+		changes = append(changes, Change{Path: path, Kind: kind})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// RelPath makes an absolute path inside dir relative to it, as agents report files they
+// touched that way. Other paths are returned unchanged.
+func RelPath(dir, path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(root, path); err == nil && filepath.IsLocal(rel) {
+		return rel
+	}
+	return path
+}
+
+// Paths returns the paths of a change list
+func Paths(changes []Change) []string {
+	paths := make([]string, 0, len(changes))
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
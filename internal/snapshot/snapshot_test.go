@@ -0,0 +1,93 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRelPath(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(dir, "src", "App.jsx"), filepath.Join("src", "App.jsx")},
+		{filepath.Join(dir, "App.jsx"), "App.jsx"},
+		{"src/App.jsx", "src/App.jsx"}, // Already relative
+		{dir, "."},                     // The directory itself
+		{filepath.Join(filepath.Dir(dir), "other", "a.js"), filepath.Join(filepath.Dir(dir), "other", "a.js")},
+		{dir + "-sibling/a.js", dir + "-sibling/a.js"},
+	}
+
+	for _, tt := range tests {
+		if got := RelPath(dir, tt.path); got != tt.want {
+			t.Errorf("RelPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTakeAndDiff(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "keep.txt"), "same")
+	write(t, filepath.Join(dir, "edit.txt"), "before")
+	write(t, filepath.Join(dir, "gone.txt"), "bye")
+	write(t, filepath.Join(dir, "node_modules", "lib.js"), "skipped")
+
+	before, err := Take(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, filepath.Join(dir, "edit.txt"), "after, and longer")
+	os.Remove(filepath.Join(dir, "gone.txt"))
+	write(t, filepath.Join(dir, "src", "new.txt"), "hello")
+	write(t, filepath.Join(dir, "node_modules", "lib.js"), "edited but skipped")
+
+	after, err := Take(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Change{
+		{Path: "edit.txt", Kind: Modified},
+		{Path: "gone.txt", Kind: Deleted},
+		{Path: "src/new.txt", Kind: Created},
+	}
+	if got := before.Diff(after); !slices.Equal(got, want) {
+		t.Errorf("Diff() = %v, want %v", got, want)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "node_modules", "lib.js"), "patched")
+
+	changes := []Change{{Path: "src/App.jsx", Kind: Modified}}
+	reported := []string{
+		filepath.Join(dir, "src", "App.jsx"),         // Already in the diff
+		filepath.Join(dir, "node_modules", "lib.js"), // Missed by the snapshot
+		"old.txt", // Reported, but no longer there
+	}
+
+	want := []Change{
+		{Path: "node_modules/lib.js", Kind: Modified},
+		{Path: "old.txt", Kind: Deleted},
+		{Path: "src/App.jsx", Kind: Modified},
+	}
+	if got := Merge(dir, changes, reported); !slices.Equal(got, want) {
+		t.Errorf("Merge() = %v, want %v", got, want)
+	}
+}
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
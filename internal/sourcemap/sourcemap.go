@@ -0,0 +1,228 @@
+package sourcemap
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/thetronjohnson/layrr/internal/snapshot"
+)
+
+// Location is where a DOM element probably comes from in the project's source.
+// The browser fills it from framework dev metadata; Resolve turns it into a project path.
+type Location struct {
+	File      string `json:"file,omitempty"`      // Project-relative after Resolve
+	Line      int    `json:"line,omitempty"`      // 1-based, 0 when unknown
+	Column    int    `json:"column,omitempty"`    // 1-based, 0 when unknown
+	Component string `json:"component,omitempty"` // Owning component name, e.g. "PricingCard"
+	Via       string `json:"via,omitempty"`       // Where the location came from: attribute, react, vue, svelte, search
+}
+
+// String formats the location for a prompt, e.g. "src/Card.tsx:12:5 (<Card>)"
+func (l Location) String() string {
+	var s string
+	switch {
+	case l.File != "" && l.Line > 0 && l.Column > 0:
+		s = fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Column)
+	case l.File != "" && l.Line > 0:
+		s = fmt.Sprintf("%s:%d", l.File, l.Line)
+	default:
+		s = l.File
+	}
+
+	if l.Component != "" {
+		if s == "" {
+			return "<" + l.Component + ">"
+		}
+		s += " (<" + l.Component + ">)"
+	}
+	return s
+}
+
+// maxSearchFiles and maxSearchSize bound the component search on large projects
+const (
+	maxSearchFiles = 5000
+	maxSearchSize  = 1 << 20
+)
+
+// sourceExts are the files searched for component definitions
+var sourceExts = map[string]bool{
+	".js": true, ".jsx": true, ".ts": true, ".tsx": true,
+	".vue": true, ".svelte": true, ".astro": true,
+}
+
+// Resolver maps browser-reported locations to files in a project
+type Resolver struct {
+	root string
+
+	mu         sync.Mutex
+	components map[string]Location // Component search results, including misses
+}
+
+// NewResolver creates a resolver for the project at root
+func NewResolver(root string) *Resolver {
+	return &Resolver{
+		root:       root,
+		components: make(map[string]Location),
+	}
+}
+
+// Resolve makes loc's file relative to the project and checks that it exists.
+// Without a usable file, it searches the project for the component's definition.
+// It reports false when neither leads to a project file.
+func (r *Resolver) Resolve(loc Location) (Location, bool) {
+	if loc.File != "" {
+		if rel, ok := r.relative(loc.File); ok {
+			loc.File = rel
+			return loc, true
+		}
+	}
+
+	if loc.Component != "" {
+		if found, ok := r.findComponent(loc.Component); ok {
+			found.Component = loc.Component
+			return found, true
+		}
+	}
+
+	loc.File, loc.Line, loc.Column = "", 0, 0
+	return loc, false
+}
+
+// relative turns a file reported by a dev server or bundler into a path inside the project
+func (r *Resolver) relative(file string) (string, bool) {
+	file = cleanFile(file)
+	if file == "" {
+		return "", false
+	}
+
+	var candidates []string
+	if filepath.IsAbs(file) {
+		if rel, err := filepath.Rel(r.root, file); err == nil {
+			candidates = append(candidates, rel)
+		}
+	}
+	// Vite and friends report URL paths rooted at the project ("/src/App.vue")
+	candidates = append(candidates, strings.TrimPrefix(file, "/"))
+
+	for _, candidate := range candidates {
+		candidate = filepath.Clean(filepath.FromSlash(candidate))
+		if candidate == "." || candidate == ".." || strings.HasPrefix(candidate, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(r.root, candidate)); err == nil && info.Mode().IsRegular() {
+			return filepath.ToSlash(candidate), true
+		}
+	}
+	return "", false
+}
+
+// cleanFile strips bundler URL schemes, query strings and hashes from a reported file
+func cleanFile(file string) string {
+	file = strings.TrimSpace(file)
+	if i := strings.IndexAny(file, "?#"); i >= 0 {
+		file = file[:i]
+	}
+	for _, prefix := range []string{"webpack-internal:///", "webpack://", "file://", "/@fs"} {
+		file = strings.TrimPrefix(file, prefix)
+	}
+	// Next.js reports "webpack://_N_E/./src/app/page.tsx"
+	file = strings.TrimPrefix(file, "_N_E/")
+	file = strings.TrimPrefix(file, "(app-pages-browser)/")
+	return strings.TrimPrefix(file, "./")
+}
+
+// findComponent searches the project for the file that defines a component
+func (r *Resolver) findComponent(name string) (Location, bool) {
+	if !validComponent.MatchString(name) {
+		return Location{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if loc, ok := r.components[name]; ok {
+		return loc, loc.File != ""
+	}
+
+	loc := r.searchComponent(name)
+	r.components[name] = loc
+	return loc, loc.File != ""
+}
+
+// validComponent matches names worth searching for (components are capitalized identifiers)
+var validComponent = regexp.MustCompile(`^[A-Z][A-Za-z0-9_$]*$`)
+
+// searchComponent walks the project looking for a definition of name.
+// Single-file components named after the component (Card.vue) win over declarations.
+func (r *Resolver) searchComponent(name string) Location {
+	definition := regexp.MustCompile(`\b(?:function|class)\s+` + regexp.QuoteMeta(name) + `\b|\b(?:const|let|var)\s+` + regexp.QuoteMeta(name) + `\s*[=:]`)
+
+	var found Location
+	scanned := 0
+	filepath.WalkDir(r.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != r.root && snapshot.SkipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ext := filepath.Ext(path)
+		if !sourceExts[ext] {
+			return nil
+		}
+		rel, err := filepath.Rel(r.root, path)
+		if err != nil {
+			return nil
+		}
+
+		if (ext == ".vue" || ext == ".svelte" || ext == ".astro") && strings.TrimSuffix(d.Name(), ext) == name {
+			found = Location{File: filepath.ToSlash(rel), Line: 1, Via: "search"}
+			return filepath.SkipAll
+		}
+
+		scanned++
+		if scanned > maxSearchFiles {
+			return filepath.SkipAll
+		}
+		if found.File == "" {
+			if line := matchLine(path, definition); line > 0 {
+				// Keep walking in case a single-file component matches by name
+				found = Location{File: filepath.ToSlash(rel), Line: line, Via: "search"}
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// matchLine returns the 1-based line of the first match of re in the file, or 0
+func matchLine(path string, re *regexp.Regexp) int {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxSearchSize {
+		return 0
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxSearchSize)
+	for line := 1; scanner.Scan(); line++ {
+		if re.Match(scanner.Bytes()) {
+			return line
+		}
+	}
+	return 0
+}
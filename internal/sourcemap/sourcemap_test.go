@@ -0,0 +1,152 @@
+package sourcemap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// project creates files (slash-separated paths) under a new directory
+func project(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestResolve(t *testing.T) {
+	root := project(t, map[string]string{
+		"src/App.tsx":                  "export default function App() {}\n",
+		"src/components/Card.tsx":      "import x from 'y'\n\nexport const Card = () => null\n",
+		"src/components/Badge.vue":     "<template></template>\n",
+		"src/lib/button.js":            "// Button\nexport class Button {}\n",
+		"node_modules/ui/Modal.js":     "export function Modal() {}\n",
+		"src/components/Modal.tsx":     "\n\nfunction Modal() {}\n",
+		"src/components/Badge.test.ts": "const Badge = mock()\n",
+	})
+
+	tests := []struct {
+		name string
+		loc  Location
+		want Location
+		ok   bool
+	}{
+		{
+			name: "relative file",
+			loc:  Location{File: "src/App.tsx", Line: 3, Column: 5, Via: "attribute"},
+			want: Location{File: "src/App.tsx", Line: 3, Column: 5, Via: "attribute"},
+			ok:   true,
+		},
+		{
+			name: "absolute file",
+			loc:  Location{File: filepath.Join(root, "src", "App.tsx"), Line: 1},
+			want: Location{File: "src/App.tsx", Line: 1},
+			ok:   true,
+		},
+		{
+			name: "vite URL path",
+			loc:  Location{File: "/src/App.tsx?t=123", Line: 1},
+			want: Location{File: "src/App.tsx", Line: 1},
+			ok:   true,
+		},
+		{
+			name: "next.js webpack URL",
+			loc:  Location{File: "webpack://_N_E/./src/App.tsx", Line: 2},
+			want: Location{File: "src/App.tsx", Line: 2},
+			ok:   true,
+		},
+		{
+			name: "outside the project falls back to the component",
+			loc:  Location{File: "../other/App.tsx", Line: 9, Component: "Card"},
+			want: Location{File: "src/components/Card.tsx", Line: 3, Component: "Card", Via: "search"},
+			ok:   true,
+		},
+		{
+			name: "single-file component wins",
+			loc:  Location{Component: "Badge"},
+			want: Location{File: "src/components/Badge.vue", Line: 1, Component: "Badge", Via: "search"},
+			ok:   true,
+		},
+		{
+			name: "class declaration",
+			loc:  Location{Component: "Button"},
+			want: Location{File: "src/lib/button.js", Line: 2, Component: "Button", Via: "search"},
+			ok:   true,
+		},
+		{
+			name: "node_modules skipped",
+			loc:  Location{Component: "Modal"},
+			want: Location{File: "src/components/Modal.tsx", Line: 3, Component: "Modal", Via: "search"},
+			ok:   true,
+		},
+		{
+			name: "unknown component",
+			loc:  Location{File: "src/Gone.tsx", Line: 4, Column: 2, Component: "Gone", Via: "react"},
+			want: Location{Component: "Gone", Via: "react"},
+		},
+		{
+			name: "not a component name",
+			loc:  Location{Component: "div"},
+			want: Location{Component: "div"},
+		},
+	}
+
+	r := NewResolver(root)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := r.Resolve(tt.loc)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Resolve(%+v) = %+v, %v, want %+v, %v", tt.loc, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestResolveCachesSearches(t *testing.T) {
+	root := project(t, map[string]string{"src/Card.jsx": "function Card() {}\n"})
+	r := NewResolver(root)
+
+	if _, ok := r.Resolve(Location{Component: "Card"}); !ok {
+		t.Fatal("Card not found")
+	}
+	if _, ok := r.Resolve(Location{Component: "Missing"}); ok {
+		t.Fatal("Missing found")
+	}
+
+	// Results, including misses, are kept for the session
+	os.Remove(filepath.Join(root, "src", "Card.jsx"))
+	os.WriteFile(filepath.Join(root, "src", "Missing.jsx"), []byte("function Missing() {}\n"), 0644)
+	if got, ok := r.Resolve(Location{Component: "Card"}); !ok || got.File != "src/Card.jsx" {
+		t.Errorf("cached Card = %+v, %v", got, ok)
+	}
+	if _, ok := r.Resolve(Location{Component: "Missing"}); ok {
+		t.Error("cached miss was searched again")
+	}
+}
+
+func TestLocationString(t *testing.T) {
+	tests := []struct {
+		loc  Location
+		want string
+	}{
+		{Location{File: "src/Card.tsx", Line: 12, Column: 5, Component: "Card"}, "src/Card.tsx:12:5 (<Card>)"},
+		{Location{File: "src/Card.tsx", Line: 12}, "src/Card.tsx:12"},
+		{Location{File: "src/Card.tsx"}, "src/Card.tsx"},
+		{Location{Component: "Card"}, "<Card>"},
+		{Location{}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.loc.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.loc, got, tt.want)
+		}
+	}
+}
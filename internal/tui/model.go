@@ -1,10 +1,16 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/thetronjohnson/layrr/internal/bridge"
+	"github.com/thetronjohnson/layrr/internal/claude"
+	"github.com/thetronjohnson/layrr/internal/devserver"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
 )
 
 // Event types that can be added to the TUI
@@ -17,28 +23,46 @@ const (
 	EventToolResult  EventType = "tool_result"
 	EventError       EventType = "error"
 	EventComplete    EventType = "complete"
+	EventSession     EventType = "session"
+	EventCancelled   EventType = "cancelled"
+	EventSystem      EventType = "system"
+	EventResult      EventType = "result"
+	EventChanges     EventType = "changes"
+	EventUndo        EventType = "undo"
+	EventReview      EventType = "review"
 )
 
 // Event represents a streaming event from Claude Code
 type Event struct {
 	Type    EventType
 	Content string
-	Data    map[string]interface{}
+	Detail  string // Tool target (file, command, pattern) or result summary
+	IsError bool   // Tool result reported an error
+	Changes []snapshot.Change
 }
 
 // Model is the Bubble Tea model for the TUI
 type Model struct {
-	instruction   string
-	areaInfo      string
-	events        []Event
-	status        string // "waiting", "processing", "complete", "error"
-	startTime     time.Time
-	duration      time.Duration
-	width         int
-	height        int
-	completionAck chan<- struct{} // Channel to signal completion to Bridge
+	instruction  string
+	areaInfo     string
+	events       []Event
+	status       string // "waiting", "processing", "complete", "error", "cancelled"
+	startTime    time.Time
+	duration     time.Duration
+	width        int
+	height       int
+	sessionID    string              // Current Claude Code session (empty = fresh session)
+	onNewSession func()              // Called when the user asks for a new session
+	onCancel     func()              // Called when the user cancels the running instruction
+	queued       []string            // Instructions waiting in the job queue, in order
+	policy       string              // Active permission preset
+	devServer    *devserver.StateMsg // Latest state of the dev server layrr runs (nil if it doesn't)
+	devLogs      []string            // Last lines of the dev server's output
 }
 
+// maxDevLogs is how many lines of dev server output are kept
+const maxDevLogs = 200
+
 // NewModel creates a new TUI model
 func NewModel() Model {
 	return Model{
@@ -49,6 +73,26 @@ func NewModel() Model {
 	}
 }
 
+// SetNewSessionHandler sets the callback used by the "new session" keybinding
+func (m *Model) SetNewSessionHandler(fn func()) {
+	m.onNewSession = fn
+}
+
+// SetPolicy sets the permission preset shown in the header
+func (m *Model) SetPolicy(policy string) {
+	m.policy = policy
+}
+
+// SetDevServer shows the pane for a dev server layrr started, which is ready at url
+func (m *Model) SetDevServer(command, url string) {
+	m.devServer = &devserver.StateMsg{State: devserver.Ready, Command: command, URL: url}
+}
+
+// SetCancelHandler sets the callback used by the "cancel" keybinding
+func (m *Model) SetCancelHandler(fn func()) {
+	m.onCancel = fn
+}
+
 // Init initializes the TUI
 func (m Model) Init() tea.Cmd {
 	return nil
@@ -68,7 +112,76 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		}
 
-	case InstructionMsg:
+		// Esc to cancel the running instruction
+		if msg.Type == tea.KeyEsc && m.onCancel != nil && m.status == "processing" {
+			m.onCancel()
+			return m, nil
+		}
+
+		// n to start a new Claude Code session
+		if msg.String() == "n" && m.onNewSession != nil && m.status != "processing" {
+			m.onNewSession()
+		}
+		return m, nil
+
+	case bridge.ChangesMsg:
+		m.events = append(m.events, Event{
+			Type:    EventChanges,
+			Changes: msg.Changes,
+		})
+		return m, nil
+
+	case bridge.UndoMsg:
+		action := "Undid"
+		if msg.Redo {
+			action = "Redid"
+		}
+		m.events = append(m.events, Event{
+			Type:    EventUndo,
+			Content: fmt.Sprintf("%s \"%s\" · %d file(s) restored", action, msg.Instruction, len(msg.Files)),
+		})
+		return m, nil
+
+	case bridge.ReviewMsg:
+		content := fmt.Sprintf("Review \"%s\" in %s (accept or reject in the browser)", msg.Instruction, msg.Path)
+		if msg.Accepted {
+			content = fmt.Sprintf("Accepted \"%s\" into the working tree", msg.Instruction)
+		} else if msg.Rejected {
+			content = fmt.Sprintf("Rejected \"%s\"", msg.Instruction)
+		}
+		m.events = append(m.events, Event{
+			Type:    EventReview,
+			Content: content,
+		})
+		return m, nil
+
+	case bridge.QueueMsg:
+		m.queued = msg.Queued
+		return m, nil
+
+	case devserver.StateMsg:
+		m.devServer = &msg
+		return m, nil
+
+	case devserver.LogMsg:
+		m.devLogs = append(m.devLogs, msg.Line)
+		if len(m.devLogs) > maxDevLogs {
+			m.devLogs = m.devLogs[len(m.devLogs)-maxDevLogs:]
+		}
+		return m, nil
+
+	case claude.SessionMsg:
+		// Mark the start of a fresh session in the history
+		if msg.SessionID == "" && m.sessionID != "" {
+			m.events = append(m.events, Event{
+				Type:    EventSession,
+				Content: "New session started",
+			})
+		}
+		m.sessionID = msg.SessionID
+		return m, nil
+
+	case bridge.InstructionMsg:
 		// Add separator if there are existing events (for history)
 		if len(m.events) > 0 {
 			m.events = append(m.events, Event{
@@ -81,7 +194,6 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.areaInfo = msg.AreaInfo
 		m.status = "processing"
 		m.startTime = time.Now()
-		m.completionAck = msg.CompletionAck // Store completion channel
 
 		// Append new instruction instead of replacing
 		m.events = append(m.events, Event{
@@ -94,10 +206,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.events = append(m.events, Event{
 			Type:    msg.EventType,
 			Content: msg.Content,
-			Data:    msg.Data,
+			Detail:  msg.Detail,
 		})
 		return m, nil
 
+	// Handle parsed stream events from the manager
+	case claude.StreamMsg:
+		m.events = append(m.events, eventsFromStream(msg.Event)...)
+		return m, nil
+
 	case CompleteMsg:
 		m.status = "complete"
 		m.duration = time.Since(m.startTime)
@@ -115,61 +232,103 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		})
 		return m, nil
 
-	// Handle StreamEvent from manager
-	case StreamEvent:
-		eventType := EventType(msg.Type)
-		m.events = append(m.events, Event{
-			Type:    eventType,
-			Content: msg.Content,
-			Data:    msg.Data,
-		})
-
-		// Update status if this is a completion or error event
-		if eventType == EventComplete {
-			m.status = "complete"
-			m.duration = time.Since(m.startTime)
-			// Signal completion to Bridge
-			if m.completionAck != nil {
-				close(m.completionAck)
-				m.completionAck = nil
-			}
-		} else if eventType == EventError {
+	// Handle the end of a Claude Code run
+	case claude.FinishedMsg:
+		switch {
+		case errors.Is(msg.Err, claude.ErrCancelled):
+			m.status = "cancelled"
+			m.events = append(m.events, Event{
+				Type:    EventCancelled,
+				Content: fmt.Sprintf("%d file(s) edited before cancel", len(msg.Files)),
+			})
+		case msg.Err != nil:
 			m.status = "error"
-			m.duration = time.Since(m.startTime)
-			// Signal completion to Bridge
-			if m.completionAck != nil {
-				close(m.completionAck)
-				m.completionAck = nil
-			}
+			m.events = append(m.events, Event{
+				Type:    EventError,
+				Content: msg.Err.Error(),
+			})
+		default:
+			m.status = "complete"
+			m.events = append(m.events, Event{Type: EventComplete})
 		}
-
+		m.duration = time.Since(m.startTime)
 		return m, nil
 	}
 
 	return m, nil
 }
 
-// StreamEvent is sent from the manager when parsing streaming output
-type StreamEvent struct {
-	Type    string
-	Content string
-	Data    map[string]interface{}
-}
+// eventsFromStream converts a parsed Claude Code event into TUI events
+func eventsFromStream(event claude.Event) []Event {
+	var events []Event
 
-// Messages that can be sent to the TUI
+	switch event.Type {
+	case claude.EventSystem:
+		if event.Subtype == "init" && event.Model != "" {
+			events = append(events, Event{
+				Type:    EventSystem,
+				Content: fmt.Sprintf("%s · %d tools", event.Model, len(event.Tools)),
+			})
+		}
 
-// InstructionMsg is sent when a new instruction is received from the browser
-type InstructionMsg struct {
-	Instruction   string
-	AreaInfo      string
-	CompletionAck chan<- struct{} // Channel to signal when processing is complete
+	case claude.EventAssistant:
+		if event.Message == nil {
+			break
+		}
+		for _, block := range event.Message.Content {
+			switch block.Type {
+			case claude.BlockText:
+				events = append(events, Event{Type: EventContent, Content: block.Text})
+			case claude.BlockToolUse:
+				events = append(events, Event{
+					Type:    EventToolUse,
+					Content: block.Name,
+					Detail:  block.Input.Target(),
+				})
+			}
+		}
+
+	case claude.EventUser:
+		for _, block := range event.Blocks(claude.BlockToolResult) {
+			events = append(events, Event{
+				Type:    EventToolResult,
+				Content: firstLine(block.ResultText()),
+				IsError: block.IsError,
+			})
+		}
+
+	case claude.EventResult:
+		summary := fmt.Sprintf("%d turn(s) · $%.4f", event.NumTurns, event.TotalCostUSD)
+		if event.Usage != nil {
+			summary += fmt.Sprintf(" · %d in / %d out tokens", event.Usage.InputTokens, event.Usage.OutputTokens)
+		}
+		events = append(events, Event{
+			Type:    EventResult,
+			Content: summary,
+			IsError: event.IsError,
+		})
+	}
+
+	return events
+}
+
+// firstLine returns the first non-empty line of s
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) != "" {
+			return line
+		}
+	}
+	return ""
 }
 
+// Messages that can be sent to the TUI
+
 // StreamEventMsg is sent for each streaming event from Claude Code
 type StreamEventMsg struct {
 	EventType EventType
 	Content   string
-	Data      map[string]interface{}
+	Detail    string
 }
 
 // CompleteMsg is sent when Claude Code finishes successfully
@@ -180,23 +339,13 @@ type ErrorMsg struct {
 	Error string
 }
 
-// Helper to send instruction
-func SendInstruction(instruction, areaInfo string) tea.Cmd {
-	return func() tea.Msg {
-		return InstructionMsg{
-			Instruction: instruction,
-			AreaInfo:    areaInfo,
-		}
-	}
-}
-
 // Helper to send stream event
-func SendStreamEvent(eventType EventType, content string, data map[string]interface{}) tea.Cmd {
+func SendStreamEvent(eventType EventType, content, detail string) tea.Cmd {
 	return func() tea.Msg {
 		return StreamEventMsg{
 			EventType: eventType,
 			Content:   content,
-			Data:      data,
+			Detail:    detail,
 		}
 	}
 }
@@ -5,8 +5,13 @@ import (
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/thetronjohnson/layrr/internal/devserver"
+	"github.com/thetronjohnson/layrr/internal/snapshot"
 )
 
+// devLogLines is how many lines of dev server output the pane shows
+const devLogLines = 5
+
 // Color palette - Matching GUI design language
 var (
 	primaryColor    = lipgloss.Color("#F19E38") // Orange (matching GUI edit mode)
@@ -109,12 +114,40 @@ func (m Model) View() string {
 	b.WriteString(artStyle.Render(asciiArt))
 	b.WriteString("\n\n")
 
+	// Session indicator and keybindings
+	session := "new session"
+	if m.sessionID != "" {
+		session = "session " + m.sessionID[:min(8, len(m.sessionID))]
+	}
+	if m.policy != "" {
+		session += " · policy " + m.policy
+	}
+	b.WriteString(durationStyle.Render(fmt.Sprintf("%s · esc cancel · n new session · ctrl+c quit", session)))
+	b.WriteString("\n\n")
+
+	// Dev server started by layrr
+	if m.devServer != nil {
+		b.WriteString(m.devServerView())
+		b.WriteString("\n")
+	}
+
+	// Job queue
+	if len(m.queued) > 0 {
+		b.WriteString(statusWaitingStyle.Render(fmt.Sprintf("⏳ Queued (%d)", len(m.queued))))
+		b.WriteString("\n")
+		for i, instruction := range m.queued {
+			b.WriteString(areaInfoStyle.Render(fmt.Sprintf("   %d. %s", i+1, instruction)))
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+
 	// Status
 	switch m.status {
 	case "waiting":
 		b.WriteString(statusWaitingStyle.Render("⏳ Waiting for browser selection..."))
 		b.WriteString("\n")
-	case "processing", "complete", "error":
+	case "processing", "complete", "error", "cancelled":
 		// Status indicator (only if currently processing)
 		if m.status == "processing" {
 			b.WriteString(statusProcessingStyle.Render("🤖 Claude is working..."))
@@ -149,36 +182,77 @@ func (m Model) View() string {
 				}
 
 			case EventToolUse:
-				// Use Content which has the tool name extracted by manager
 				toolName := event.Content
 				if toolName == "" {
-					// Fallback to Data if Content is empty
-					if name, ok := event.Data["name"].(string); ok {
-						toolName = name
-					} else {
-						toolName = "Tool"
-					}
+					toolName = "Tool"
 				}
 				icon := getToolIcon(toolName)
 				b.WriteString(toolUseStyle.Render(fmt.Sprintf("   %s %s", icon, toolName)))
+				if event.Detail != "" {
+					b.WriteString(toolResultStyle.Render(" " + truncate(event.Detail, 70)))
+				}
 				b.WriteString("\n")
 
 			case EventToolResult:
-				// Show tool result (usually not displayed unless verbose)
-				if event.Content != "" && strings.TrimSpace(event.Content) != "" {
-					// Truncate long results
-					result := event.Content
-					if len(result) > 100 {
-						result = result[:100] + "..."
+				// Show the first line of the tool result
+				if strings.TrimSpace(event.Content) != "" {
+					result := truncate(event.Content, 100)
+					if event.IsError {
+						b.WriteString(errorStyle.Render("   ✗ " + result))
+					} else {
+						b.WriteString(toolResultStyle.Render("   → " + result))
 					}
-					b.WriteString(toolResultStyle.Render("   → " + result))
 					b.WriteString("\n")
 				}
 
+			case EventSystem:
+				b.WriteString(areaInfoStyle.Render("   ⚙ " + event.Content))
+				b.WriteString("\n")
+
+			case EventResult:
+				b.WriteString(durationStyle.Render("   Σ " + event.Content))
+				b.WriteString("\n")
+
+			case EventReview:
+				b.WriteString(statusProcessingStyle.Render("   🔍 " + event.Content))
+				b.WriteString("\n")
+
+			case EventUndo:
+				b.WriteString("\n")
+				b.WriteString(statusProcessingStyle.Render("↶ " + event.Content))
+				b.WriteString("\n")
+
+			case EventSession:
+				b.WriteString(areaInfoStyle.Render("   ↺ " + event.Content))
+				b.WriteString("\n")
+
 			case EventError:
 				b.WriteString(errorStyle.Render("   ❌ " + event.Content))
 				b.WriteString("\n")
 
+			case EventCancelled:
+				b.WriteString("\n")
+				b.WriteString(statusProcessingStyle.Render("⏹  Cancelled · " + event.Content))
+				b.WriteString("\n")
+
+			case EventChanges:
+				if len(event.Changes) == 0 {
+					b.WriteString(areaInfoStyle.Render("   No files changed"))
+					b.WriteString("\n")
+					break
+				}
+				b.WriteString(toolUseStyle.Render(fmt.Sprintf("   📝 %d file(s) changed", len(event.Changes))))
+				b.WriteString("\n")
+				for _, change := range event.Changes {
+					line := fmt.Sprintf("      %s %s", changeMarker(change.Kind), change.Path)
+					if change.Kind == snapshot.Deleted {
+						b.WriteString(errorStyle.Render(line))
+					} else {
+						b.WriteString(contentStyle.Render(line))
+					}
+					b.WriteString("\n")
+				}
+
 			case EventComplete:
 				// Show completion status in history with visual flair
 				b.WriteString("\n")
@@ -195,6 +269,41 @@ func (m Model) View() string {
 	return b.String()
 }
 
+// devServerView renders the dev server's state and its latest output
+func (m Model) devServerView() string {
+	var b strings.Builder
+
+	state := m.devServer
+	line := fmt.Sprintf("dev server · %s", state.Command)
+	if state.URL != "" {
+		line += " · " + state.URL
+	}
+	if state.Restarts > 0 {
+		line += fmt.Sprintf(" · %d restart(s)", state.Restarts)
+	}
+	switch state.State {
+	case devserver.Ready:
+		b.WriteString(statusCompleteStyle.Render("● " + line))
+	case devserver.Starting:
+		b.WriteString(statusProcessingStyle.Render("◌ " + line + " · starting"))
+	case devserver.Crashed:
+		reason := "exited"
+		if state.Err != nil {
+			reason = state.Err.Error()
+		}
+		b.WriteString(errorStyle.Render(fmt.Sprintf("✗ %s · %s, restarting in %s", line, reason, state.RestartIn)))
+	default:
+		b.WriteString(statusWaitingStyle.Render("○ " + line + " · stopped"))
+	}
+	b.WriteString("\n")
+
+	for _, log := range m.devLogs[max(0, len(m.devLogs)-devLogLines):] {
+		b.WriteString(areaInfoStyle.Render("   │ " + truncate(log, 100)))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
 // Helper to get icon for tool
 func getToolIcon(toolName string) string {
 	switch toolName {
@@ -221,6 +330,26 @@ func getToolIcon(toolName string) string {
 	}
 }
 
+// Helper to get the marker for a file change
+func changeMarker(kind snapshot.ChangeKind) string {
+	switch kind {
+	case snapshot.Created:
+		return "+"
+	case snapshot.Deleted:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// Helper to shorten long single-line text
+func truncate(s string, max int) string {
+	if runes := []rune(s); len(runes) > max {
+		return string(runes[:max]) + "..."
+	}
+	return s
+}
+
 // Helper for min
 func min(a, b int) int {
 	if a < b {